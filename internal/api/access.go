@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"log"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Moderator - an extension point for the users who may act on the content and the accounts of others: delete the posts
+// and comments written by others, lock the posts, ban the users and manage the roles. The authors may always delete
+// their own posts and comments, the moderator is only asked about the others
+type Moderator interface {
+	CanDeletePost(user *models.User, post *models.Post) bool
+	CanDeleteComment(user *models.User, post *models.Post, comment *models.Comment) bool
+	CanLockPost(user *models.User, post *models.Post) bool
+	CanBanUser(user, target *models.User) bool
+	CanManageRoles(user *models.User) bool
+}
+
+// NoModerators - the moderator that lets nobody act on the content and the accounts of others
+type NoModerators struct{}
+
+func (NoModerators) CanDeletePost(*models.User, *models.Post) bool {
+	return false
+}
+
+func (NoModerators) CanDeleteComment(*models.User, *models.Post, *models.Comment) bool {
+	return false
+}
+
+func (NoModerators) CanLockPost(*models.User, *models.Post) bool {
+	return false
+}
+
+func (NoModerators) CanBanUser(*models.User, *models.User) bool {
+	return false
+}
+
+func (NoModerators) CanManageRoles(*models.User) bool {
+	return false
+}
+
+// RoleModerator - the moderator that decides by the roles of the users: the roles in a category allow the actions on the posts
+// and comments of that category, the roles on the whole site allow them everywhere and also the bans. Admins can not be banned
+type RoleModerator struct {
+	Roles repository.RoleRepository
+}
+
+// The method of checking that one of the roles of the user gives the permission in the category, an error of the repository denies it
+func (moderator RoleModerator) HasPermission(user *models.User, permission models.Permission, category string) bool {
+	grants, err := moderator.Roles.GetByUserID(user.ID)
+	if err != nil {
+		log.Printf("RoleModerator RoleRepo GetByUserID err: %s", err)
+		return false
+	}
+	for _, grant := range grants {
+		if grant.Allows(permission, category) {
+			return true
+		}
+	}
+	return false
+}
+
+func (moderator RoleModerator) CanDeletePost(user *models.User, post *models.Post) bool {
+	return moderator.HasPermission(user, models.PermissionDeletePost, post.Category)
+}
+
+func (moderator RoleModerator) CanDeleteComment(user *models.User, post *models.Post, _ *models.Comment) bool {
+	return moderator.HasPermission(user, models.PermissionRemoveComment, post.Category)
+}
+
+func (moderator RoleModerator) CanLockPost(user *models.User, post *models.Post) bool {
+	return moderator.HasPermission(user, models.PermissionLockPost, post.Category)
+}
+
+func (moderator RoleModerator) CanBanUser(user, target *models.User) bool {
+	return moderator.HasPermission(user, models.PermissionBanUser, "") &&
+		!moderator.HasPermission(target, models.PermissionManageRoles, "")
+}
+
+func (moderator RoleModerator) CanManageRoles(user *models.User) bool {
+	return moderator.HasPermission(user, models.PermissionManageRoles, "")
+}
+
+// The method of checking that the user may delete the post: the author or whoever the moderator allows.
+// A request with a personal access token needs the post scope to delete its own posts and the moderate scope for the posts of others
+func (server *Server) canDeletePost(ctx context.Context, user *models.User, post *models.Post) bool {
+	if post.Author.ID == user.ID && scopeAllowed(ctx, models.ScopePost) {
+		return true
+	}
+	return server.Moderator != nil && scopeAllowed(ctx, models.ScopeModerate) && server.Moderator.CanDeletePost(user, post)
+}
+
+// The method of checking that the user may delete the comment of the post: the author or whoever the moderator allows.
+// A request with a personal access token needs the post scope to delete its own comments and the moderate scope for the comments of others
+func (server *Server) canDeleteComment(ctx context.Context, user *models.User, post *models.Post, comment *models.Comment) bool {
+	if comment.Author.ID == user.ID && scopeAllowed(ctx, models.ScopePost) {
+		return true
+	}
+	return server.Moderator != nil && scopeAllowed(ctx, models.ScopeModerate) && server.Moderator.CanDeleteComment(user, post, comment)
+}
+
+// The method of checking that the user may lock and unlock the post, the authors may not lock their own posts
+func (server *Server) canLockPost(ctx context.Context, user *models.User, post *models.Post) bool {
+	return server.Moderator != nil && scopeAllowed(ctx, models.ScopeModerate) && server.Moderator.CanLockPost(user, post)
+}
+
+// The method of checking that the user may ban and unban the target, nobody may ban itself
+func (server *Server) canBanUser(ctx context.Context, user, target *models.User) bool {
+	return user.ID != target.ID && server.Moderator != nil && scopeAllowed(ctx, models.ScopeModerate) &&
+		server.Moderator.CanBanUser(user, target)
+}
+
+// The method of checking that the user may grant and revoke the roles
+func (server *Server) canManageRoles(user *models.User) bool {
+	return server.Moderator != nil && server.Moderator.CanManageRoles(user)
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+func TestDeletePostPermissions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	post := ts.createPost(alice, "music")
+	path := "/api/post/" + post.ID
+
+	ts.expect(http.StatusUnauthorized, "DELETE", path, "", nil)
+	ts.expect(http.StatusUnauthorized, "DELETE", path, "not-a-token", nil)
+	ts.expect(http.StatusForbidden, "DELETE", path, bob, nil)
+	ts.expect(http.StatusOK, "GET", path, "", nil)
+
+	ts.expect(http.StatusOK, "DELETE", path, alice, nil)
+	if _, err := ts.MemServ.PostRepo.GetByID(post.ID); !errors.Is(err, repository.ErrPostNotFound) {
+		t.Fatalf("GetByID of the deleted post: got %v, want ErrPostNotFound", err)
+	}
+	ts.expect(http.StatusNotFound, "DELETE", path, alice, nil)
+}
+
+func TestDeleteCommentPermissions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	post := ts.createPost(alice, "music")
+	aliceComment := ts.addComment(alice, post.ID)
+	bobComment := ts.addComment(bob, post.ID)
+	alicePath := "/api/post/" + post.ID + "/" + aliceComment.ID
+	bobPath := "/api/post/" + post.ID + "/" + bobComment.ID
+
+	ts.expect(http.StatusUnauthorized, "DELETE", alicePath, "", nil)
+	// Neither the commenter on a post of another user nor the author of the post may delete the comments of the others
+	ts.expect(http.StatusForbidden, "DELETE", alicePath, bob, nil)
+	ts.expect(http.StatusForbidden, "DELETE", bobPath, alice, nil)
+
+	ts.expect(http.StatusOK, "DELETE", bobPath, bob, nil)
+	ts.expect(http.StatusOK, "DELETE", alicePath, alice, nil)
+	ts.expect(http.StatusNotFound, "DELETE", alicePath, alice, nil)
+}
+
+func TestRoleModeratorHasPermission(t *testing.T) {
+	type check struct {
+		permission models.Permission
+		category   string
+		want       bool
+	}
+	// The checks of a role that moderates the posts of the category only
+	categoryOnly := func(category, other string) []check {
+		return []check{
+			{models.PermissionDeletePost, category, true},
+			{models.PermissionDeletePost, other, false},
+			{models.PermissionRemoveComment, category, true},
+			{models.PermissionRemoveComment, other, false},
+			{models.PermissionLockPost, category, true},
+			{models.PermissionLockPost, other, false},
+			{models.PermissionBanUser, "", false},
+			{models.PermissionManageRoles, "", false},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		grants []models.RoleGrant
+		checks []check
+	}{
+		{name: "no roles", checks: []check{
+			{models.PermissionDeletePost, "music", false},
+			{models.PermissionRemoveComment, "music", false},
+			{models.PermissionLockPost, "music", false},
+			{models.PermissionBanUser, "", false},
+			{models.PermissionManageRoles, "", false},
+		}},
+		{name: "moderator of the site", grants: []models.RoleGrant{{Role: models.RoleModerator}}, checks: []check{
+			{models.PermissionDeletePost, "music", true},
+			{models.PermissionDeletePost, "news", true},
+			{models.PermissionRemoveComment, "music", true},
+			{models.PermissionLockPost, "news", true},
+			{models.PermissionBanUser, "", true},
+			{models.PermissionManageRoles, "", false},
+		}},
+		{name: "moderator of a category", grants: []models.RoleGrant{{Role: models.RoleModerator, Category: "music"}},
+			checks: categoryOnly("music", "news")},
+		{name: "moderator of two categories", grants: []models.RoleGrant{
+			{Role: models.RoleModerator, Category: "music"},
+			{Role: models.RoleModerator, Category: "news"},
+		}, checks: append(categoryOnly("music", "funny"), categoryOnly("news", "videos")...)},
+		{name: "admin", grants: []models.RoleGrant{{Role: models.RoleAdmin}}, checks: []check{
+			{models.PermissionDeletePost, "music", true},
+			{models.PermissionRemoveComment, "news", true},
+			{models.PermissionLockPost, "music", true},
+			{models.PermissionBanUser, "", true},
+			{models.PermissionManageRoles, "", true},
+		}},
+		{name: "unknown role", grants: []models.RoleGrant{{Role: "owner"}}, checks: []check{
+			{models.PermissionDeletePost, "music", false},
+			{models.PermissionManageRoles, "", false},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roles := repository.NewMemoryRoleRepository()
+			for _, grant := range test.grants {
+				grant.UserID = "user"
+				if err := roles.Grant(&grant); err != nil {
+					t.Fatal(err)
+				}
+			}
+			moderator := RoleModerator{Roles: roles}
+			user := &models.User{ID: "user"}
+			for _, check := range test.checks {
+				if got := moderator.HasPermission(user, check.permission, check.category); got != check.want {
+					t.Errorf("HasPermission %s in %q: %t, want %t", check.permission, check.category, got, check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRoleModeratorCanBanUser(t *testing.T) {
+	roles := repository.NewMemoryRoleRepository()
+	for _, grant := range []models.RoleGrant{
+		{UserID: "admin", Role: models.RoleAdmin},
+		{UserID: "moderator", Role: models.RoleModerator},
+		{UserID: "music", Role: models.RoleModerator, Category: "music"},
+	} {
+		if err := roles.Grant(&grant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	moderator := RoleModerator{Roles: roles}
+	user := func(id string) *models.User { return &models.User{ID: id} }
+
+	tests := []struct {
+		user, target string
+		want         bool
+	}{
+		{"admin", "user", true},
+		{"admin", "moderator", true},
+		{"moderator", "user", true},
+		{"moderator", "admin", false},
+		{"music", "user", false},
+		{"user", "user", false},
+	}
+	for _, test := range tests {
+		if got := moderator.CanBanUser(user(test.user), user(test.target)); got != test.want {
+			t.Errorf("CanBanUser %s of %s: %t, want %t", test.user, test.target, got, test.want)
+		}
+	}
+}
+
+// The method of granting the role to the registered user directly in the repository, as the bootstrap of the config does
+func (ts *testServer) grantRole(username, role, category string) {
+	ts.t.Helper()
+	user, err := ts.MemServ.UserRepo.GetByUsername(username)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if err := ts.MemServ.RoleRepo.Grant(&models.RoleGrant{UserID: user.ID, Role: role, Category: category, Created: time.Now()}); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func TestManageRolesPermissions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin := ts.register("alice")
+	ts.grantRole("alice", models.RoleAdmin, "")
+	bob := ts.register("bob")
+	ts.register("carol")
+	path := "/api/user/carol/roles/moderator"
+
+	ts.expect(http.StatusUnauthorized, "PUT", path, "", nil)
+	ts.expect(http.StatusForbidden, "PUT", path, bob, nil)
+	ts.expect(http.StatusForbidden, "GET", "/api/roles", bob, nil)
+	ts.expect(http.StatusOK, "PUT", path, admin, nil)
+	ts.expect(http.StatusOK, "PUT", path+"?category=music", admin, nil)
+
+	// A moderator does not manage the roles, not even its own
+	carol := ts.request("POST", "/api/login", "", Credentials{Username: "carol", Password: testPassword})
+	var tokens TokenResponse
+	decodeResponse(t, carol, &tokens)
+	ts.expect(http.StatusForbidden, "PUT", "/api/user/bob/roles/moderator", tokens.Token, nil)
+	ts.expect(http.StatusForbidden, "DELETE", path, tokens.Token, nil)
+
+	var roles []RoleResponse
+	decodeResponse(t, ts.expect(http.StatusOK, "GET", "/api/roles", admin, nil), &roles)
+	if len(roles) != 3 {
+		t.Fatalf("roles %+v, want the admin and two roles of carol", roles)
+	}
+
+	ts.expect(http.StatusForbidden, "DELETE", path, bob, nil)
+	ts.expect(http.StatusOK, "DELETE", path, admin, nil)
+	ts.expect(http.StatusNotFound, "DELETE", path, admin, nil)
+	ts.expect(http.StatusConflict, "DELETE", "/api/user/alice/roles/admin", admin, nil)
+}
+
+func TestModerationPermissions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.register("alice")
+	bob := ts.register("bob")
+	siteModerator := ts.register("sitemod")
+	ts.grantRole("sitemod", models.RoleModerator, "")
+	musicModerator := ts.register("musicmod")
+	ts.grantRole("musicmod", models.RoleModerator, "music")
+	admin := ts.register("admin_user")
+	ts.grantRole("admin_user", models.RoleAdmin, "")
+
+	music := ts.createPost(alice, "music")
+	news := ts.createPost(alice, "news")
+	lock := func(post models.Post) string { return "/api/post/" + post.ID + "/lock" }
+
+	// Locking posts
+	ts.expect(http.StatusUnauthorized, "PUT", lock(music), "", LockData{Locked: true})
+	ts.expect(http.StatusForbidden, "PUT", lock(music), bob, LockData{Locked: true})
+	// The authors may not lock their own posts
+	ts.expect(http.StatusForbidden, "PUT", lock(music), alice, LockData{Locked: true})
+	ts.expect(http.StatusForbidden, "PUT", lock(news), musicModerator, LockData{Locked: true})
+	ts.expect(http.StatusOK, "PUT", lock(music), musicModerator, LockData{Locked: true})
+	ts.expect(http.StatusForbidden, "POST", "/api/post/"+music.ID, bob, CommentData{Comment: "comment"})
+	ts.expect(http.StatusOK, "PUT", lock(music), siteModerator, LockData{Locked: false})
+	ts.addComment(bob, music.ID)
+
+	// A personal access token locks only with the moderate scope
+	ts.expect(http.StatusForbidden, "PUT", lock(news), ts.createAccessToken(siteModerator, "post"), LockData{Locked: true})
+	ts.expect(http.StatusOK, "PUT", lock(news), ts.createAccessToken(siteModerator, "moderate"), LockData{Locked: true})
+	ts.expect(http.StatusOK, "PUT", lock(news), admin, LockData{Locked: false})
+
+	// Deleting the posts and the comments of others
+	bobMusic := ts.createPost(bob, "music")
+	bobNews := ts.createPost(bob, "news")
+	comment := ts.addComment(bob, news.ID)
+	commentPath := "/api/post/" + news.ID + "/" + comment.ID
+
+	ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+bobMusic.ID, alice, nil)
+	ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+bobNews.ID, musicModerator, nil)
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+bobMusic.ID, musicModerator, nil)
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+bobNews.ID, siteModerator, nil)
+
+	ts.expect(http.StatusForbidden, "DELETE", commentPath, alice, nil)
+	ts.expect(http.StatusForbidden, "DELETE", commentPath, musicModerator, nil)
+	ts.expect(http.StatusOK, "DELETE", commentPath, admin, nil)
+
+	// Banning users
+	ban := func(username string) string { return "/api/user/" + username + "/ban" }
+	ts.expect(http.StatusForbidden, "PUT", ban("alice"), bob, BanData{Banned: true})
+	ts.expect(http.StatusForbidden, "PUT", ban("bob"), musicModerator, BanData{Banned: true})
+	ts.expect(http.StatusForbidden, "PUT", ban("sitemod"), siteModerator, BanData{Banned: true})
+	ts.expect(http.StatusForbidden, "PUT", ban("admin_user"), siteModerator, BanData{Banned: true})
+	ts.expect(http.StatusNotFound, "PUT", ban("nobody"), siteModerator, BanData{Banned: true})
+
+	ts.expect(http.StatusOK, "PUT", ban("bob"), siteModerator, BanData{Banned: true})
+	ts.expect(http.StatusForbidden, "GET", "/api/sessions", bob, nil)
+	ts.expect(http.StatusForbidden, "POST", "/api/login", "", Credentials{Username: "bob", Password: testPassword})
+
+	ts.expect(http.StatusOK, "PUT", ban("bob"), admin, BanData{Banned: false})
+	// The ban has logged bob out, the old token does not come back with the unban
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", bob, nil)
+	ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "bob", Password: testPassword})
+}
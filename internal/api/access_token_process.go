@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Settings of the personal access tokens
+const (
+	accessTokenPrefix        = "rcp_" // tells the personal access tokens apart from the JWTs in the Authorization header
+	accessTokenSize          = 32
+	accessTokenMaxNameLength = 64
+	accessTokenMaxPerUser    = 50
+	defaultAccessTokenDays   = 30
+	maxAccessTokenDays       = 365
+	accessTokenSweepInterval = 10 * time.Minute
+)
+
+// Errors related to the personal access tokens
+var (
+	ErrAccessTokenInvalid   = errors.New("access token is invalid, expired or revoked")
+	ErrAccessTokenScope     = errors.New("access token has no scope for this request")
+	ErrAccessTokenForbidden = errors.New("personal access tokens cannot be used for this request")
+	ErrTooManyAccessTokens  = errors.New("too many access tokens, revoke some first")
+)
+
+// AccessTokenResponse - a new personal access token, its value is shown only once
+type AccessTokenResponse struct {
+	models.AccessToken
+	Token string `json:"token"`
+}
+
+// The function of generating a new personal access token and its hash
+func generateAccessToken() (token, hash string, err error) {
+	bytes := make([]byte, accessTokenSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token = accessTokenPrefix + base64.RawURLEncoding.EncodeToString(bytes)
+	return token, hashAccessToken(token), nil
+}
+
+// The function of hashing a personal access token, only the hashes are stored
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// The function of checking that the value of the Authorization header is a personal access token and not a JWT
+func isAccessToken(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+// The function of validating the request of a new token, returns the problems of its fields
+func validateAccessTokenData(data *AccessTokenData) []FieldError {
+	var problems []FieldError
+	data.Name = strings.TrimSpace(data.Name)
+	switch {
+	case data.Name == "":
+		problems = append(problems, bodyFieldError("name", data.Name, "is required"))
+	case len([]rune(data.Name)) > accessTokenMaxNameLength:
+		problems = append(problems, bodyFieldError("name", data.Name, "is too long"))
+	}
+
+	if len(data.Scopes) == 0 {
+		problems = append(problems, bodyFieldError("scopes", "", "is required"))
+	}
+	for _, scope := range data.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			problems = append(problems, bodyFieldError("scopes", scope, "must be one of "+strings.Join(models.Scopes, ", ")))
+		}
+	}
+	slices.Sort(data.Scopes)
+	data.Scopes = slices.Compact(data.Scopes)
+
+	if data.ExpiresInDays == 0 {
+		data.ExpiresInDays = defaultAccessTokenDays
+	}
+	if data.ExpiresInDays < 0 || data.ExpiresInDays > maxAccessTokenDays {
+		problems = append(problems, bodyFieldError("expiresInDays", "", fmt.Sprintf("must be between 1 and %d", maxAccessTokenDays)))
+	}
+	return problems
+}
+
+// The method of creating a personal access token of the user, returns ErrTooManyAccessTokens when the user has too many live tokens
+func (server *Server) createAccessToken(user *models.User, data AccessTokenData, now time.Time) (*AccessTokenResponse, error) {
+	tokens, err := server.MemServ.AccessRepo.GetByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	live := 0
+	for _, token := range tokens {
+		if now.Before(token.Expires) {
+			live++
+		}
+	}
+	if live >= accessTokenMaxPerUser {
+		return nil, ErrTooManyAccessTokens
+	}
+
+	tokenID, err := GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	value, hash, err := generateAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	token := models.AccessToken{
+		ID:      tokenID,
+		UserID:  user.ID,
+		Name:    data.Name,
+		Hash:    hash,
+		Scopes:  data.Scopes,
+		Created: now,
+		Expires: now.AddDate(0, 0, data.ExpiresInDays),
+	}
+	if err := server.MemServ.AccessRepo.Create(&token); err != nil {
+		return nil, err
+	}
+	return &AccessTokenResponse{AccessToken: token, Token: value}, nil
+}
+
+// The method of authenticating a request with a personal access token: returns the token and its user,
+// or ErrAccessTokenInvalid if the token is unknown, expired or its user no longer exists
+func (server *Server) authenticateAccessToken(value string, now time.Time) (*models.AccessToken, *models.User, error) {
+	token, err := server.MemServ.AccessRepo.GetByHash(hashAccessToken(value))
+	if errors.Is(err, repository.ErrAccessTokenNotFound) {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !now.Before(token.Expires) {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+	user, err := server.MemServ.UserRepo.GetByID(token.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, user, nil
+}
+
+// The method of recording that the token was used now, the storage is only written once per lastSeenResolution
+func (server *Server) touchAccessToken(token *models.AccessToken, now time.Time) {
+	if token.LastUsed != nil && now.Sub(*token.LastUsed) < lastSeenResolution {
+		return
+	}
+	if err := server.MemServ.AccessRepo.Touch(token.ID, now); err != nil {
+		log.Printf("touchAccessToken AccessRepo Touch err: %s", err)
+		return
+	}
+	token.LastUsed = &now
+}
+
+// The function of getting the personal access token the request was authenticated with, ok is false for a request with a session
+func AccessTokenFromContext(ctx context.Context) (token *models.AccessToken, ok bool) {
+	token, ok = ctx.Value(accessTokenContextKey).(*models.AccessToken)
+	return token, ok && token != nil
+}
+
+// The function of checking that the request may act with the scope: requests with a session may do anything,
+// requests with a personal access token only what its scopes allow
+func scopeAllowed(ctx context.Context, scope string) bool {
+	token, ok := AccessTokenFromContext(ctx)
+	return !ok || token.HasScope(scope)
+}
+
+// The function of periodically deleting the expired personal access tokens, it is meant to be run in its own goroutine
+func sweepAccessTokens(tokens repository.AccessTokenRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		deleted, err := tokens.DeleteExpired(now)
+		if err != nil {
+			log.Printf("sweepAccessTokens AccessRepo DeleteExpired err: %s", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("sweepAccessTokens deleted %d expired access tokens", deleted)
+		}
+	}
+}
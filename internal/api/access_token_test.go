@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The method of creating a personal access token with the scopes for the user of the session token, returns its value
+func (ts *testServer) createAccessToken(token string, scopes ...string) string {
+	ts.t.Helper()
+	response := ts.expect(http.StatusCreated, "POST", "/api/tokens", token, AccessTokenData{Name: "bot", Scopes: scopes})
+	var created AccessTokenResponse
+	decodeResponse(ts.t, response, &created)
+	return created.Token
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.register("alice")
+	reader := ts.createAccessToken(session, "read")
+	writer := ts.createAccessToken(session, "post")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		token  string
+		status int
+	}{
+		{name: "read lists the sessions", method: "GET", path: "/api/sessions", token: reader, status: http.StatusOK},
+		{name: "read lists the tokens", method: "GET", path: "/api/tokens", token: reader, status: http.StatusOK},
+		{name: "post does not list the sessions", method: "GET", path: "/api/sessions", token: writer, status: http.StatusForbidden},
+		{name: "post does not list the tokens", method: "GET", path: "/api/tokens", token: writer, status: http.StatusForbidden},
+		{name: "read does not add posts", method: "POST", path: "/api/posts", token: reader, status: http.StatusForbidden,
+			body: PostData{Category: "music", Type: "text", Title: "title", Text: "text"}},
+		{name: "post adds posts", method: "POST", path: "/api/posts", token: writer, status: http.StatusCreated,
+			body: PostData{Category: "music", Type: "text", Title: "title", Text: "text"}},
+		{name: "read does not create tokens", method: "POST", path: "/api/tokens", token: reader, status: http.StatusForbidden,
+			body: AccessTokenData{Name: "other", Scopes: []string{"read"}}},
+		{name: "read does not log out", method: "POST", path: "/api/logout/all", token: reader, status: http.StatusForbidden},
+		{name: "unknown token", method: "GET", path: "/api/tokens", token: "rcp_unknown", status: http.StatusUnauthorized},
+		{name: "session lists the tokens", method: "GET", path: "/api/tokens", token: session, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts.expect(test.status, test.method, test.path, test.token, test.body)
+		})
+	}
+}
+
+func TestAccessTokenDeleteScopes(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.register("alice")
+	moderator := ts.register("sitemod")
+	ts.grantRole("sitemod", models.RoleModerator, "")
+	moderate := ts.createAccessToken(moderator, "moderate")
+	post := ts.createAccessToken(moderator, "post")
+	vote := ts.createAccessToken(moderator, "vote")
+
+	// A token with neither the post nor the moderate scope deletes nothing
+	first := ts.createPost(alice, "music")
+	ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+first.ID, vote, nil)
+
+	// The post scope deletes only the own content, the moderate scope the content of others
+	comment := ts.addComment(alice, first.ID)
+	ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+first.ID+"/"+comment.ID, post, nil)
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+first.ID+"/"+comment.ID, moderate, nil)
+	ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+first.ID, post, nil)
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+first.ID, moderate, nil)
+
+	own := ts.createPost(moderator, "music")
+	ownComment := ts.addComment(moderator, own.ID)
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+own.ID+"/"+ownComment.ID, post, nil)
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+own.ID, post, nil)
+}
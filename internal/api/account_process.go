@@ -0,0 +1,357 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/mail"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Names of the mail drivers that can be specified in the "mail" section of the config
+const (
+	MailLog  = "log"
+	MailFile = "file"
+	MailSMTP = "smtp"
+)
+
+// Default settings of the mail
+const (
+	defaultMailFrom    = "redditclone <noreply@localhost>"
+	defaultMailBaseURL = "http://localhost:3000"
+)
+
+// Lifetimes of the single-use tokens sent by email
+const (
+	passwordResetLifetime     = time.Hour
+	emailVerificationLifetime = 24 * time.Hour
+)
+
+// How often the expired tokens sent by email are deleted
+const userTokenSweepInterval = 10 * time.Minute
+
+// Size of a token sent by email in bytes before encoding
+const emailTokenSize = 32
+
+// The longest email address, the limit of the SMTP path
+const maxEmailLength = 254
+
+// The message of every request of a password reset, it does not tell whether an account has the email
+const passwordResetRequestedMessage = "if an account has this verified email, a reset link was sent to it"
+
+// Errors related to the mail and to the accounts
+var (
+	ErrUnknownMailDriver    = errors.New("unknown mail driver")
+	ErrEmptyMailAddr        = errors.New("mail addr is empty")
+	ErrEmptyMailPath        = errors.New("mail path is empty")
+	ErrResetTokenInvalid    = errors.New("reset token is invalid or expired")
+	ErrVerifyTokenInvalid   = errors.New("verification token is invalid or expired")
+	ErrEmailAlreadyVerified = errors.New("email is already verified by another account")
+	ErrNoEmail              = errors.New("account has no email")
+	ErrEmailVerified        = errors.New("email is already verified")
+	ErrEmailNotVerified     = errors.New("email is not verified")
+)
+
+// Structure of the "mail" section of the config, an empty driver means writing the emails to the log
+type MailConfig struct {
+	Driver   string `json:"driver"`
+	Addr     string `json:"addr"`     // host:port of the SMTP server
+	From     string `json:"from"`     // the sender of the emails
+	Username string `json:"username"` // SMTP username, no authentication if empty
+	Password string `json:"password"` // SMTP password
+	Path     string `json:"path"`     // directory of the .eml files of the file driver
+	BaseURL  string `json:"baseURL"`  // address of the frontend the links in the emails lead to
+}
+
+// Structure of the "emailVerification" section of the config
+type EmailVerificationConfig struct {
+	RequireEmail       bool `json:"requireEmail"`       // the registration must have an email
+	RestrictUnverified bool `json:"restrictUnverified"` // the accounts without a verified email can not add posts and comments
+}
+
+// The function of creating the mailer of the driver selected in the config
+func newMailer(config MailConfig) (mail.Mailer, error) {
+	from := config.From
+	if from == "" {
+		from = defaultMailFrom
+	}
+	switch config.Driver {
+	case "", MailLog:
+		return mail.LogMailer{From: from}, nil
+	case MailFile:
+		if config.Path == "" {
+			return nil, ErrEmptyMailPath
+		}
+		return mail.NewFileMailer(config.Path, from)
+	case MailSMTP:
+		if config.Addr == "" {
+			return nil, ErrEmptyMailAddr
+		}
+		return mail.NewSMTPMailer(config.Addr, from, config.Username, config.Password), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMailDriver, config.Driver)
+	}
+}
+
+// The function of checking an email address, returns it in lower case or the description of the problem.
+// Only a bare address is accepted, without a display name
+func normalizeEmail(email string) (string, string) {
+	switch {
+	case email == "":
+		return "", "is required"
+	case len(email) > maxEmailLength:
+		return "", fmt.Sprintf("must be at most %d characters long", maxEmailLength)
+	}
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", "is not a valid email address"
+	}
+	return strings.ToLower(email), ""
+}
+
+// The function of generating a token sent by email together with the hash under which it is stored
+func generateEmailToken() (token, hash string, err error) {
+	bytes := make([]byte, emailTokenSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(bytes)
+	return token, hashEmailToken(token), nil
+}
+
+// The function of hashing a token sent by email, only the hashes are stored
+func hashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// The method of building the link of the frontend page that takes the token
+func (server *Server) emailLink(page, token string) string {
+	return server.MailBaseURL + "/" + page + "?token=" + url.QueryEscape(token)
+}
+
+// The function of writing the lifetime of a token for the text of an email, in whole hours when it is a number of hours
+func formatLifetime(lifetime time.Duration) string {
+	switch {
+	case lifetime == time.Hour:
+		return "1 hour"
+	case lifetime%time.Hour == 0:
+		return fmt.Sprintf("%d hours", lifetime/time.Hour)
+	}
+	return lifetime.String()
+}
+
+// The method of sending the email in the background, so that the response does not wait for the mail server
+// and its time does not reveal whether the email was sent. Errors are only logged
+func (server *Server) sendMail(message mail.Message) {
+	go func() {
+		if err := server.Mailer.Send(message); err != nil {
+			log.Printf("sendMail Mailer Send err: %s", err)
+		}
+	}()
+}
+
+// The method of issuing a new token of the purpose to the user, the earlier tokens of the purpose stop working
+func (server *Server) issueEmailToken(user *models.User, purpose string, lifetime time.Duration, now time.Time) (string, error) {
+	if err := server.MemServ.TokenRepo.DeleteByUserID(user.ID, purpose); err != nil {
+		return "", err
+	}
+	token, hash, err := generateEmailToken()
+	if err != nil {
+		return "", err
+	}
+	userToken := &models.UserToken{
+		Hash:    hash,
+		UserID:  user.ID,
+		Purpose: purpose,
+		Email:   user.Email,
+		Expires: now.Add(lifetime),
+	}
+	if err := server.MemServ.TokenRepo.Create(userToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// The method of changing the password of the user and revoking all sessions but the current one,
+// so that whoever knew the old password is logged out
+func (server *Server) changePassword(user *models.User, currentSessionID, newPassword string) error {
+	if err := server.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	sessions, err := server.MemServ.SessionRepo.GetByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := server.MemServ.SessionRepo.Delete(session.ID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// The method of storing the new password of the user, the pending password resets stop working
+func (server *Server) setPassword(user *models.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	if err := server.MemServ.UserRepo.Update(user); err != nil {
+		return err
+	}
+	return server.MemServ.TokenRepo.DeleteByUserID(user.ID, models.TokenPurposePasswordReset)
+}
+
+// The method of setting a new email of the user, it stays unverified until the link sent to it is followed
+func (server *Server) changeEmail(user *models.User, email string, now time.Time) error {
+	user.Email = email
+	user.EmailVerified = false
+	if err := server.MemServ.UserRepo.Update(user); err != nil {
+		return err
+	}
+	return server.sendVerification(user, now)
+}
+
+// The method of sending a link verifying the email of the user, the earlier links stop working.
+// Returns ErrNoEmail if the user has no email and ErrEmailVerified if it is already verified
+func (server *Server) sendVerification(user *models.User, now time.Time) error {
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+	if user.EmailVerified {
+		return ErrEmailVerified
+	}
+	token, err := server.issueEmailToken(user, models.TokenPurposeEmailVerification, emailVerificationLifetime, now)
+	if err != nil {
+		return err
+	}
+	server.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nfollow the link to verify your email:\n%s\n\nor enter this token: %s\n\n"+
+			"The link is valid for %s. If you did not ask for it, ignore this email.\n",
+			user.Username, server.emailLink("verify-email", token), token, formatLifetime(emailVerificationLifetime)),
+	})
+	return nil
+}
+
+// The method of verifying the email of a user with the token sent to it. Returns ErrVerifyTokenInvalid for an unknown or expired token
+// or if the user has changed the email since, and ErrEmailAlreadyVerified if another account has verified the email first
+func (server *Server) verifyEmail(token string, now time.Time) error {
+	userToken, err := server.MemServ.TokenRepo.Consume(hashEmailToken(token), models.TokenPurposeEmailVerification, now)
+	if errors.Is(err, repository.ErrUserTokenNotFound) {
+		return ErrVerifyTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	user, err := server.MemServ.UserRepo.GetByID(userToken.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrVerifyTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email != userToken.Email {
+		return ErrVerifyTokenInvalid
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	// The password reset finds the account by the verified email, so the storage lets only one account verify it
+	user.EmailVerified = true
+	err = server.MemServ.UserRepo.Update(user)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return ErrEmailAlreadyVerified
+	}
+	return err
+}
+
+// The method of sending a password reset link to the account with the verified email, nothing is sent if there is no such account
+func (server *Server) requestPasswordReset(email string, now time.Time) error {
+	user, err := server.MemServ.UserRepo.GetByEmail(email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, err := server.issueEmailToken(user, models.TokenPurposePasswordReset, passwordResetLifetime, now)
+	if err != nil {
+		return err
+	}
+	server.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nfollow the link to set a new password:\n%s\n\nor enter this token: %s\n\n"+
+			"The link is valid for %s and can be used once. If you did not ask for it, ignore this email.\n",
+			user.Username, server.emailLink("reset-password", token), token, formatLifetime(passwordResetLifetime)),
+	})
+	return nil
+}
+
+// The method of setting a new password with the token of a password reset: every session and personal access token of the user
+// is revoked and the failed logins of the account are forgotten. Returns ErrResetTokenInvalid for an unknown, used or expired token
+func (server *Server) resetPassword(token, newPassword string, now time.Time) error {
+	userToken, err := server.MemServ.TokenRepo.Consume(hashEmailToken(token), models.TokenPurposePasswordReset, now)
+	if errors.Is(err, repository.ErrUserTokenNotFound) {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	user, err := server.MemServ.UserRepo.GetByID(userToken.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	// The link was sent to the email the account had then, it stops working once the email is changed
+	if user.Email != userToken.Email || !user.EmailVerified {
+		return ErrResetTokenInvalid
+	}
+	if err := server.setPassword(user, newPassword); err != nil {
+		return err
+	}
+	if err := server.MemServ.SessionRepo.DeleteByUserID(user.ID); err != nil {
+		return err
+	}
+	// Whoever took over the account may have made personal access tokens too
+	if err := server.MemServ.AccessRepo.DeleteByUserID(user.ID); err != nil {
+		return err
+	}
+	return server.Throttle.Forget(user.Username)
+}
+
+// The function of periodically deleting the expired tokens sent by email, it is meant to be run in its own goroutine
+func sweepUserTokens(tokens repository.UserTokenRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		deleted, err := tokens.DeleteExpired(now)
+		if err != nil {
+			log.Printf("sweepUserTokens TokenRepo DeleteExpired err: %s", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("sweepUserTokens deleted %d expired tokens", deleted)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The method of registering the user with the email and verifying it, returns the access token of the registration
+func (ts *testServer) registerVerified(username, email string) string {
+	ts.t.Helper()
+	response := ts.expect(http.StatusCreated, "POST", "/api/register", "",
+		Credentials{Username: username, Password: testPassword, Email: email})
+	var tokens TokenResponse
+	decodeResponse(ts.t, response, &tokens)
+	_, token := ts.linkToken("verify-email")
+	ts.expect(http.StatusOK, "POST", "/api/user/email/verify", "", TokenData{Token: token})
+	return tokens.Token
+}
+
+// The method of requesting a password reset for the email, returns the token of the link sent to it
+func (ts *testServer) forgotPassword(email string) string {
+	ts.t.Helper()
+	ts.expect(http.StatusOK, "POST", "/api/password/forgot", "", EmailData{Email: email})
+	message, token := ts.linkToken("reset-password")
+	if !strings.EqualFold(message.To, email) {
+		ts.t.Fatalf("the reset link is sent to %q, want %q", message.To, email)
+	}
+	return token
+}
+
+func TestPasswordReset(t *testing.T) {
+	ts := newTestServer(t, nil)
+	session := ts.registerVerified("alice", "alice@example.com")
+
+	// The unknown emails get the same answer, the request is validated
+	ts.expect(http.StatusOK, "POST", "/api/password/forgot", "", EmailData{Email: "nobody@example.com"})
+	ts.expect(http.StatusUnprocessableEntity, "POST", "/api/password/forgot", "", EmailData{Email: "not an email"})
+
+	first := ts.forgotPassword("alice@example.com")
+	second := ts.forgotPassword("ALICE@example.com")
+	ts.expect(http.StatusUnprocessableEntity, "POST", "/api/password/reset", "", PasswordResetData{Token: second, NewPassword: "short"})
+	ts.expect(http.StatusUnauthorized, "POST", "/api/password/reset", "", PasswordResetData{Token: second + "x", NewPassword: "pw-new-1234"})
+	ts.expect(http.StatusOK, "POST", "/api/password/reset", "", PasswordResetData{Token: second, NewPassword: "pw-new-1234"})
+
+	// The token is single-use, the earlier tokens die with the password change, the sessions are revoked
+	ts.expect(http.StatusUnauthorized, "POST", "/api/password/reset", "", PasswordResetData{Token: second, NewPassword: "pw-other-5678"})
+	ts.expect(http.StatusUnauthorized, "POST", "/api/password/reset", "", PasswordResetData{Token: first, NewPassword: "pw-other-5678"})
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", session, nil)
+	ts.expect(http.StatusUnauthorized, "POST", "/api/login", "", Credentials{Username: "alice", Password: testPassword})
+	ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "alice", Password: "pw-new-1234"})
+}
+
+func TestChangePassword(t *testing.T) {
+	ts := newTestServer(t, nil)
+	current := ts.registerVerified("alice", "alice@example.com")
+	other := ts.login("alice")
+	reset := ts.forgotPassword("alice@example.com")
+
+	ts.expect(http.StatusUnprocessableEntity, "PUT", "/api/user/password", current,
+		PasswordChangeData{CurrentPassword: "wrong-password", NewPassword: "pw-new-1234"})
+	ts.expect(http.StatusUnprocessableEntity, "PUT", "/api/user/password", current,
+		PasswordChangeData{CurrentPassword: testPassword, NewPassword: "short"})
+	ts.expect(http.StatusOK, "PUT", "/api/user/password", current,
+		PasswordChangeData{CurrentPassword: testPassword, NewPassword: "pw-new-1234"})
+
+	// The session of the change stays, the other sessions and the pending reset die
+	ts.expect(http.StatusOK, "GET", "/api/sessions", current, nil)
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", other.Token, nil)
+	ts.expect(http.StatusUnauthorized, "POST", "/api/password/reset", "", PasswordResetData{Token: reset, NewPassword: "pw-other-5678"})
+	ts.expect(http.StatusUnauthorized, "POST", "/api/login", "", Credentials{Username: "alice", Password: testPassword})
+	ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "alice", Password: "pw-new-1234"})
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Default rules of the usernames and the passwords
+const (
+	defaultUsernameMinLength = 3
+	defaultUsernameMaxLength = 32
+	defaultUsernamePattern   = `^[A-Za-z0-9_-]+$`
+	defaultPasswordMinLength = 8
+)
+
+// The longest password in bytes, bcrypt can not hash longer ones
+const maxPasswordBytes = 72
+
+// The usernames that can not be registered unless the config sets its own list
+var defaultReservedUsernames = []string{"admin", "administrator", "root", "moderator", "system", "support", "api", "null", "undefined"}
+
+// Errors related to the config of the credential policy
+var (
+	ErrInvalidLengthRule = errors.New("minLength must be positive and not greater than maxLength")
+	ErrPasswordMinLength = errors.New("password minLength can not exceed 72 bytes")
+)
+
+// Structure of the "credentials" section of the config, empty values mean the defaults
+type CredentialConfig struct {
+	Username UsernameConfig `json:"username"`
+	Password PasswordConfig `json:"password"`
+}
+
+// Structure of the rules of the usernames in the config
+type UsernameConfig struct {
+	MinLength int      `json:"minLength"`
+	MaxLength int      `json:"maxLength"`
+	Pattern   string   `json:"pattern"`  // regular expression the whole username must match
+	Reserved  []string `json:"reserved"` // names that can not be registered, compared ignoring the case
+}
+
+// Structure of the rules of the passwords in the config
+type PasswordConfig struct {
+	MinLength     int    `json:"minLength"`
+	BlocklistFile string `json:"blocklistFile"` // file of breached passwords, one per line, relative to the working directory
+}
+
+// CredentialPolicy - the rules the usernames and the passwords of the new users must follow
+type CredentialPolicy struct {
+	usernameMinLength int
+	usernameMaxLength int
+	usernamePattern   *regexp.Regexp
+	reserved          map[string]struct{}
+	passwordMinLength int
+	blocklist         map[string]struct{}
+}
+
+// CredentialPolicy constructor, reads the rules from the config and loads the blocklist of the passwords
+func NewCredentialPolicy(config CredentialConfig) (*CredentialPolicy, error) {
+	policy := &CredentialPolicy{
+		usernameMinLength: valueOr(config.Username.MinLength, defaultUsernameMinLength),
+		usernameMaxLength: valueOr(config.Username.MaxLength, defaultUsernameMaxLength),
+		passwordMinLength: valueOr(config.Password.MinLength, defaultPasswordMinLength),
+		reserved:          make(map[string]struct{}),
+		blocklist:         make(map[string]struct{}),
+	}
+	if policy.usernameMinLength < 1 || policy.usernameMinLength > policy.usernameMaxLength {
+		return nil, fmt.Errorf("username: %w", ErrInvalidLengthRule)
+	}
+	if policy.passwordMinLength < 1 {
+		return nil, fmt.Errorf("password: %w", ErrInvalidLengthRule)
+	}
+	if policy.passwordMinLength > maxPasswordBytes {
+		return nil, ErrPasswordMinLength
+	}
+
+	pattern := config.Username.Pattern
+	if pattern == "" {
+		pattern = defaultUsernamePattern
+	}
+	var err error
+	if policy.usernamePattern, err = regexp.Compile(pattern); err != nil {
+		return nil, fmt.Errorf("username pattern: %w", err)
+	}
+
+	reserved := config.Username.Reserved
+	if reserved == nil {
+		reserved = defaultReservedUsernames
+	}
+	for _, name := range reserved {
+		policy.reserved[strings.ToLower(name)] = struct{}{}
+	}
+
+	if config.Password.BlocklistFile != "" {
+		if err := policy.loadBlocklist(config.Password.BlocklistFile); err != nil {
+			return nil, fmt.Errorf("password blocklist: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+// The function of replacing an unset number of the config with the default
+func valueOr(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// The method of reading the file of breached passwords, empty lines and lines starting with # are skipped
+func (policy *CredentialPolicy) loadBlocklist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		policy.blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// The method of checking the credentials of a new user, returns the problems of every field, nil if there are none
+func (policy *CredentialPolicy) ValidateRegistration(creds Credentials) []FieldError {
+	var problems []FieldError
+	if msg := policy.checkUsername(creds.Username); msg != "" {
+		problems = append(problems, bodyFieldError("username", creds.Username, msg))
+	}
+	if msg := policy.checkPassword(creds.Password); msg != "" {
+		// The password is never echoed back
+		problems = append(problems, bodyFieldError("password", "", msg))
+	}
+	return problems
+}
+
+// The method of checking a new password of an existing user, param is the name of the field in the request body
+func (policy *CredentialPolicy) ValidatePassword(param, password string) []FieldError {
+	if msg := policy.checkPassword(password); msg != "" {
+		return []FieldError{bodyFieldError(param, "", msg)}
+	}
+	return nil
+}
+
+// The function of checking the credentials of a login, only their presence is checked, so that the users registered
+// under older rules can still log in
+func ValidateLogin(creds Credentials) []FieldError {
+	var problems []FieldError
+	if creds.Username == "" {
+		problems = append(problems, bodyFieldError("username", "", "is required"))
+	}
+	if creds.Password == "" {
+		problems = append(problems, bodyFieldError("password", "", "is required"))
+	}
+	return problems
+}
+
+// The method of deriving a username for an account created from an external identity: the first candidate that follows
+// the rules once the characters outside of the default pattern are removed, "user" if none does. A taken username gets a suffix
+// from the caller, so the name is cut to leave room for it
+func (policy *CredentialPolicy) suggestUsername(suffixLength int, candidates ...string) string {
+	for _, candidate := range candidates {
+		var builder strings.Builder
+		for _, r := range candidate {
+			if r < utf8.RuneSelf && (r == '_' || r == '-' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')) {
+				builder.WriteRune(r)
+			}
+		}
+		username := builder.String()
+		if maxLength := policy.usernameMaxLength - suffixLength; len(username) > maxLength && maxLength > 0 {
+			username = username[:maxLength]
+		}
+		if policy.checkUsername(username) == "" {
+			return username
+		}
+	}
+	return "user"
+}
+
+// The method of checking the username, returns the description of the problem or an empty string
+func (policy *CredentialPolicy) checkUsername(username string) string {
+	length := utf8.RuneCountInString(username)
+	switch {
+	case username == "":
+		return "is required"
+	case length < policy.usernameMinLength || length > policy.usernameMaxLength:
+		return fmt.Sprintf("must be from %d to %d characters long", policy.usernameMinLength, policy.usernameMaxLength)
+	case !policy.usernamePattern.MatchString(username):
+		return "contains characters that are not allowed"
+	}
+	if _, reserved := policy.reserved[strings.ToLower(username)]; reserved {
+		return "is reserved"
+	}
+	return ""
+}
+
+// The method of checking the password, returns the description of the problem or an empty string
+func (policy *CredentialPolicy) checkPassword(password string) string {
+	switch {
+	case password == "":
+		return "is required"
+	case utf8.RuneCountInString(password) < policy.passwordMinLength:
+		return fmt.Sprintf("must be at least %d characters long", policy.passwordMinLength)
+	case len(password) > maxPasswordBytes:
+		return fmt.Sprintf("must be at most %d bytes long", maxPasswordBytes)
+	}
+	if _, breached := policy.blocklist[strings.ToLower(password)]; breached {
+		return "is too common, it appears in known data breaches"
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The function of writing the blocklist of the passwords to a temporary file, returns its path
+func writeBlocklist(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewCredentialPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CredentialConfig
+		invalid bool
+		err     error // the error the rejection wraps, nil when any error will do
+	}{
+		{name: "defaults"},
+		{name: "username minLength above maxLength", config: CredentialConfig{Username: UsernameConfig{MinLength: 10, MaxLength: 5}}, invalid: true, err: ErrInvalidLengthRule},
+		{name: "negative username minLength", config: CredentialConfig{Username: UsernameConfig{MinLength: -1}}, invalid: true, err: ErrInvalidLengthRule},
+		{name: "negative password minLength", config: CredentialConfig{Password: PasswordConfig{MinLength: -1}}, invalid: true, err: ErrInvalidLengthRule},
+		{name: "password minLength over bcrypt", config: CredentialConfig{Password: PasswordConfig{MinLength: maxPasswordBytes + 1}}, invalid: true, err: ErrPasswordMinLength},
+		{name: "invalid pattern", config: CredentialConfig{Username: UsernameConfig{Pattern: "["}}, invalid: true},
+		{name: "missing blocklist", config: CredentialConfig{Password: PasswordConfig{BlocklistFile: filepath.Join(t.TempDir(), "missing")}}, invalid: true, err: os.ErrNotExist},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewCredentialPolicy(test.config)
+			switch {
+			case !test.invalid && err != nil:
+				t.Fatalf("valid config rejected: %s", err)
+			case test.invalid && err == nil:
+				t.Fatalf("invalid config accepted: %+v", policy)
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCheckUsername(t *testing.T) {
+	defaults, err := NewCredentialPolicy(CredentialConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := NewCredentialPolicy(CredentialConfig{Username: UsernameConfig{
+		MinLength: 2, MaxLength: 4, Pattern: `^[a-z]+$`, Reserved: []string{"Bot"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *CredentialPolicy
+		username string
+		msg      string
+	}{
+		{name: "valid", policy: defaults, username: "alice_01-x"},
+		{name: "empty", policy: defaults, username: "", msg: "is required"},
+		{name: "too short", policy: defaults, username: "al", msg: "must be from 3 to 32 characters long"},
+		{name: "shortest", policy: defaults, username: "ali"},
+		{name: "longest", policy: defaults, username: strings.Repeat("a", 32)},
+		{name: "too long", policy: defaults, username: strings.Repeat("a", 33), msg: "must be from 3 to 32 characters long"},
+		{name: "space", policy: defaults, username: "al ice", msg: "contains characters that are not allowed"},
+		{name: "not ascii", policy: defaults, username: "алиса", msg: "contains characters that are not allowed"},
+		{name: "punctuation", policy: defaults, username: "alice!", msg: "contains characters that are not allowed"},
+		{name: "reserved", policy: defaults, username: "admin", msg: "is reserved"},
+		{name: "reserved in another case", policy: defaults, username: "Root", msg: "is reserved"},
+		{name: "custom length", policy: custom, username: "alice", msg: "must be from 2 to 4 characters long"},
+		{name: "custom pattern", policy: custom, username: "Al", msg: "contains characters that are not allowed"},
+		{name: "custom reserved list", policy: custom, username: "bot", msg: "is reserved"},
+		{name: "default reserved name allowed by the custom list", policy: custom, username: "root"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if msg := test.policy.checkUsername(test.username); msg != test.msg {
+				t.Fatalf("checkUsername(%q) = %q, want %q", test.username, msg, test.msg)
+			}
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	policy, err := NewCredentialPolicy(CredentialConfig{Password: PasswordConfig{
+		BlocklistFile: writeBlocklist(t, "# breached passwords", "", "Password123", "  qwertyuiop  "),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		msg      string
+	}{
+		{name: "valid", password: "pw345678"},
+		{name: "empty", password: "", msg: "is required"},
+		{name: "too short", password: "pw34567", msg: "must be at least 8 characters long"},
+		{name: "characters are counted, not bytes", password: "пароль", msg: "must be at least 8 characters long"},
+		{name: "multibyte characters", password: "пароль12"},
+		{name: "longest", password: strings.Repeat("a", maxPasswordBytes)},
+		{name: "longer than bcrypt hashes", password: strings.Repeat("a", maxPasswordBytes+1), msg: "must be at most 72 bytes long"},
+		{name: "multibyte over the bytes limit", password: strings.Repeat("п", 37), msg: "must be at most 72 bytes long"},
+		{name: "blocklisted", password: "Password123", msg: "is too common, it appears in known data breaches"},
+		{name: "blocklisted in another case", password: "PASSWORD123", msg: "is too common, it appears in known data breaches"},
+		{name: "blocklisted line trimmed", password: "qwertyuiop", msg: "is too common, it appears in known data breaches"},
+		{name: "comment is not blocklisted", password: "# breached passwords"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if msg := policy.checkPassword(test.password); msg != test.msg {
+				t.Fatalf("checkPassword(%q) = %q, want %q", test.password, msg, test.msg)
+			}
+		})
+	}
+}
+
+func TestCredentialPolicyRejections(t *testing.T) {
+	ts := newTestServer(t, map[string]any{"credentials": map[string]any{
+		"password": map[string]any{"blocklistFile": writeBlocklist(t, "password123")},
+	}})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		errors []FieldError
+	}{
+		{name: "register with both fields wrong", method: "POST", path: "/api/register",
+			body: Credentials{Username: "admin", Password: "short"},
+			errors: []FieldError{
+				bodyFieldError("username", "admin", "is reserved"),
+				bodyFieldError("password", "", "must be at least 8 characters long"),
+			}},
+		{name: "register with a breached password", method: "POST", path: "/api/register",
+			body:   Credentials{Username: "alice", Password: "Password123"},
+			errors: []FieldError{bodyFieldError("password", "", "is too common, it appears in known data breaches")}},
+		{name: "register with a bad username", method: "POST", path: "/api/register",
+			body:   Credentials{Username: "a b", Password: testPassword},
+			errors: []FieldError{bodyFieldError("username", "a b", "contains characters that are not allowed")}},
+		{name: "change to a breached password", method: "PUT", path: "/api/user/password",
+			body:   PasswordChangeData{CurrentPassword: testPassword, NewPassword: "password123"},
+			errors: []FieldError{bodyFieldError("newPassword", "", "is too common, it appears in known data breaches")}},
+		{name: "change to a long password", method: "PUT", path: "/api/user/password",
+			body:   PasswordChangeData{CurrentPassword: testPassword, NewPassword: strings.Repeat("a", 73)},
+			errors: []FieldError{bodyFieldError("newPassword", "", "must be at most 72 bytes long")}},
+	}
+	token := ts.register("bob")
+	for _, test := range tests {
+		response := ts.expect(http.StatusUnprocessableEntity, test.method, test.path, token, test.body)
+		var body ErrorResponse
+		decodeResponse(t, response, &body)
+		if body.Message != "validation failed" || len(body.Errors) != len(test.errors) {
+			t.Fatalf("%s: response %+v, want the errors %+v", test.name, body, test.errors)
+		}
+		for index := range test.errors {
+			if body.Errors[index] != test.errors[index] {
+				t.Fatalf("%s: error %+v, want %+v", test.name, body.Errors[index], test.errors[index])
+			}
+		}
+	}
+}
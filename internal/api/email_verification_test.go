@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/mail"
+)
+
+// The method of waiting for the next email sent in the background and getting the token of the link to the page in it
+func (ts *testServer) linkToken(page string) (mail.Message, string) {
+	ts.t.Helper()
+	select {
+	case message := <-ts.mailer.Sent():
+		for _, field := range strings.Fields(message.Body) {
+			link, err := url.Parse(field)
+			if err == nil && strings.HasSuffix(link.Path, "/"+page) {
+				return message, link.Query().Get("token")
+			}
+		}
+		ts.t.Fatalf("no link to %s in the email %q", page, message.Body)
+	case <-time.After(5 * time.Second):
+		ts.t.Fatalf("no email with a link to %s was sent", page)
+	}
+	return mail.Message{}, ""
+}
+
+func TestRegistrationEmailVerification(t *testing.T) {
+	ts := newTestServer(t, map[string]any{"emailVerification": map[string]any{"restrictUnverified": true}})
+	response := ts.expect(http.StatusCreated, "POST", "/api/register", "",
+		Credentials{Username: "alice", Password: testPassword, Email: "alice@example.com"})
+	var tokens TokenResponse
+	decodeResponse(t, response, &tokens)
+
+	message, token := ts.linkToken("verify-email")
+	if message.To != "alice@example.com" {
+		t.Fatalf("the verification link is sent to %q", message.To)
+	}
+	if token == "" {
+		t.Fatal("the verification link has no token")
+	}
+
+	// Before the verification the restricted routes are refused, the others work
+	data := PostData{Category: "music", Type: "text", Title: "title", Text: "text"}
+	response = ts.expect(http.StatusForbidden, "POST", "/api/posts", tokens.Token, data)
+	if !strings.Contains(response.Body.String(), ErrEmailNotVerified.Error()) {
+		t.Fatalf("unexpected refusal %s", response.Body.String())
+	}
+	ts.expect(http.StatusOK, "GET", "/api/sessions", tokens.Token, nil)
+
+	ts.expect(http.StatusUnauthorized, "POST", "/api/user/email/verify", "", TokenData{Token: token + "x"})
+	ts.expect(http.StatusOK, "POST", "/api/user/email/verify", "", TokenData{Token: token})
+	post := ts.createPost(tokens.Token, "music")
+	ts.addComment(tokens.Token, post.ID)
+
+	// The token is single-use
+	ts.expect(http.StatusUnauthorized, "POST", "/api/user/email/verify", "", TokenData{Token: token})
+}
+
+func TestResentVerificationReplacesLink(t *testing.T) {
+	ts := newTestServer(t, nil)
+	response := ts.expect(http.StatusCreated, "POST", "/api/register", "",
+		Credentials{Username: "alice", Password: testPassword, Email: "alice@example.com"})
+	var tokens TokenResponse
+	decodeResponse(t, response, &tokens)
+	_, first := ts.linkToken("verify-email")
+
+	ts.expect(http.StatusOK, "POST", "/api/user/email/resend", tokens.Token, nil)
+	_, second := ts.linkToken("verify-email")
+	ts.expect(http.StatusUnauthorized, "POST", "/api/user/email/verify", "", TokenData{Token: first})
+	ts.expect(http.StatusOK, "POST", "/api/user/email/verify", "", TokenData{Token: second})
+	ts.expect(http.StatusConflict, "POST", "/api/user/email/resend", tokens.Token, nil)
+}
+
+func TestEmailVerifiedByOneAccount(t *testing.T) {
+	ts := newTestServer(t, nil)
+	tokens := make([]string, 2)
+	for index, username := range []string{"alice", "bob"} {
+		ts.expect(http.StatusCreated, "POST", "/api/register", "",
+			Credentials{Username: username, Password: testPassword, Email: "shared@example.com"})
+		_, tokens[index] = ts.linkToken("verify-email")
+	}
+
+	ts.expect(http.StatusOK, "POST", "/api/user/email/verify", "", TokenData{Token: tokens[1]})
+	ts.expect(http.StatusConflict, "POST", "/api/user/email/verify", "", TokenData{Token: tokens[0]})
+	owner, err := ts.MemServ.UserRepo.GetByEmail("shared@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Username != "bob" {
+		t.Fatalf("the email is verified by %s, want bob", owner.Username)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// FieldError - a problem with one field of the request, in the format the bundled frontend shows for 422 responses
+type FieldError struct {
+	Location string `json:"location"`
+	Param    string `json:"param"`
+	Value    string `json:"value"`
+	Msg      string `json:"msg"`
+}
+
+// ErrorResponse - the body of the error responses of the authentication handlers.
+// Message describes the error, Errors lists the problems of the fields when the request did not pass the validation
+type ErrorResponse struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// The function of describing a problem with a field of the request body
+func bodyFieldError(param, value, msg string) FieldError {
+	return FieldError{Location: "body", Param: param, Value: value, Msg: msg}
+}
+
+// The function of writing an error response with the status. handlerName is used in the log messages
+func writeError(w http.ResponseWriter, handlerName string, status int, message string, fieldErrors ...FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Message: message, Errors: fieldErrors}); err != nil {
+		log.Printf("%s Encode ErrorResponse err: %s", handlerName, err)
+	}
+}
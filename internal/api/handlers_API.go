@@ -6,17 +6,22 @@ import (
 
 	"encoding/json"
 	"log"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
 	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/oidc"
 	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
 )
 
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email"` // optional at the registration, ignored by the login
 }
 
 type PostData struct {
@@ -30,53 +35,97 @@ type CommentData struct {
 	Comment string `json:"comment"`
 }
 
+type RefreshData struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type PasswordChangeData struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type EmailChangeData struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type EmailData struct {
+	Email string `json:"email"`
+}
+
+type TokenData struct {
+	Token string `json:"token"`
+}
+
+// ExpiresInDays is 30 days when it is not set
+type AccessTokenData struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+type LockData struct {
+	Locked bool `json:"locked"`
+}
+
+type BanData struct {
+	Banned bool `json:"banned"`
+}
+
+type PasswordResetData struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+type TwoFactorData struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// Registration: validates the credentials by the credential policy of the server, creates the user and starts its first session.
+// Invalid credentials are answered with 422 and the problems of every field, a taken username with 409.
+// If an email is given, a link verifying it is sent to it
 func (server *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Getting data from the Request Payload
 	var creds Credentials
 	errJSONDecode := json.NewDecoder(r.Body).Decode(&creds)
 	if errJSONDecode != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeError(w, "RegisterHandler", http.StatusBadRequest, "invalid request payload")
 		return
 	}
-	// Getting a password that has already been hashed and checked for hash generation errors
-	password, errHashPassword := HashPassword(creds.Password)
-	if errHashPassword != nil {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		log.Printf("RegisterHandler HashPassword err: %s", errHashPassword)
+	// Checking the credentials before any work is done for them
+	problems := server.Policy.ValidateRegistration(creds)
+	var email string
+	if creds.Email != "" || server.Verification.RequireEmail {
+		var msg string
+		if email, msg = normalizeEmail(creds.Email); msg != "" {
+			problems = append(problems, bodyFieldError("email", creds.Email, msg))
+		}
+	}
+	if problems != nil {
+		writeError(w, "RegisterHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
 		return
 	}
 	// Getting a username
 	username := creds.Username
-	// Checking for the existence of such a user
-	if _, errGetByUsername := server.MemServ.UserRepo.GetByUsername(username); !errors.Is(errGetByUsername, repository.ErrUserNotFound) {
-		w.WriteHeader(http.StatusInternalServerError)
-		errorResponse := struct {
-			Errors []struct {
-				Location string `json:"location"`
-				Param    string `json:"param"`
-				Value    string `json:"value"`
-				Msg      string `json:"msg"`
-			} `json:"errors"`
-		}{
-			Errors: []struct {
-				Location string `json:"location"`
-				Param    string `json:"param"`
-				Value    string `json:"value"`
-				Msg      string `json:"msg"`
-			}{
-				{
-					Location: "body",
-					Param:    "username",
-					Value:    username,
-					Msg:      "already exists",
-				},
-			},
-		}
-		if errJSONEncode := json.NewEncoder(w).Encode(errorResponse); errJSONEncode != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Printf("RegisterHandler UserRepo Encode errorResponse err: %s", errJSONEncode)
-		}
+	// Checking for the existence of such a user, before the password is hashed
+	_, errGetByUsername := server.MemServ.UserRepo.GetByUsername(username)
+	if errGetByUsername == nil {
+		writeError(w, "RegisterHandler", http.StatusConflict, "username already exists",
+			bodyFieldError("username", username, "already exists"))
+		return
+	}
+	if !errors.Is(errGetByUsername, repository.ErrUserNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("RegisterHandler UserRepo GetByUsername err: %s", errGetByUsername)
+		return
+	}
+	// Getting a password that has already been hashed and checked for hash generation errors
+	password, errHashPassword := HashPassword(creds.Password)
+	if errHashPassword != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("RegisterHandler HashPassword err: %s", errHashPassword)
 		return
 	}
 	// Generating a unique ID
@@ -86,120 +135,885 @@ func (server *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("RegisterHandler GenerateID err: %s", errID)
 		return
 	}
-	// Entering such a user into the database and checking for the presence, if any, an error is returned
-	if errUserRepoCreate := server.MemServ.UserRepo.Create(&models.User{
+	// Entering such a user into the database, the username may have been taken since the check
+	user := &models.User{
 		ID:       genID,
 		Username: username,
 		Password: password,
-	}); errUserRepoCreate != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("RegisterHandler UserRepo Create err: %s", errUserRepoCreate)
+		Email:    email,
+	}
+	errUserRepoCreate := server.MemServ.UserRepo.Create(user)
+	if errors.Is(errUserRepoCreate, repository.ErrUserAlreadyExists) {
+		writeError(w, "RegisterHandler", http.StatusConflict, "username already exists",
+			bodyFieldError("username", username, "already exists"))
 		return
 	}
-
-	tokenString, errGenToken := GenerateToken(username, genID, []byte(server.KeyJWT))
-
-	if errGenToken != nil {
+	if errUserRepoCreate != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("RegisterHandler GenerateToken err: %s", errGenToken)
+		log.Printf("RegisterHandler UserRepo Create err: %s", errUserRepoCreate)
 		return
 	}
+	// The account is usable without the link, the user can ask for another one if this one is lost
+	if email != "" {
+		if errVerification := server.sendVerification(user, time.Now()); errVerification != nil {
+			log.Printf("RegisterHandler sendVerification err: %s", errVerification)
+		}
+	}
 
 	// Creating a session
-	session := models.Session{
-		Token:  tokenString,
-		UserID: genID,
-	}
-	// Entering the created session into the database with a check for existence, if there has already been one, an error is thrown
-	if errSessionRepoCreate := server.MemServ.SessionRepo.Create(&session); errSessionRepoCreate != nil {
+	tokens, errCreateSession := server.createSession(user, r)
+	if errCreateSession != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("RegisterHandler SessionRepo Create err: %s", errSessionRepoCreate)
+		log.Printf("RegisterHandler createSession err: %s", errCreateSession)
 		return
 	}
 	// Session recording of the response
 	w.WriteHeader(http.StatusCreated)
-	if errJSONEncode := json.NewEncoder(w).Encode(session); errJSONEncode != nil {
-		log.Printf("RegisterHandler Encode session err: %s", errJSONEncode)
+	if errJSONEncode := json.NewEncoder(w).Encode(tokens); errJSONEncode != nil {
+		log.Printf("RegisterHandler Encode tokens err: %s", errJSONEncode)
 	}
 }
 
+// Login: checks the credentials and starts a new session of the user. Missing credentials are answered with 422,
+// wrong ones with 401 and one message for an unknown user and a wrong password, a login throttled after failed attempts with 429.
+// A user with two-factor authentication gets a challenge for LoginTwoFactorHandler instead of the tokens
 func (server *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Getting data from the Request Payload
 	var creds Credentials
 	errCredentials := json.NewDecoder(r.Body).Decode(&creds)
 	if errCredentials != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeError(w, "LoginHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if problems := ValidateLogin(creds); problems != nil {
+		writeError(w, "LoginHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
 		return
 	}
 
-	// Getting a user by name and verifying their existence
-	username := creds.Username
-	var user *models.User
+	// Reserving the attempt before the password is checked, so that a locked account can not be guessed even with the right password
+	// and parallel logins are counted before any of them is compared
+	username, ip, now := creds.Username, requestIP(r), time.Now()
+	wait, errWait := server.Throttle.Reserve(username, ip, now)
+	if errWait != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginHandler Throttle Reserve err: %s", errWait)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, "LoginHandler", http.StatusTooManyRequests, ErrLoginThrottled.Error())
+		return
+	}
+
+	// Getting a user by name, an unknown user is compared with a dummy hash so that the time does not reveal it
 	user, errGetByUsername := server.MemServ.UserRepo.GetByUsername(username)
-	if errors.Is(errGetByUsername, repository.ErrUserNotFound) {
-		w.WriteHeader(http.StatusUnauthorized)
-		if errJSONEncode := json.NewEncoder(w).Encode(
-			struct {
-				Message string `json:"message"`
-			}{
-				Message: "user not found",
-			}); errJSONEncode != nil {
+	if errGetByUsername != nil && !errors.Is(errGetByUsername, repository.ErrUserNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginHandler UserRepo GetByUsername err: %s", errGetByUsername)
+		return
+	}
+	passwordHash := dummyPasswordHash()
+	if user != nil {
+		passwordHash = user.Password
+	}
+
+	// Password matching check, a wrong password stays counted as a failure
+	if !CheckPassword(passwordHash, creds.Password) || user == nil {
+		writeError(w, "LoginHandler", http.StatusUnauthorized, loginFailedMessage)
+		return
+	}
+	// The ban is only revealed to whoever knows the password
+	if user.Banned {
+		if errRelease := server.Throttle.Release(username, ip); errRelease != nil {
+			log.Printf("LoginHandler Throttle Release err: %s", errRelease)
+		}
+		writeError(w, "LoginHandler", http.StatusForbidden, ErrUserBanned.Error())
+		return
+	}
+	// With two-factor authentication the password only earns the challenge of the second step, the throttle is reset by that step
+	if user.TOTPEnabled {
+		if errRelease := server.Throttle.Release(username, ip); errRelease != nil {
+			log.Printf("LoginHandler Throttle Release err: %s", errRelease)
+		}
+		challenge, errChallenge := server.issueTwoFactorChallenge(user)
+		if errChallenge != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Printf("LoginHandler Encode Message err: %s", errJSONEncode)
+			log.Printf("LoginHandler issueTwoFactorChallenge err: %s", errChallenge)
+			return
+		}
+		if errJSONEncode := json.NewEncoder(w).Encode(challenge); errJSONEncode != nil {
+			log.Printf("LoginHandler Encode challenge err: %s", errJSONEncode)
 		}
 		return
 	}
+	if errSucceeded := server.Throttle.Succeeded(username, ip); errSucceeded != nil {
+		log.Printf("LoginHandler Throttle Succeeded err: %s", errSucceeded)
+	}
+
+	// Every login gets its own session, so that logging out on one device does not affect the others
+	tokens, errCreateSession := server.createSession(user, r)
+	if errCreateSession != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginHandler createSession err: %s", errCreateSession)
+		return
+	}
+	// Sending data
+	if errJSONEncode := json.NewEncoder(w).Encode(tokens); errJSONEncode != nil {
+		log.Printf("LoginHandler Encode tokens err: %s", errJSONEncode)
+	}
+}
+
+// The second step of the login of a user with two-factor authentication: checks the challenge of the first step and a TOTP
+// or recovery code and starts the session. Wrong codes are counted by the login throttle like wrong passwords
+func (server *Server) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var data TwoFactorData
+	if errDecode := json.NewDecoder(r.Body).Decode(&data); errDecode != nil {
+		writeError(w, "LoginTwoFactorHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	var problems []FieldError
+	if data.Challenge == "" {
+		problems = append(problems, bodyFieldError("challenge", "", "is required"))
+	}
+	if data.Code == "" {
+		problems = append(problems, bodyFieldError("code", "", "is required"))
+	}
+	if problems != nil {
+		writeError(w, "LoginTwoFactorHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
+		return
+	}
+
+	userID, errChallenge := server.parseTwoFactorChallenge(data.Challenge)
+	if errChallenge != nil {
+		writeError(w, "LoginTwoFactorHandler", http.StatusUnauthorized, errChallenge.Error())
+		return
+	}
+	user, errGetByID := server.MemServ.UserRepo.GetByID(userID)
+	if errors.Is(errGetByID, repository.ErrUserNotFound) || (errGetByID == nil && !user.TOTPEnabled) {
+		writeError(w, "LoginTwoFactorHandler", http.StatusUnauthorized, ErrInvalidChallenge.Error())
+		return
+	}
+	if errGetByID != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginTwoFactorHandler UserRepo GetByID err: %s", errGetByID)
+		return
+	}
+
+	ip, now := requestIP(r), time.Now()
+	wait, errWait := server.Throttle.Reserve(user.Username, ip, now)
+	if errWait != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginTwoFactorHandler Throttle Reserve err: %s", errWait)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, "LoginTwoFactorHandler", http.StatusTooManyRequests, ErrLoginThrottled.Error())
+		return
+	}
+
+	errSecondFactor := server.checkSecondFactor(user, data.Code, now)
+	if errors.Is(errSecondFactor, ErrInvalidSecondFactor) {
+		writeError(w, "LoginTwoFactorHandler", http.StatusUnauthorized, errSecondFactor.Error())
+		return
+	}
+	if errSecondFactor != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginTwoFactorHandler checkSecondFactor err: %s", errSecondFactor)
+		return
+	}
+	if errSucceeded := server.Throttle.Succeeded(user.Username, ip); errSucceeded != nil {
+		log.Printf("LoginTwoFactorHandler Throttle Succeeded err: %s", errSucceeded)
+	}
+
+	if user.Banned {
+		writeError(w, "LoginTwoFactorHandler", http.StatusForbidden, ErrUserBanned.Error())
+		return
+	}
+
+	tokens, errCreateSession := server.createSession(user, r)
+	if errCreateSession != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LoginTwoFactorHandler createSession err: %s", errCreateSession)
+		return
+	}
+	if errJSONEncode := json.NewEncoder(w).Encode(tokens); errJSONEncode != nil {
+		log.Printf("LoginTwoFactorHandler Encode tokens err: %s", errJSONEncode)
+	}
+}
+
+// Exchanging a refresh token for a new pair of tokens, the old refresh token stops working.
+// Presenting an already exchanged refresh token revokes the whole session
+func (server *Server) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var data RefreshData
+	if errDecode := json.NewDecoder(r.Body).Decode(&data); errDecode != nil {
+		writeError(w, "RefreshTokenHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if data.RefreshToken == "" {
+		writeError(w, "RefreshTokenHandler", http.StatusUnprocessableEntity, "validation failed",
+			bodyFieldError("refreshToken", "", "is required"))
+		return
+	}
+
+	tokens, err := server.refreshSession(data.RefreshToken)
+	if errors.Is(err, ErrRefreshTokenInvalid) || errors.Is(err, ErrRefreshTokenReused) {
+		log.Printf("RefreshTokenHandler refreshSession err: %s", err)
+		writeError(w, "RefreshTokenHandler", http.StatusUnauthorized, err.Error())
+		return
+	} else if errors.Is(err, ErrUserBanned) {
+		writeError(w, "RefreshTokenHandler", http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("RefreshTokenHandler refreshSession err: %s", err)
+		return
+	}
+
+	if errJSONEncode := json.NewEncoder(w).Encode(tokens); errJSONEncode != nil {
+		log.Printf("RefreshTokenHandler Encode tokens err: %s", errJSONEncode)
+	}
+}
 
-	// Password matching check
-	if !CheckPassword(user.Password, creds.Password) {
+// Logging out: deletes the session of the token of the request, the token is rejected right away
+func (server *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := SessionFromContext(r.Context())
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
-		if errJSONEncode := json.NewEncoder(w).Encode(
-			struct {
-				Message string `json:"message"`
-			}{
-				Message: "invalid password",
-			}); errJSONEncode != nil {
-			log.Printf("LoginHandler Encode Message err: %s", errJSONEncode)
+		return
+	}
+	if err := server.MemServ.SessionRepo.Delete(session.ID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LogoutHandler SessionRepo Delete err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("LogoutHandler Encode Message err: %s", err)
+	}
+}
+
+// Logging out everywhere: deletes all sessions of the user of the request, all of its tokens are rejected right away
+func (server *Server) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	if err := server.MemServ.SessionRepo.DeleteByUserID(user.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LogoutAllHandler SessionRepo DeleteByUserID err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("LogoutAllHandler Encode Message err: %s", err)
+	}
+}
+
+// Starting the enrollment of two-factor authentication: responds with a new secret and its otpauth:// URI,
+// which are only used for the login after ConfirmTwoFactorHandler
+func (server *Server) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	enrollment, err := server.enrollTwoFactor(user)
+	if errors.Is(err, ErrTwoFactorEnabled) {
+		writeError(w, "EnrollTwoFactorHandler", http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("EnrollTwoFactorHandler enrollTwoFactor err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(enrollment); err != nil {
+		log.Printf("EnrollTwoFactorHandler Encode enrollment err: %s", err)
+	}
+}
+
+// Confirming the enrollment with a code of the authenticator: enables two-factor authentication and responds with the recovery codes
+func (server *Server) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	var data TwoFactorData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "ConfirmTwoFactorHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	codes, err := server.confirmTwoFactor(user, data.Code, time.Now())
+	switch {
+	case errors.Is(err, ErrTwoFactorEnabled) || errors.Is(err, ErrTwoFactorNotEnrolled):
+		writeError(w, "ConfirmTwoFactorHandler", http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, ErrInvalidSecondFactor):
+		writeError(w, "ConfirmTwoFactorHandler", http.StatusUnprocessableEntity, "validation failed",
+			bodyFieldError("code", "", "is invalid"))
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("ConfirmTwoFactorHandler confirmTwoFactor err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		log.Printf("ConfirmTwoFactorHandler Encode recovery codes err: %s", err)
+	}
+}
+
+// Disabling two-factor authentication, takes a TOTP or recovery code so that a stolen access token is not enough
+func (server *Server) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	var data TwoFactorData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "DisableTwoFactorHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	err := server.disableTwoFactor(user, data.Code, time.Now())
+	switch {
+	case errors.Is(err, ErrTwoFactorNotEnabled):
+		writeError(w, "DisableTwoFactorHandler", http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, ErrInvalidSecondFactor):
+		writeError(w, "DisableTwoFactorHandler", http.StatusUnprocessableEntity, "validation failed",
+			bodyFieldError("code", "", "is invalid"))
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DisableTwoFactorHandler disableTwoFactor err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("DisableTwoFactorHandler Encode Message err: %s", err)
+	}
+}
+
+// Getting the live sessions of the user of the request, the most recently used first, the session of the request is marked current
+func (server *Server) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	sessions, err := server.MemServ.SessionRepo.GetByUserID(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GetSessionsHandler SessionRepo GetByUserID err: %s", err)
+		return
+	}
+	current, _ := SessionFromContext(r.Context())
+
+	now := time.Now()
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		if !sessionValid(&session, user, now) {
+			continue
 		}
+		if current != nil && session.ID == current.ID {
+			// The stored last-seen time may lag behind the request by up to lastSeenResolution
+			session.LastSeen = current.LastSeen
+		}
+		response = append(response, SessionResponse{Session: session, Current: current != nil && session.ID == current.ID})
+	}
+	sort.SliceStable(response, func(i, j int) bool {
+		return response[i].LastSeen.After(response[j].LastSeen)
+	})
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("GetSessionsHandler Encode sessions err: %s", err)
+	}
+}
+
+// Revoking one session of the user of the request, its tokens are rejected right away. The sessions of other users are not found
+func (server *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	sessionID := mux.Vars(r)["SESSION_ID"]
+	session, err := server.MemServ.SessionRepo.GetByID(sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) || (err == nil && session.UserID != user.ID) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeleteSessionHandler SessionRepo GetByID err: %s", err)
 		return
 	}
+	if err := server.MemServ.SessionRepo.Delete(sessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeleteSessionHandler SessionRepo Delete err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("DeleteSessionHandler Encode Message err: %s", err)
+	}
+}
 
-	// Checking for the existence of a session and creating a session
-	if session, errSession := server.MemServ.SessionRepo.GetByUserID(user.ID); errSession == nil {
-		// If the session has already been created
-		if errJSONEncode := json.NewEncoder(w).Encode(session); errJSONEncode != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Printf("LoginHandler Encode session err: %s", errJSONEncode)
+// Creating a personal access token of the user of the request for bots and scripts. The value of the token is only in this response,
+// the server keeps its hash. Personal access tokens cannot create more tokens
+func (server *Server) CreateAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	var data AccessTokenData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "CreateAccessTokenHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if problems := validateAccessTokenData(&data); problems != nil {
+		writeError(w, "CreateAccessTokenHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
+		return
+	}
+
+	token, err := server.createAccessToken(user, data, time.Now())
+	if errors.Is(err, ErrTooManyAccessTokens) {
+		writeError(w, "CreateAccessTokenHandler", http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("CreateAccessTokenHandler createAccessToken err: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(token); err != nil {
+		log.Printf("CreateAccessTokenHandler Encode token err: %s", err)
+	}
+}
+
+// Getting the live personal access tokens of the user of the request, the newest first. The values of the tokens are not shown
+func (server *Server) GetAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	tokens, err := server.MemServ.AccessRepo.GetByUserID(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GetAccessTokensHandler AccessRepo GetByUserID err: %s", err)
+		return
+	}
+
+	now := time.Now()
+	response := make([]models.AccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		if now.Before(token.Expires) {
+			response = append(response, token)
 		}
-		w.WriteHeader(http.StatusCreated)
+	}
+	sort.SliceStable(response, func(i, j int) bool {
+		return response[i].Created.After(response[j].Created)
+	})
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("GetAccessTokensHandler Encode tokens err: %s", err)
+	}
+}
+
+// Revoking a personal access token of the user of the request, it is rejected right away. The tokens of other users are not found
+func (server *Server) DeleteAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	tokenID := mux.Vars(r)["TOKEN_ID"]
+	token, err := server.MemServ.AccessRepo.GetByID(tokenID)
+	if errors.Is(err, repository.ErrAccessTokenNotFound) || (err == nil && token.UserID != user.ID) {
+		http.Error(w, "access token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeleteAccessTokenHandler AccessRepo GetByID err: %s", err)
 		return
 	}
+	if err := server.MemServ.AccessRepo.Delete(tokenID); err != nil && !errors.Is(err, repository.ErrAccessTokenNotFound) {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeleteAccessTokenHandler AccessRepo Delete err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("DeleteAccessTokenHandler Encode Message err: %s", err)
+	}
+}
 
-	// Otherwise, create a new one
-	token, errCreateJWTToken := GenerateToken(username, user.ID, []byte(server.KeyJWT))
-	if errCreateJWTToken != nil {
+// Changing the password of the user of the request: takes the current password and revokes all other sessions of the user.
+// A wrong current password is answered with 422 and counted by the login throttle like a failed login
+func (server *Server) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	var data PasswordChangeData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "ChangePasswordHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	var problems []FieldError
+	if data.CurrentPassword == "" {
+		problems = append(problems, bodyFieldError("currentPassword", "", "is required"))
+	}
+	problems = append(problems, server.Policy.ValidatePassword("newPassword", data.NewPassword)...)
+	if problems != nil {
+		writeError(w, "ChangePasswordHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
+		return
+	}
+	if !server.checkAccountPassword(w, r, "ChangePasswordHandler", user, "currentPassword", data.CurrentPassword) {
+		return
+	}
+
+	var currentSessionID string
+	if session, ok := SessionFromContext(r.Context()); ok {
+		currentSessionID = session.ID
+	}
+	if err := server.changePassword(user, currentSessionID, data.NewPassword); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("LoginHandler CreateJWTToken err: %s", errCreateJWTToken)
+		log.Printf("ChangePasswordHandler changePassword err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("ChangePasswordHandler Encode Message err: %s", err)
 	}
+}
 
-	session := models.Session{
-		Token:  token,
-		UserID: user.ID,
+// Setting the email of the user of the request: takes the password and sends a verification link to the new email,
+// which stays unverified, and so unusable for the password reset, until the link is followed
+func (server *Server) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
 	}
-	// Entry into the database with verification
-	if errSessionRepoCreate := server.MemServ.SessionRepo.Create(&session); errSessionRepoCreate != nil {
+	var data EmailChangeData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "ChangeEmailHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	var problems []FieldError
+	email, msg := normalizeEmail(data.Email)
+	if msg != "" {
+		problems = append(problems, bodyFieldError("email", data.Email, msg))
+	}
+	if data.Password == "" {
+		problems = append(problems, bodyFieldError("password", "", "is required"))
+	}
+	if problems != nil {
+		writeError(w, "ChangeEmailHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
+		return
+	}
+	if !server.checkAccountPassword(w, r, "ChangeEmailHandler", user, "password", data.Password) {
+		return
+	}
+
+	if err := server.changeEmail(user, email, time.Now()); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("LoginHandler SessionRepo Create err: %s", errSessionRepoCreate)
+		log.Printf("ChangeEmailHandler changeEmail err: %s", err)
+		return
 	}
-	// Sending data
-	if errJSONEncode := json.NewEncoder(w).Encode(session); errJSONEncode != nil {
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "verification link sent",
+		}); err != nil {
+		log.Printf("ChangeEmailHandler Encode Message err: %s", err)
+	}
+}
+
+// Verifying the email of a user with the token of the link sent to it. An invalid token is answered with 401,
+// an email another account has already verified with 409
+func (server *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var data TokenData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "VerifyEmailHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if data.Token == "" {
+		writeError(w, "VerifyEmailHandler", http.StatusUnprocessableEntity, "validation failed",
+			bodyFieldError("token", "", "is required"))
+		return
+	}
+	err := server.verifyEmail(data.Token, time.Now())
+	switch {
+	case errors.Is(err, ErrVerifyTokenInvalid):
+		writeError(w, "VerifyEmailHandler", http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, ErrEmailAlreadyVerified):
+		writeError(w, "VerifyEmailHandler", http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("VerifyEmailHandler verifyEmail err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("VerifyEmailHandler Encode Message err: %s", err)
+	}
+}
+
+// Sending another link verifying the email of the user of the request, the earlier links stop working.
+// A user without an email or with a verified one is answered with 409
+func (server *Server) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	err := server.sendVerification(user, time.Now())
+	if errors.Is(err, ErrNoEmail) || errors.Is(err, ErrEmailVerified) {
+		writeError(w, "ResendVerificationHandler", http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("ResendVerificationHandler sendVerification err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "verification link sent",
+		}); err != nil {
+		log.Printf("ResendVerificationHandler Encode Message err: %s", err)
+	}
+}
+
+// Requesting a password reset: sends a single-use link to the account with the verified email.
+// The response is the same whether such an account exists or not
+func (server *Server) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var data EmailData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "ForgotPasswordHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	email, msg := normalizeEmail(data.Email)
+	if msg != "" {
+		writeError(w, "ForgotPasswordHandler", http.StatusUnprocessableEntity, "validation failed",
+			bodyFieldError("email", data.Email, msg))
+		return
+	}
+	if err := server.requestPasswordReset(email, time.Now()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("ForgotPasswordHandler requestPasswordReset err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: passwordResetRequestedMessage,
+		}); err != nil {
+		log.Printf("ForgotPasswordHandler Encode Message err: %s", err)
+	}
+}
+
+// Setting a new password with the token of a password reset, all sessions of the user are revoked.
+// A used, expired or unknown token is answered with 401
+func (server *Server) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var data PasswordResetData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "ResetPasswordHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	var problems []FieldError
+	if data.Token == "" {
+		problems = append(problems, bodyFieldError("token", "", "is required"))
+	}
+	problems = append(problems, server.Policy.ValidatePassword("newPassword", data.NewPassword)...)
+	if problems != nil {
+		writeError(w, "ResetPasswordHandler", http.StatusUnprocessableEntity, "validation failed", problems...)
+		return
+	}
+	err := server.resetPassword(data.Token, data.NewPassword, time.Now())
+	if errors.Is(err, ErrResetTokenInvalid) {
+		writeError(w, "ResetPasswordHandler", http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("ResetPasswordHandler resetPassword err: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("ResetPasswordHandler Encode Message err: %s", err)
+	}
+}
+
+// The method of checking the password of the user of the request before a change of the account, the checks are throttled
+// like the logins. Writes the response and returns false if the password is wrong or the account is throttled
+func (server *Server) checkAccountPassword(w http.ResponseWriter, r *http.Request, handlerName string, user *models.User, param, password string) bool {
+	ip, now := requestIP(r), time.Now()
+	wait, err := server.Throttle.Reserve(user.Username, ip, now)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("%s Throttle Reserve err: %s", handlerName, err)
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, handlerName, http.StatusTooManyRequests, ErrLoginThrottled.Error())
+		return false
+	}
+	if !CheckPassword(user.Password, password) {
+		writeError(w, handlerName, http.StatusUnprocessableEntity, "validation failed", bodyFieldError(param, "", "is wrong"))
+		return false
+	}
+	if err := server.Throttle.Release(user.Username, ip); err != nil {
+		log.Printf("%s Throttle Release err: %s", handlerName, err)
+	}
+	return true
+}
+
+// Starting a login with an external identity provider: redirects the user to the provider with a PKCE challenge,
+// the state of the login is kept in a cookie until the callback. An unknown provider is answered with 404
+func (server *Server) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["PROVIDER"]
+	provider, exists := server.OIDC[name]
+	if !exists {
+		writeError(w, "OIDCLoginHandler", http.StatusNotFound, "identity provider not found")
+		return
+	}
+	authURL, cookie, err := server.startOIDCLogin(r, name, provider)
+	if err != nil {
+		log.Printf("OIDCLoginHandler startOIDCLogin %s err: %s", name, err)
+		writeError(w, "OIDCLoginHandler", http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// The callback of a login with an external identity provider: checks the state, exchanges the code for the ID token of the user
+// and starts a session of the linked user like the login does. A failed login is answered with 401,
+// a provider that can not be reached with 502
+func (server *Server) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["PROVIDER"]
+	provider, exists := server.OIDC[name]
+	if !exists {
+		writeError(w, "OIDCCallbackHandler", http.StatusNotFound, "identity provider not found")
+		return
+	}
+	state, errState := server.parseOIDCState(r, name)
+	// The state is used once, whatever the outcome
+	http.SetCookie(w, oidcCookie("", -1, provider.secureCookie))
+	if errState != nil {
+		writeError(w, "OIDCCallbackHandler", http.StatusUnauthorized, errState.Error())
+		return
+	}
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("OIDCCallbackHandler %s provider err: %s %s", name, providerError, query.Get("error_description"))
+		writeError(w, "OIDCCallbackHandler", http.StatusUnauthorized, "identity provider refused the login: "+providerError)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		writeError(w, "OIDCCallbackHandler", http.StatusBadRequest, "code is missing")
+		return
+	}
+
+	user, errLogin := server.finishOIDCLogin(r, name, provider, state, code)
+	switch {
+	case errors.Is(errLogin, oidc.ErrDiscovery) || errors.Is(errLogin, oidc.ErrIssuerMismatch) || errors.Is(errLogin, oidc.ErrNoPKCE):
+		log.Printf("OIDCCallbackHandler finishOIDCLogin %s err: %s", name, errLogin)
+		writeError(w, "OIDCCallbackHandler", http.StatusBadGateway, "identity provider is unavailable")
+		return
+	case errors.Is(errLogin, oidc.ErrExchange) || errors.Is(errLogin, oidc.ErrNoIDToken) || errors.Is(errLogin, oidc.ErrInvalidIDToken) ||
+		errors.Is(errLogin, oidc.ErrUnknownKey) || errors.Is(errLogin, oidc.ErrNonceMismatch):
+		log.Printf("OIDCCallbackHandler finishOIDCLogin %s err: %s", name, errLogin)
+		writeError(w, "OIDCCallbackHandler", http.StatusUnauthorized, "login with the identity provider failed")
+		return
+	case errLogin != nil:
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("LoginHandler Encode session err: %s", errJSONEncode)
+		log.Printf("OIDCCallbackHandler finishOIDCLogin %s err: %s", name, errLogin)
+		return
+	}
+
+	if user.Banned {
+		writeError(w, "OIDCCallbackHandler", http.StatusForbidden, ErrUserBanned.Error())
+		return
+	}
+	// The provider replaces the password, a user with two-factor authentication still takes the second step
+	if user.TOTPEnabled {
+		challenge, errChallenge := server.issueTwoFactorChallenge(user)
+		if errChallenge != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Printf("OIDCCallbackHandler issueTwoFactorChallenge err: %s", errChallenge)
+			return
+		}
+		if errJSONEncode := json.NewEncoder(w).Encode(challenge); errJSONEncode != nil {
+			log.Printf("OIDCCallbackHandler Encode challenge err: %s", errJSONEncode)
+		}
+		return
+	}
+	tokens, errCreateSession := server.createSession(user, r)
+	if errCreateSession != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("OIDCCallbackHandler createSession err: %s", errCreateSession)
+		return
+	}
+	if errJSONEncode := json.NewEncoder(w).Encode(tokens); errJSONEncode != nil {
+		log.Printf("OIDCCallbackHandler Encode tokens err: %s", errJSONEncode)
+	}
+}
+
+// Publishing the public keys verifying the access tokens, so that other services can check the tokens without the secret
+func (server *Server) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(server.Keys.JWKS()); err != nil {
+		log.Printf("JWKSHandler Encode keys err: %s", err)
 	}
-	w.WriteHeader(http.StatusCreated)
 }
 
 func (server *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if isPageRequest(r) {
+		server.servePostPage(w, r, "GetPostsHandler", repository.PostQuery{})
+		return
+	}
 	// Getting all posts from the database
 	posts, err := server.MemServ.PostRepo.GetAll()
 	if err != nil {
@@ -207,6 +1021,15 @@ func (server *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("GetPostsHandler PostRepo GetAll err: %s", err)
 		return
 	}
+	if err := server.fillPosts(posts); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GetPostsHandler fillPosts err: %s", err)
+		return
+	}
+	if posts, err = sortPosts(r, posts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	// Sending data
 	if err := json.NewEncoder(w).Encode(posts); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -238,20 +1061,13 @@ func (server *Server) PostPostsHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("PostPostsHandler GenerateID err: %s", errGenID)
 	}
 
-	token, errToken := getJWTByRequest(r)
-	if errToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("PostPostsHandler getJWTByRequest err: %s", errToken)
-	}
-	user, errGetUserToken := getUserByJWT(token, []byte(server.KeyJWT))
-	if errGetUserToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("PostPostsHandler getUserByJWT err: %s", errGetUserToken)
+	user := requestUser(w, r)
+	if user == nil {
+		return
 	}
 
 	post := models.Post{
 		ID:       genID,
-		Score:    1,
 		Views:    0,
 		Type:     typePost,
 		Title:    title,
@@ -259,15 +1075,7 @@ func (server *Server) PostPostsHandler(w http.ResponseWriter, r *http.Request) {
 		Category: category,
 		Text:     text,
 		URL:      url,
-		Votes: []models.Vote{
-			{
-				UserID: user.ID,
-				Vote:   1,
-			},
-		},
-		Comments:         []models.Comment{},
-		Created:          time.Now(),
-		UpvotePercentage: 100,
+		Created:  time.Now(),
 	}
 	errPostRepoCreate := server.MemServ.PostRepo.Create(&post)
 	if errPostRepoCreate != nil {
@@ -276,13 +1084,22 @@ func (server *Server) PostPostsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if errJSONEncode := json.NewEncoder(w).Encode(post); errJSONEncode != nil {
-		log.Printf("PostPostsHandler PostRepo Encode post: %s", errJSONEncode)
+	// The author upvotes the new post
+	if _, errCast := server.MemServ.VoteRepo.Cast(post.ID, user.ID, 1); errCast != nil {
+		log.Printf("PostPostsHandler VoteRepo Cast err: %s", errCast)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if errFill := server.fillPost(&post); errFill != nil {
+		log.Printf("PostPostsHandler fillPost err: %s", errFill)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
+	if errJSONEncode := json.NewEncoder(w).Encode(post); errJSONEncode != nil {
+		log.Printf("PostPostsHandler PostRepo Encode post: %s", errJSONEncode)
+	}
 }
 
 func (server *Server) GetPostsByCategory(w http.ResponseWriter, r *http.Request) {
@@ -293,6 +1110,10 @@ func (server *Server) GetPostsByCategory(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if isPageRequest(r) {
+		server.servePostPage(w, r, "GetPostsByCategory", repository.PostQuery{Category: categoryName})
+		return
+	}
 
 	categoryPosts, errPostRepoGetByCategory := server.MemServ.PostRepo.GetByCategory(categoryName)
 	if errPostRepoGetByCategory != nil {
@@ -300,6 +1121,16 @@ func (server *Server) GetPostsByCategory(w http.ResponseWriter, r *http.Request)
 		log.Printf("GetPostsByCategory GetByCategory categoryName %s", errPostRepoGetByCategory)
 		return
 	}
+	if errFill := server.fillPosts(categoryPosts); errFill != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GetPostsByCategory fillPosts %s", errFill)
+		return
+	}
+	categoryPosts, errSort := sortPosts(r, categoryPosts)
+	if errSort != nil {
+		http.Error(w, errSort.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if errJSONEncode := json.NewEncoder(w).Encode(categoryPosts); errJSONEncode != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -319,17 +1150,24 @@ func (server *Server) GetPostsByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errIncrement := server.MemServ.PostRepo.IncrementViews(postID); errIncrement != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GetPostsByID PostRepo IncrementViews err:%s", errIncrement)
+		return
+	}
 	idPost, err := server.MemServ.PostRepo.GetByID(postID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("GetPostsByID PostRepo GetByID %s", err)
 		return
 	}
-
-	idPost.Views += 1
-	if errUpdate := server.MemServ.PostRepo.Update(idPost); errUpdate != nil {
+	if errFill := server.fillPost(idPost); errFill != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("GetPostsByID PostRepo.Update err:%s", err)
+		log.Printf("GetPostsByID fillPost err:%s", errFill)
+		return
+	}
+	if errSort := sortComments(r, idPost.Comments); errSort != nil {
+		http.Error(w, errSort.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -362,49 +1200,61 @@ func (server *Server) AddCommentPost(w http.ResponseWriter, r *http.Request) {
 
 	bodyText := data.Comment
 
-	token, errToken := getJWTByRequest(r)
-	if errToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("AddCommentPost getJWTByRequest err: %s", errToken)
-	}
-	user, errGetUserToken := getUserByJWT(token, []byte(server.KeyJWT))
-	if errGetUserToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("AddCommentPost getUserByJWT err: %s", errGetUserToken)
+	user := requestUser(w, r)
+	if user == nil {
+		return
 	}
 
 	idPost, errGetByID := server.MemServ.PostRepo.GetByID(postID)
 	if errGetByID != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("AddCommentPost PostRepo GetByID err: %s", errGetByID)
+		return
+	}
+	// A locked post keeps its comments but takes no new ones
+	if idPost.Locked {
+		writeError(w, "AddCommentPost", http.StatusForbidden, ErrPostLocked.Error())
+		return
 	}
 
 	genIDComment, errGenIDComment := GenerateID()
 	if errGenIDComment != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("AddCommentPost GenerateID err: %s", errGenIDComment)
+		return
 	}
+	// COMMENT_ID is only present in the route of a reply
 	newComment := models.Comment{
-		ID:      genIDComment,
-		Author:  *user,
-		Body:    bodyText,
-		Created: time.Now(),
+		ID:       genIDComment,
+		ParentID: vars["COMMENT_ID"],
+		Author:   *user,
+		Body:     bodyText,
+		Created:  time.Now(),
 	}
 
-	idPost.Comments = append(idPost.Comments, newComment)
-
-	if err := server.MemServ.PostRepo.Update(idPost); err != nil {
-		log.Printf("AddCommentPost UserRepo Update err: %s", err)
+	if err := server.MemServ.CommentRepo.Create(postID, &newComment); errors.Is(err, repository.ErrCommentNotFound) {
+		log.Printf("AddCommentPost CommentRepo Create err: %s", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrCommentTooDeep) {
+		log.Printf("AddCommentPost CommentRepo Create err: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("AddCommentPost CommentRepo Create err: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	if err := json.NewEncoder(w).Encode(idPost); err != nil {
-		log.Printf("AddCommentPost Encode idPost err: %s", err)
+	if err := server.fillPost(idPost); err != nil {
+		log.Printf("AddCommentPost fillPost err: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-
+	if err := json.NewEncoder(w).Encode(idPost); err != nil {
+		log.Printf("AddCommentPost Encode idPost err: %s", err)
+	}
 }
 
 func (server *Server) DeleteCommentPost(w http.ResponseWriter, r *http.Request) {
@@ -422,21 +1272,55 @@ func (server *Server) DeleteCommentPost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+
 	post, err := server.MemServ.PostRepo.GetByID(postID)
-	if err != nil {
+	if errors.Is(err, repository.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		log.Printf("DeleteCommentPost PostRepo GetByID err: %s", err)
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	for indexComment, comment := range post.Comments {
-		if comment.ID == commentID {
-			post.Comments = append(post.Comments[:indexComment], post.Comments[indexComment+1:]...)
-			break
+
+	comments, err := server.MemServ.CommentRepo.GetByPostID(postID)
+	if err != nil {
+		log.Printf("DeleteCommentPost CommentRepo GetByPostID err: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var comment *models.Comment
+	for index := range comments {
+		if comments[index].ID == commentID && !comments[index].Deleted {
+			comment = &comments[index]
 		}
 	}
+	if comment == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !server.canDeleteComment(r.Context(), user, post, comment) {
+		w.WriteHeader(http.StatusForbidden)
+		log.Printf("DeleteCommentPost user %s is not allowed to delete comment %s", user.ID, commentID)
+		return
+	}
+
+	if errDelete := server.MemServ.CommentRepo.Delete(postID, commentID); errors.Is(errDelete, repository.ErrCommentNotFound) {
+		log.Printf("DeleteCommentPost CommentRepo Delete err: %s", errDelete)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errDelete != nil {
+		log.Printf("DeleteCommentPost CommentRepo Delete err: %s", errDelete)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	if errUpdPost := server.MemServ.PostRepo.Update(post); errUpdPost != nil {
-		log.Printf("DeleteCommentPost PostRepo Update err: %s", err)
+	if err = server.fillPost(post); err != nil {
+		log.Printf("DeleteCommentPost fillPost err: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -451,6 +1335,30 @@ func (server *Server) DeleteCommentPost(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *Server) UpvotePost(w http.ResponseWriter, r *http.Request) {
+	server.votePost(w, r, "UpvotePost", 1)
+}
+
+func (server *Server) DownvotePost(w http.ResponseWriter, r *http.Request) {
+	server.votePost(w, r, "DownvotePost", -1)
+}
+
+func (server *Server) UnvotePost(w http.ResponseWriter, r *http.Request) {
+	server.votePost(w, r, "UnvotePost", 0)
+}
+
+func (server *Server) UpvoteComment(w http.ResponseWriter, r *http.Request) {
+	server.voteComment(w, r, "UpvoteComment", 1)
+}
+
+func (server *Server) DownvoteComment(w http.ResponseWriter, r *http.Request) {
+	server.voteComment(w, r, "DownvoteComment", -1)
+}
+
+func (server *Server) UnvoteComment(w http.ResponseWriter, r *http.Request) {
+	server.voteComment(w, r, "UnvoteComment", 0)
+}
+
+func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	postID, ok := vars["POST_ID"]
@@ -459,278 +1367,282 @@ func (server *Server) UpvotePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, errToken := getJWTByRequest(r)
-	if errToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("UpvotePost getJWTByRequest err: %s", errToken)
+	user := requestUser(w, r)
+	if user == nil {
+		return
 	}
-	user, errGetUserToken := getUserByJWT(token, []byte(server.KeyJWT))
-	if errGetUserToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("UpvotePost getUserByJWT err: %s", errGetUserToken)
+	post, err := server.MemServ.PostRepo.GetByID(postID)
+	if errors.Is(err, repository.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeletePost PostRepo GetByID postID err: %s", err)
+		return
+	}
+	if !server.canDeletePost(r.Context(), user, post) {
+		w.WriteHeader(http.StatusForbidden)
+		log.Printf("DeletePost user %s is not allowed to delete post %s", user.ID, postID)
+		return
 	}
 
-	post, err := server.MemServ.PostRepo.GetByID(postID)
-	if err != nil {
-		log.Printf("UpvotePost PostRepo GetByID err: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Checking for ratings user.ID
-	for index, vote := range post.Votes {
-		if vote.UserID == user.ID {
-			// If it's upvote, then we don't do anything and just delete the same post.
-			if vote.Vote == 1 {
-				if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					log.Printf("UpvotePost NewEncoder Encode post If Vote == 1 err: %s", errMarshal)
-					return
-				}
-				w.WriteHeader(http.StatusOK)
-				// If the score is negative
-			} else {
-				post.Votes[index].Vote = 1
-				post.Score += 2
-				post.UpvotePercentage = post.Score / len(post.Votes) * 100
-				if errUpate := server.MemServ.PostRepo.Update(post); errUpate != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					log.Printf("UpvotePost PostRepo Update post If Vote == -1 err: %s", errUpate)
-					return
-				}
-				if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					log.Printf("UpvotePost NewEncoder Encode post If Vote == -1 err: %s", errMarshal)
-					return
-				}
-				w.WriteHeader(http.StatusOK)
-			}
-			return
-		}
+	if err := server.MemServ.PostRepo.Delete(postID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeletePost PostRepo Delete postID err: %s", err)
+		return
 	}
-	// The case when the estimate was not found
-	newVote := models.Vote{
-		UserID: user.ID,
-		Vote:   1,
+	if err := server.MemServ.VoteRepo.DeleteByPostID(postID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("DeletePost VoteRepo DeleteByPostID postID err: %s", err)
+		return
 	}
-	post.Votes = append(post.Votes, newVote)
-	post.Score += 1
-	post.UpvotePercentage = (post.Score + len(post.Votes)) / (len(post.Votes) * 2) * 100
-	if errUpate := server.MemServ.PostRepo.Update(post); errUpate != nil {
+	if err := server.MemServ.CommentRepo.DeleteByPostID(postID); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("UpvotePost PostRepo Update post Not Have Until err: %s", errUpate)
+		log.Printf("DeletePost CommentRepo DeleteByPostID postID err: %s", err)
 		return
 	}
-	if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
+
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("DeletePost Encode Message err: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("UpvotePost NewEncoder Encode post Not Have until err: %s", errMarshal)
 		return
 	}
+
 	w.WriteHeader(http.StatusOK)
 
 }
 
-func (server *Server) DownvotePost(w http.ResponseWriter, r *http.Request) {
+func (server *Server) GetPostsByUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	postID, ok := vars["POST_ID"]
+	userLogin, ok := vars["USER_LOGIN"]
+
 	if !ok {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	post, err := server.MemServ.PostRepo.GetByID(postID)
+
+	user, err := server.MemServ.UserRepo.GetByUsername(userLogin)
+
 	if err != nil {
-		log.Printf("DownvotePost PostRepo GetByID err: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("GetPostsByUser UserRepo GetByUsername userLogin err: %s", err)
 
-	token, errToken := getJWTByRequest(r)
-	if errToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("DownvotePost getJWTByRequest err: %s", errToken)
+		return
 	}
-	user, errGetUserToken := getUserByJWT(token, []byte(server.KeyJWT))
-	if errGetUserToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("DownvotePost getUserByJWT err: %s", errGetUserToken)
-	}
-
-	// Checking for ratings user.ID
-	for index, vote := range post.Votes {
-		if vote.UserID == user.ID {
-			// If it's a downvote, then we don't do anything and just delete the same post.
-			if vote.Vote == -1 {
-				if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					log.Printf("DownvotePost NewEncoder Encode post If Vote == -1 err: %s", errMarshal)
-					return
-				}
-				w.WriteHeader(http.StatusOK)
-				// If the rating is positive
-			} else {
-				post.Votes[index].Vote = -1
-				post.Score -= 2
-				post.UpvotePercentage = post.Score / len(post.Votes) * 100
-				if errUpate := server.MemServ.PostRepo.Update(post); errUpate != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					log.Printf("DownvotePost PostRepo Update post If Vote == 1 err: %s", errUpate)
-					return
-				}
-				if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					log.Printf("DownvotePost NewEncoder Encode post If Vote == 1 err: %s", errMarshal)
-					return
-				}
-				w.WriteHeader(http.StatusOK)
-			}
-			return
-		}
+	if isPageRequest(r) {
+		server.servePostPage(w, r, "GetPostsByUser", repository.PostQuery{AuthorID: user.ID})
+		return
 	}
-	// The case when the estimate was not found
-	newVote := models.Vote{
-		UserID: user.ID,
-		Vote:   -1,
+
+	userPosts, err := server.MemServ.PostRepo.GetByUserID(user.ID)
+
+	if errors.Is(err, repository.ErrNoPostsUser) {
+		userPosts = make([]models.Post, 0)
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("GetPostsByUser PostRepo GetByUserID user.ID err: %s", err)
+
+		return
 	}
-	post.Votes = append(post.Votes, newVote)
-	post.Score -= 1
-	post.UpvotePercentage = (post.Score + len(post.Votes)) / (len(post.Votes) * 2) * 100
-	if errUpate := server.MemServ.PostRepo.Update(post); errUpate != nil {
+	if err := server.fillPosts(userPosts); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("DownvotePost PostRepo Update post Not Have Until err: %s", errUpate)
+		log.Printf("GetPostsByUser fillPosts err: %s", err)
 		return
 	}
-	if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
+	if userPosts, err = sortPosts(r, userPosts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(userPosts); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("DownvotePost NewEncoder Encode post Not Have until err: %s", errMarshal)
+		log.Printf("GetPostsByUser Encode userPosts %s", err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-
 }
 
-func (server *Server) UnvotePost(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-
-	postID, ok := vars["POST_ID"]
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
+// Locking or unlocking a post, a locked post takes no new comments and replies. Allowed to the moderators of its category
+// and of the whole site, others get 403
+func (server *Server) LockPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
 		return
 	}
+	var data LockData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "LockPostHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	postID := mux.Vars(r)["POST_ID"]
 	post, err := server.MemServ.PostRepo.GetByID(postID)
-	if err != nil {
-		log.Printf("UnvotePost PostRepo GetByID err: %s", err)
+	if errors.Is(err, repository.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LockPostHandler PostRepo GetByID err: %s", err)
 		return
 	}
-
-	token, errToken := getJWTByRequest(r)
-	if errToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("UnvotePost getJWTByRequest err: %s", errToken)
+	if !server.canLockPost(r.Context(), user, post) {
+		w.WriteHeader(http.StatusForbidden)
+		log.Printf("LockPostHandler user %s is not allowed to lock post %s", user.ID, postID)
+		return
 	}
-	user, errGetUserToken := getUserByJWT(token, []byte(server.KeyJWT))
-	if errGetUserToken != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Printf("UnvotePost getUserByJWT err: %s", errGetUserToken)
-	}
-	// Checking for ratings user.ID
-	for index, vote := range post.Votes {
-		if vote.UserID == user.ID {
-			if vote.Vote == 1 {
-				post.Score -= 1
-			} else {
-				post.Score += 1
-			}
-			post.Votes = append(post.Votes[:index], post.Votes[index+1:]...)
-			post.UpvotePercentage = (post.Score + len(post.Votes)) / (len(post.Votes) * 2) * 100
-			if errUpate := server.MemServ.PostRepo.Update(post); errUpate != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Printf("UnvotePost PostRepo Update Have Vote post err: %s", errUpate)
-				return
-			}
-			if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Printf("UnvotePost NewEncoder Encode Have Vote post err: %s", errMarshal)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+
+	post, err = server.MemServ.PostRepo.SetLocked(postID, data.Locked)
+	if errors.Is(err, repository.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("LockPostHandler PostRepo SetLocked err: %s", err)
+		return
 	}
-	// The case when the estimate was not found
-	if errMarshal := json.NewEncoder(w).Encode(post); errMarshal != nil {
+	if err := server.fillPost(post); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("UnvotePost NewEncoder Encode post Not Have Vote err: %s", errMarshal)
+		log.Printf("LockPostHandler fillPost err: %s", err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(post); err != nil {
+		log.Printf("LockPostHandler Encode post err: %s", err)
+	}
 }
 
-func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-
-	postID, ok := vars["POST_ID"]
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
+// Banning or unbanning a user, a ban logs the user out everywhere and rejects its logins and tokens. Allowed to the moderators
+// of the whole site and the admins, nobody can ban itself or an admin
+func (server *Server) BanUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
 		return
 	}
-
-	if err := server.MemServ.PostRepo.Delete(postID); err != nil {
+	var data BanData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, "BanUserHandler", http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	target, err := server.MemServ.UserRepo.GetByUsername(mux.Vars(r)["USER_LOGIN"])
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("DeletePost PostRepo Delete postID err: %s", err)
+		log.Printf("BanUserHandler UserRepo GetByUsername err: %s", err)
+		return
+	}
+	if !server.canBanUser(r.Context(), user, target) {
+		w.WriteHeader(http.StatusForbidden)
+		log.Printf("BanUserHandler user %s is not allowed to ban user %s", user.ID, target.ID)
 		return
 	}
 
+	if err := server.setBanned(target, data.Banned); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("BanUserHandler setBanned err: %s", err)
+		return
+	}
 	if err := json.NewEncoder(w).Encode(
 		struct {
 			Message string `json:"message"`
 		}{
 			Message: "success",
 		}); err != nil {
-		log.Printf("DeletePost Encode Message err: %s", err)
+		log.Printf("BanUserHandler Encode Message err: %s", err)
+	}
+}
+
+// Getting the roles of all users, only for the admins
+func (server *Server) GetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+	if !server.canManageRoles(user) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	roles, err := server.listRoles()
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("GetRolesHandler listRoles err: %s", err)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-
+	if err := json.NewEncoder(w).Encode(roles); err != nil {
+		log.Printf("GetRolesHandler Encode roles err: %s", err)
+	}
 }
 
-func (server *Server) GetPostsByUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+// Granting a role to a user, on the whole site or in the category of the "category" query parameter. Only for the admins,
+// granting a role the user already has changes nothing
+func (server *Server) GrantRoleHandler(w http.ResponseWriter, r *http.Request) {
+	server.changeRole(w, r, "GrantRoleHandler", true)
+}
 
-	userLogin, ok := vars["USER_LOGIN"]
+// Revoking a role of a user, on the whole site or in the category of the "category" query parameter. Only for the admins,
+// an admin can not revoke its own admin role
+func (server *Server) RevokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	server.changeRole(w, r, "RevokeRoleHandler", false)
+}
 
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
+// The common part of granting and revoking a role, handlerName is used in the log messages
+func (server *Server) changeRole(w http.ResponseWriter, r *http.Request, handlerName string, grant bool) {
+	user := requestUser(w, r)
+	if user == nil {
 		return
 	}
-
-	user, err := server.MemServ.UserRepo.GetByUsername(userLogin)
-
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("GetPostsByUser UserRepo GetByUsername userLogin err: %s", err)
-
+	if !server.canManageRoles(user) {
+		w.WriteHeader(http.StatusForbidden)
 		return
 	}
-
-	userPosts, err := server.MemServ.PostRepo.GetByUserID(user.ID)
-
-	if errors.Is(err, repository.ErrNoPostsUser) {
-		userPosts = make([]models.Post, 0)
+	role, category := mux.Vars(r)["ROLE"], r.URL.Query().Get("category")
+	if problems := validateRole(role, category); problems != nil {
+		writeError(w, handlerName, http.StatusUnprocessableEntity, "validation failed", problems...)
+		return
+	}
+	target, err := server.MemServ.UserRepo.GetByUsername(mux.Vars(r)["USER_LOGIN"])
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
 	} else if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("GetPostsByUser PostRepo GetByUserID user.ID err: %s", err)
-
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("%s UserRepo GetByUsername err: %s", handlerName, err)
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(userPosts); err != nil {
+	if grant {
+		err = server.MemServ.RoleRepo.Grant(&models.RoleGrant{UserID: target.ID, Role: role, Category: category, Created: time.Now()})
+		if errors.Is(err, repository.ErrRoleAlreadyGranted) {
+			err = nil
+		}
+	} else {
+		// Otherwise the last admin could leave the site without one
+		if target.ID == user.ID && role == models.RoleAdmin {
+			writeError(w, handlerName, http.StatusConflict, "admins can not revoke their own admin role")
+			return
+		}
+		err = server.MemServ.RoleRepo.Revoke(target.ID, role, category)
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			http.Error(w, "role not found", http.StatusNotFound)
+			return
+		}
+	}
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("GetPostsByUser Encode userPosts %s", err)
+		log.Printf("%s RoleRepo err: %s", handlerName, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(
+		struct {
+			Message string `json:"message"`
+		}{
+			Message: "success",
+		}); err != nil {
+		log.Printf("%s Encode Message err: %s", handlerName, err)
+	}
 }
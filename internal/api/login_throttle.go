@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Default settings of the login throttle
+const (
+	defaultAccountAttempts = 5
+	defaultIPAttempts      = 20
+	defaultBaseDelay       = time.Second
+	defaultMaxDelay        = 15 * time.Minute
+	defaultAttemptsReset   = 24 * time.Hour
+)
+
+// How often the forgotten login attempts are deleted
+const loginAttemptSweepInterval = 10 * time.Minute
+
+// The message of every failed login, it does not tell whether the username or the password was wrong
+const loginFailedMessage = "invalid username or password"
+
+// Errors related to the login throttle
+var (
+	ErrLoginThrottled     = errors.New("too many failed login attempts, try again later")
+	ErrInvalidAttemptRule = errors.New("the numbers of free login attempts must be positive")
+)
+
+// Structure of the "loginThrottle" section of the config, empty values mean the defaults
+type LoginThrottleConfig struct {
+	AccountAttempts int    `json:"accountAttempts"` // failures of an account before the delays start
+	IPAttempts      int    `json:"ipAttempts"`      // failures from an IP address before the delays start
+	BaseDelay       string `json:"baseDelay"`       // the first delay, every next failure doubles it, for example "1s"
+	MaxDelay        string `json:"maxDelay"`        // the longest delay, the lockout, for example "15m"
+	ResetAfter      string `json:"resetAfter"`      // how long after the last failure the count starts over, for example "24h"
+}
+
+// LoginThrottle - the protection of the login against guessing the passwords. The failed logins are counted for the account
+// and for the IP address, once a count reaches its number of free attempts every login under that key has to wait a delay
+// after the last failure, which doubles with every failure up to the lockout of MaxDelay
+type LoginThrottle struct {
+	attempts        repository.LoginAttemptRepository
+	accountAttempts int
+	ipAttempts      int
+	baseDelay       time.Duration
+	maxDelay        time.Duration
+	resetAfter      time.Duration
+}
+
+// LoginThrottle constructor, reads the settings from the config and keeps the counts in the repository
+func NewLoginThrottle(config LoginThrottleConfig, attempts repository.LoginAttemptRepository) (*LoginThrottle, error) {
+	throttle := &LoginThrottle{
+		attempts:        attempts,
+		accountAttempts: valueOr(config.AccountAttempts, defaultAccountAttempts),
+		ipAttempts:      valueOr(config.IPAttempts, defaultIPAttempts),
+	}
+	if throttle.accountAttempts < 1 || throttle.ipAttempts < 1 {
+		return nil, ErrInvalidAttemptRule
+	}
+	var err error
+	if throttle.baseDelay, err = parseDuration(config.BaseDelay, defaultBaseDelay); err != nil {
+		return nil, err
+	}
+	if throttle.maxDelay, err = parseDuration(config.MaxDelay, defaultMaxDelay); err != nil {
+		return nil, err
+	}
+	if throttle.resetAfter, err = parseDuration(config.ResetAfter, defaultAttemptsReset); err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// The functions of the keys the attempts of an account and of an IP address are counted under.
+// Unknown usernames are counted too, so the throttle does not tell which accounts exist
+func accountAttemptKey(username string) string {
+	return "account:" + strings.ToLower(username)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// The method of reserving a login of the username from the IP address before the password is checked: the attempt is counted
+// as a failure of the account and of the address at once, so that parallel logins can not all pass before any failure is counted.
+// Returns how long to wait before the next try if the login may not be tried now, nothing is counted then
+func (throttle *LoginThrottle) Reserve(username, ip string, now time.Time) (time.Duration, error) {
+	accountKey := accountAttemptKey(username)
+	wait, err := throttle.attempts.Reserve(accountKey, now, throttle.resetAfter, throttle.delayAfter(throttle.accountAttempts))
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	wait, err = throttle.attempts.Reserve(ipAttemptKey(ip), now, throttle.resetAfter, throttle.delayAfter(throttle.ipAttempts))
+	if err != nil || wait > 0 {
+		if errRelease := throttle.attempts.Release(accountKey); errRelease != nil {
+			log.Printf("LoginThrottle Reserve LoginRepo Release err: %s", errRelease)
+		}
+	}
+	return wait, err
+}
+
+// The method of taking back the attempt reserved for a login whose password was right, but which is not finished yet
+// or does not log in, like the first step of a login with two-factor authentication
+func (throttle *LoginThrottle) Release(username, ip string) error {
+	if err := throttle.attempts.Release(accountAttemptKey(username)); err != nil {
+		return err
+	}
+	return throttle.attempts.Release(ipAttemptKey(ip))
+}
+
+// The method of finishing a successful login: the failed logins of the account are forgotten and the attempt reserved for the
+// address is taken back. The earlier failures of the address are kept, otherwise logging in to one own account would let
+// an address keep guessing the passwords of the others
+func (throttle *LoginThrottle) Succeeded(username, ip string) error {
+	if err := throttle.Forget(username); err != nil {
+		return err
+	}
+	return throttle.attempts.Release(ipAttemptKey(ip))
+}
+
+// The method of forgetting the failed logins of the account, after a successful login or a password reset
+func (throttle *LoginThrottle) Forget(username string) error {
+	return throttle.attempts.Reset(accountAttemptKey(username))
+}
+
+// The method of getting the rule of the delays of a key with the number of free attempts
+func (throttle *LoginThrottle) delayAfter(free int) func(failures int) time.Duration {
+	return func(failures int) time.Duration {
+		return throttle.delay(failures, free)
+	}
+}
+
+// The method of getting the delay after the failures of a key with the number of free attempts
+func (throttle *LoginThrottle) delay(failures, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+	delay := throttle.baseDelay
+	for i := free; i < failures && delay < throttle.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, throttle.maxDelay)
+}
+
+// The function of periodically deleting the login attempts that are old enough to start over, it is meant to be run in its own goroutine
+func sweepLoginAttempts(attempts repository.LoginAttemptRepository, resetAfter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if _, err := attempts.DeleteExpired(now.Add(-resetAfter)); err != nil {
+			log.Printf("sweepLoginAttempts LoginRepo DeleteExpired err: %s", err)
+		}
+	}
+}
+
+// The hash the passwords of unknown users are compared with, so that a login of an unknown user takes as long as a wrong password
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("dummy password of an unknown user")
+	if err != nil {
+		log.Printf("dummyPasswordHash HashPassword err: %s", err)
+	}
+	return hash
+})
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// The function of reserving the logins in parallel, key gives the username and the IP address of the i-th login, returns how many were allowed
+func reserveParallel(t *testing.T, throttle *LoginThrottle, logins int, key func(i int) (string, string)) int {
+	t.Helper()
+	now := time.Now()
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			username, ip := key(i)
+			wait, err := throttle.Reserve(username, ip, now)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return int(allowed.Load())
+}
+
+func TestLoginThrottleReserveConcurrent(t *testing.T) {
+	throttle, err := NewLoginThrottle(LoginThrottleConfig{}, repository.NewMemoryLoginAttemptRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := reserveParallel(t, throttle, 100, func(i int) (string, string) {
+		return "alice", fmt.Sprintf("192.0.2.%d", i)
+	})
+	if allowed != defaultAccountAttempts {
+		t.Fatalf("%d parallel logins of one account allowed, want %d", allowed, defaultAccountAttempts)
+	}
+
+	allowed = reserveParallel(t, throttle, 100, func(i int) (string, string) {
+		return fmt.Sprintf("user%d", i), "198.51.100.1"
+	})
+	if allowed != defaultIPAttempts {
+		t.Fatalf("%d parallel logins from one address allowed, want %d", allowed, defaultIPAttempts)
+	}
+}
+
+func TestLoginConcurrentWrongPasswords(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register("alice")
+
+	const logins = 20
+	var wg sync.WaitGroup
+	statuses := make(chan int, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- ts.request("POST", "/api/login", "", Credentials{Username: "alice", Password: "wrong password"}).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != defaultAccountAttempts || counts[http.StatusTooManyRequests] != logins-defaultAccountAttempts {
+		t.Fatalf("statuses %v, want %d of 401 and the rest 429", counts, defaultAccountAttempts)
+	}
+}
+
+func TestLoginSuccessesDoNotExhaustAddress(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register("alice")
+	ts.register("bob")
+
+	for i := 0; i < defaultIPAttempts+5; i++ {
+		ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "alice", Password: testPassword})
+	}
+	// The address still has its free attempts for the other accounts
+	ts.expect(http.StatusUnauthorized, "POST", "/api/login", "", Credentials{Username: "bob", Password: "wrong password"})
+	ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "bob", Password: testPassword})
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The type of the keys of the values that the middlewares put in the context of the request
+type contextKey string
+
+// The keys of the authenticated user, of its session and of its personal access token in the context of the request
+const (
+	userContextKey        contextKey = "user"
+	sessionContextKey     contextKey = "session"
+	accessTokenContextKey contextKey = "accessToken"
+)
+
+// AuthMiddleware - a middleware of the protected routes: validates the bearer token of the request, its user and its session
+// and puts the user and the session in the context. Requests without a valid token or with a token whose user no longer exists
+// or whose session was deleted or expired are answered with 401 and requests of a banned user with 403 before the handler runs.
+// The routes of the account only take the tokens of the sessions, requests with a personal access token are answered with 403
+func (server *Server) AuthMiddleware(next http.Handler) http.Handler {
+	return server.authMiddleware(next, nil)
+}
+
+// ScopedAuthMiddleware - a middleware of the routes that bots and scripts may use: takes the tokens of the sessions like AuthMiddleware
+// and also the personal access tokens that have any of the scopes, putting the token in the context too. An unknown, expired or revoked
+// personal access token is answered with 401, a token without the scopes with 403
+func (server *Server) ScopedAuthMiddleware(scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return server.authMiddleware(next, scopes)
+	}
+}
+
+// The method of building the authentication middleware, no scopes means that personal access tokens are not accepted
+func (server *Server) authMiddleware(next http.Handler, scopes []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, errToken := getJWTByRequest(r)
+		if errToken != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			log.Printf("AuthMiddleware getJWTByRequest %s %s err: %s", r.Method, r.URL.Path, errToken)
+			return
+		}
+		var ctx context.Context
+		if isAccessToken(token) {
+			ctx = server.accessTokenContext(w, r, token, scopes)
+		} else {
+			ctx = server.sessionContext(w, r, token)
+		}
+		if ctx == nil {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// The method of authenticating a request with the access token of a session, returns the context with the user and the session
+// or nil after responding with 401
+func (server *Server) sessionContext(w http.ResponseWriter, r *http.Request, token string) context.Context {
+	claims, errClaims := getClaimsByJWT(token, server.Keys, server.Tokens)
+	if errClaims != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Printf("AuthMiddleware getClaimsByJWT %s %s err: %s", r.Method, r.URL.Path, errClaims)
+		return nil
+	}
+	user, errUser := server.MemServ.UserRepo.GetByID(claims.User.ID)
+	if errUser != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Printf("AuthMiddleware UserRepo GetByID %s %s err: %s", r.Method, r.URL.Path, errUser)
+		return nil
+	}
+	if user.Banned {
+		writeError(w, "AuthMiddleware", http.StatusForbidden, ErrUserBanned.Error())
+		return nil
+	}
+	session, errSession := server.MemServ.SessionRepo.GetByID(claims.SessionID)
+	if errSession != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Printf("AuthMiddleware SessionRepo GetByID %s %s err: %s", r.Method, r.URL.Path, errSession)
+		return nil
+	}
+	now := time.Now()
+	if !sessionValid(session, user, now) {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Printf("AuthMiddleware %s %s: session of user %s is not valid", r.Method, r.URL.Path, user.ID)
+		return nil
+	}
+	server.touchSession(session, now)
+
+	return context.WithValue(WithUser(r.Context(), user), sessionContextKey, session)
+}
+
+// The method of authenticating a request with a personal access token that must have one of the scopes, returns the context with the user
+// and the token or nil after responding with 401 or 403
+func (server *Server) accessTokenContext(w http.ResponseWriter, r *http.Request, value string, scopes []string) context.Context {
+	if len(scopes) == 0 {
+		writeError(w, "AuthMiddleware", http.StatusForbidden, ErrAccessTokenForbidden.Error())
+		return nil
+	}
+	now := time.Now()
+	token, user, err := server.authenticateAccessToken(value, now)
+	if errors.Is(err, ErrAccessTokenInvalid) {
+		writeError(w, "AuthMiddleware", http.StatusUnauthorized, err.Error())
+		return nil
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("AuthMiddleware authenticateAccessToken %s %s err: %s", r.Method, r.URL.Path, err)
+		return nil
+	}
+	if user.Banned {
+		writeError(w, "AuthMiddleware", http.StatusForbidden, ErrUserBanned.Error())
+		return nil
+	}
+	if !slices.ContainsFunc(scopes, token.HasScope) {
+		writeError(w, "AuthMiddleware", http.StatusForbidden, ErrAccessTokenScope.Error())
+		return nil
+	}
+	server.touchAccessToken(token, now)
+
+	return context.WithValue(WithUser(r.Context(), user), accessTokenContextKey, token)
+}
+
+// VerifiedEmailMiddleware - a middleware of the routes that add content, it goes after AuthMiddleware or ScopedAuthMiddleware.
+// When the unverified accounts are restricted by the config, requests of users without a verified email are answered with 403
+// before the handler runs
+func (server *Server) VerifiedEmailMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.Verification.RestrictUnverified {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user := requestUser(w, r)
+		if user == nil {
+			return
+		}
+		if !user.EmailVerified {
+			writeError(w, "VerifiedEmailMiddleware", http.StatusForbidden, ErrEmailNotVerified.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The function of putting the authenticated user in the context
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// The function of getting the user put in the context by AuthMiddleware, ok is false for an anonymous request
+func UserFromContext(ctx context.Context) (user *models.User, ok bool) {
+	user, ok = ctx.Value(userContextKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// The function of getting the session put in the context by AuthMiddleware, ok is false for an anonymous request
+func SessionFromContext(ctx context.Context) (session *models.Session, ok bool) {
+	session, ok = ctx.Value(sessionContextKey).(*models.Session)
+	return session, ok && session != nil
+}
+
+// The function of getting the user of a request to a protected route, responds with 401 and returns nil
+// if the route was registered without AuthMiddleware and the request is anonymous
+func requestUser(w http.ResponseWriter, r *http.Request) *models.User {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+	return user
+}
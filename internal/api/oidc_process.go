@@ -0,0 +1,278 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/oidc"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Settings of the login with the external identity providers
+const (
+	oidcStateCookie       = "oidc_state"
+	oidcStateLifetime     = 10 * time.Minute
+	oidcAudienceSuffix    = "#oidc" // the state is signed for its own audience, so it is never taken for an access token
+	oidcRequestTimeout    = 10 * time.Second
+	oidcUsernameAttempts  = 5
+	oidcUsernameSuffixLen = 5 // "-" and 4 hex characters added to a taken username
+)
+
+// The scopes requested when the config of the provider has none
+var defaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// The names of the providers, they are a part of the URLs of the login
+var oidcProviderNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Errors related to the login with the external identity providers
+var (
+	ErrInvalidProviderName = errors.New("provider name must consist of lowercase letters, digits, _ and -")
+	ErrIncompleteProvider  = errors.New("provider must have issuer, clientID and redirectURL")
+	ErrInvalidOIDCState    = errors.New("login state is invalid or expired, start the login again")
+	ErrNoUsername          = errors.New("no free username for the external identity")
+)
+
+// Structure of the "oidc" section of the config, the providers by their names
+type OIDCConfig struct {
+	Providers map[string]OIDCProviderConfig `json:"providers"`
+}
+
+// Structure of the settings of an OpenID Connect provider in the config
+type OIDCProviderConfig struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"clientID"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURL  string   `json:"redirectURL"` // the callback of this server, /api/oidc/{PROVIDER}/callback, registered at the provider
+	Scopes       []string `json:"scopes"`
+	LinkByEmail  bool     `json:"linkByEmail"` // a verified email of the provider logs into the account with the same verified email
+}
+
+// OIDCProvider - a configured OpenID Connect provider of the server
+type OIDCProvider struct {
+	*oidc.Provider
+	linkByEmail  bool
+	secureCookie bool
+}
+
+// The claims of the state of a login kept in a cookie between the redirect to the provider and the callback
+type oidcStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// The function of creating the providers of the "oidc" section of the config
+func newOIDCProviders(config OIDCConfig) (map[string]*OIDCProvider, error) {
+	client := &http.Client{Timeout: oidcRequestTimeout}
+	providers := make(map[string]*OIDCProvider, len(config.Providers))
+	for name, providerConfig := range config.Providers {
+		if !oidcProviderNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidProviderName, name)
+		}
+		if providerConfig.Issuer == "" || providerConfig.ClientID == "" || providerConfig.RedirectURL == "" {
+			return nil, fmt.Errorf("%w: %s", ErrIncompleteProvider, name)
+		}
+		redirectURL, err := url.Parse(providerConfig.RedirectURL)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s redirectURL: %w", name, err)
+		}
+		scopes := providerConfig.Scopes
+		if len(scopes) == 0 {
+			scopes = defaultOIDCScopes
+		}
+		providers[name] = &OIDCProvider{
+			Provider: oidc.NewProvider(oidc.Config{
+				Issuer:       providerConfig.Issuer,
+				ClientID:     providerConfig.ClientID,
+				ClientSecret: providerConfig.ClientSecret,
+				RedirectURL:  providerConfig.RedirectURL,
+				Scopes:       scopes,
+			}, client),
+			linkByEmail:  providerConfig.LinkByEmail,
+			secureCookie: redirectURL.Scheme == "https",
+		}
+	}
+	return providers, nil
+}
+
+// The method of starting a login with the provider: returns the URL of the provider to send the user to
+// and the cookie keeping the state, the nonce and the PKCE verifier of the login until the callback
+func (server *Server) startOIDCLogin(r *http.Request, name string, provider *OIDCProvider) (string, *http.Cookie, error) {
+	state, err := GenerateID()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := GenerateID()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		return "", nil, err
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	signed, err := server.Keys.sign(oidcStateClaims{
+		Provider: name,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    server.Tokens.Issuer,
+			Audience:  jwt.ClaimStrings{server.Tokens.Audience + oidcAudienceSuffix},
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateLifetime)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return authURL, oidcCookie(signed, int(oidcStateLifetime/time.Second), provider.secureCookie), nil
+}
+
+// The function of building the state cookie, it is only sent back to the callbacks and only on the top-level redirect
+func oidcCookie(value string, maxAge int, secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// The method of checking the state cookie of the callback against the provider and the state the provider sent back,
+// returns the claims of the login
+func (server *Server) parseOIDCState(r *http.Request, name string) (*oidcStateClaims, error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+	claims := &oidcStateClaims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, claims, server.Keys.keyFunc,
+		parserOptions(server.Keys, server.Tokens, server.Tokens.Audience+oidcAudienceSuffix)...)
+	if err != nil || claims.Provider != name || claims.State == "" || claims.State != r.URL.Query().Get("state") {
+		return nil, ErrInvalidOIDCState
+	}
+	return claims, nil
+}
+
+// The method of finishing the login with the provider: exchanges the code for the ID token, checks it with the nonce of the login
+// and returns the user of the identity
+func (server *Server) finishOIDCLogin(r *http.Request, name string, provider *OIDCProvider, state *oidcStateClaims, code string) (*models.User, error) {
+	rawIDToken, err := provider.Exchange(r.Context(), code, state.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.Verify(r.Context(), rawIDToken, state.Nonce, server.Tokens.ClockSkew)
+	if err != nil {
+		return nil, err
+	}
+	return server.oidcUser(name, provider, claims)
+}
+
+// The method of getting the user of an identity at the provider. An identity seen before logs into its user, a new one is linked
+// to the user with the same verified email if the provider allows it, otherwise a new user is created for it
+func (server *Server) oidcUser(name string, provider *OIDCProvider, claims *oidc.Claims) (*models.User, error) {
+	identity, err := server.MemServ.IdentRepo.Get(name, claims.Subject)
+	if err == nil {
+		return server.MemServ.UserRepo.GetByID(identity.UserID)
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// Only the emails the provider has verified are trusted
+	var email string
+	if claims.EmailVerified {
+		email, _ = normalizeEmail(claims.Email)
+	}
+	var user *models.User
+	if provider.linkByEmail && email != "" {
+		user, err = server.MemServ.UserRepo.GetByEmail(email)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, err
+		}
+	}
+	if user == nil {
+		if user, err = server.createOIDCUser(claims, email); err != nil {
+			return nil, err
+		}
+	}
+
+	err = server.MemServ.IdentRepo.Create(&models.Identity{
+		Provider: name,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Created:  time.Now(),
+	})
+	// A login of the same identity at the same time has linked it first
+	if errors.Is(err, repository.ErrIdentityAlreadyExists) {
+		if identity, err = server.MemServ.IdentRepo.Get(name, claims.Subject); err != nil {
+			return nil, err
+		}
+		return server.MemServ.UserRepo.GetByID(identity.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// The method of creating a user for a new identity. The user has no password, it logs in with the provider or sets a password
+// with a reset sent to its email. The verified email of the provider is taken unless another account has verified it
+func (server *Server) createOIDCUser(claims *oidc.Claims, email string) (*models.User, error) {
+	userID, err := GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{ID: userID, Email: email, EmailVerified: email != ""}
+
+	emailName, _, _ := strings.Cut(email, "@")
+	base := server.Policy.suggestUsername(oidcUsernameSuffixLen, claims.PreferredUsername, emailName, claims.Name)
+	for attempt := 0; attempt < oidcUsernameAttempts; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			suffix := make([]byte, (oidcUsernameSuffixLen-1)/2)
+			if _, err := rand.Read(suffix); err != nil {
+				return nil, err
+			}
+			user.Username = base + "-" + hex.EncodeToString(suffix)
+		}
+		if server.Policy.checkUsername(user.Username) != "" {
+			continue
+		}
+		err := server.MemServ.UserRepo.Create(user)
+		if errors.Is(err, repository.ErrEmailTaken) {
+			// Another account has verified the email, the user is created without it under the same username
+			user.Email, user.EmailVerified = "", false
+			err = server.MemServ.UserRepo.Create(user)
+		}
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, ErrNoUsername
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/oidc/oidctest"
+)
+
+// The function of starting a server with two providers of the test provider: "linked" links the identities by the verified emails,
+// "plain" always creates new users
+func newOIDCTestServer(t *testing.T) (*testServer, *oidctest.Provider) {
+	t.Helper()
+	mock, err := oidctest.NewProvider("redditclone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	provider := func(name string, linkByEmail bool) map[string]any {
+		return map[string]any{
+			"issuer":      mock.Issuer(),
+			"clientID":    "redditclone",
+			"redirectURL": "http://localhost/api/oidc/" + name + "/callback",
+			"linkByEmail": linkByEmail,
+		}
+	}
+	ts := newTestServer(t, map[string]any{"oidc": map[string]any{"providers": map[string]any{
+		"linked": provider("linked", true),
+		"plain":  provider("plain", false),
+	}}})
+	return ts, mock
+}
+
+// The method of starting a login with the provider, returns the authorization URL the user is redirected to and the state cookie
+func (ts *testServer) startOIDC(provider string) (string, *http.Cookie) {
+	ts.t.Helper()
+	response := ts.expect(http.StatusFound, "GET", "/api/oidc/"+provider+"/login", "", nil)
+	cookies := response.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly {
+		ts.t.Fatalf("unexpected cookies %v", cookies)
+	}
+	return response.Header().Get("Location"), cookies[0]
+}
+
+// The method of sending the callback URL of the provider to the server with the state cookie
+func (ts *testServer) oidcCallback(callback string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	parsed, err := url.Parse(callback)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	request := httptest.NewRequest("GET", parsed.RequestURI(), nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	ts.Router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// The method of logging the identity in with the provider, returns the response of the callback
+func (ts *testServer) loginOIDC(mock *oidctest.Provider, provider string, identity oidctest.Identity) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	authURL, cookie := ts.startOIDC(provider)
+	callback, err := mock.Authorize(authURL, identity)
+	if err != nil {
+		ts.t.Fatalf("authorizing %s: %s", authURL, err)
+	}
+	return ts.oidcCallback(callback, cookie)
+}
+
+// The method of getting the username of the user the tokens of the response belong to
+func (ts *testServer) tokenUsername(response *httptest.ResponseRecorder) string {
+	ts.t.Helper()
+	if response.Code != http.StatusOK {
+		ts.t.Fatalf("login status %d, body %s", response.Code, response.Body.String())
+	}
+	var tokens TokenResponse
+	decodeResponse(ts.t, response, &tokens)
+	claims, err := getClaimsByJWT(tokens.Token, ts.Keys, ts.Tokens)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return claims.User.Username
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	ts, mock := newOIDCTestServer(t)
+	identity := oidctest.Identity{Subject: "subject", Email: "Carol@Example.com", EmailVerified: true, PreferredUsername: "carol"}
+
+	authURL, _ := ts.startOIDC("plain")
+	query, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Query().Get("code_challenge_method") != "S256" || query.Query().Get("nonce") == "" {
+		t.Fatalf("authorization URL %s has no PKCE challenge or nonce", authURL)
+	}
+
+	if username := ts.tokenUsername(ts.loginOIDC(mock, "plain", identity)); username != "carol" {
+		t.Fatalf("logged in as %q, want a new user carol", username)
+	}
+	user, err := ts.MemServ.UserRepo.GetByUsername("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "carol@example.com" || !user.EmailVerified || user.Password != "" {
+		t.Fatalf("unexpected new user %+v", user)
+	}
+
+	// The next login of the identity logs into the same user, a taken username gets a suffix for another identity
+	if username := ts.tokenUsername(ts.loginOIDC(mock, "plain", identity)); username != "carol" {
+		t.Fatalf("second login as %q", username)
+	}
+	other := oidctest.Identity{Subject: "other", PreferredUsername: "carol"}
+	if username := ts.tokenUsername(ts.loginOIDC(mock, "plain", other)); username == "carol" {
+		t.Fatal("another identity logged into the user of the first one")
+	}
+}
+
+func TestOIDCLinkByEmail(t *testing.T) {
+	ts, mock := newOIDCTestServer(t)
+	response := ts.expect(http.StatusCreated, "POST", "/api/register", "",
+		Credentials{Username: "bob", Password: testPassword, Email: "bob@example.com"})
+	var tokens TokenResponse
+	decodeResponse(t, response, &tokens)
+	_, token := ts.linkToken("verify-email")
+	ts.expect(http.StatusOK, "POST", "/api/user/email/verify", "", TokenData{Token: token})
+
+	tests := []struct {
+		name     string
+		provider string
+		identity oidctest.Identity
+		linked   bool
+	}{
+		{name: "verified email of the linking provider", provider: "linked", linked: true,
+			identity: oidctest.Identity{Subject: "bob-second", Email: "BOB@example.com", EmailVerified: true}},
+		{name: "email not verified by the provider", provider: "linked",
+			identity: oidctest.Identity{Subject: "bob-unverified", Email: "bob@example.com", PreferredUsername: "robert"}},
+		{name: "provider without linking", provider: "plain",
+			identity: oidctest.Identity{Subject: "bob-plain", Email: "bob@example.com", EmailVerified: true, PreferredUsername: "robert"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			username := ts.tokenUsername(ts.loginOIDC(mock, test.provider, test.identity))
+			if test.linked != (username == "bob") {
+				t.Fatalf("logged in as %q, linked %t", username, test.linked)
+			}
+			if !test.linked {
+				user, err := ts.MemServ.UserRepo.GetByUsername(username)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The email verified by bob is not taken by the new user
+				if user.Email != "" {
+					t.Fatalf("new user took the email %q", user.Email)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	ts, mock := newOIDCTestServer(t)
+	identity := oidctest.Identity{Subject: "subject", PreferredUsername: "dave"}
+
+	tests := []struct {
+		name     string
+		tamper   func(claims jwt.MapClaims)
+		callback func(callback string) string
+		cookie   func(cookie *http.Cookie) *http.Cookie
+		status   int
+	}{
+		{name: "state mismatch", status: http.StatusUnauthorized, callback: func(callback string) string {
+			parsed, _ := url.Parse(callback)
+			query := parsed.Query()
+			query.Set("state", "forged")
+			parsed.RawQuery = query.Encode()
+			return parsed.String()
+		}},
+		{name: "without the state cookie", status: http.StatusUnauthorized, cookie: func(*http.Cookie) *http.Cookie { return nil }},
+		{name: "changed state cookie", status: http.StatusUnauthorized, cookie: func(cookie *http.Cookie) *http.Cookie {
+			return &http.Cookie{Name: cookie.Name, Value: cookie.Value + "x"}
+		}},
+		{name: "bad nonce", status: http.StatusUnauthorized, tamper: func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }},
+		{name: "wrong issuer", status: http.StatusUnauthorized, tamper: func(claims jwt.MapClaims) { claims["iss"] = "https://elsewhere.example" }},
+		{name: "wrong audience", status: http.StatusUnauthorized, tamper: func(claims jwt.MapClaims) { claims["aud"] = "other-client" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.SetTamper(test.tamper)
+			defer mock.SetTamper(nil)
+			authURL, cookie := ts.startOIDC("plain")
+			callback, err := mock.Authorize(authURL, identity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.callback != nil {
+				callback = test.callback(callback)
+			}
+			if test.cookie != nil {
+				cookie = test.cookie(cookie)
+			}
+			if response := ts.oidcCallback(callback, cookie); response.Code != test.status {
+				t.Fatalf("status %d, want %d, body %s", response.Code, test.status, response.Body.String())
+			}
+		})
+	}
+	if _, err := ts.MemServ.UserRepo.GetByUsername("dave"); err == nil {
+		t.Fatal("a rejected login created the user")
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/ranking"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Limits of the size of a page of posts
+const (
+	defaultPageLimit = 25
+	maxPageLimit     = 100
+)
+
+// Errors related to the pagination parameters
+var (
+	ErrInvalidLimit   = errors.New("limit must be an integer from 1 to 100")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrBothCursors    = errors.New("after and before can not be used together")
+	ErrSortNotPagable = errors.New("only sort=new can be paginated")
+)
+
+// PostPageResponse - a page of posts together with the cursors of the neighbouring pages, an empty cursor means there is no such page
+type PostPageResponse struct {
+	Posts []models.Post `json:"posts"`
+	Next  string        `json:"next,omitempty"`
+	Prev  string        `json:"prev,omitempty"`
+}
+
+// The content of an opaque cursor
+type cursorPayload struct {
+	Created int64  `json:"c"`
+	ID      string `json:"i"`
+}
+
+// The function of checking that the request asks for a page of posts instead of the whole listing
+func isPageRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("limit") || query.Has("after") || query.Has("before")
+}
+
+// The function of encoding the position of the post into an opaque cursor
+func encodeCursor(post models.Post) string {
+	data, _ := json.Marshal(cursorPayload{Created: post.Created.UnixNano(), ID: post.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// The function of decoding an opaque cursor, returns ErrInvalidCursor if the cursor was not made by encodeCursor
+func decodeCursor(cursor string) (*repository.PostCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &repository.PostCursor{Created: time.Unix(0, payload.Created), ID: payload.ID}, nil
+}
+
+// The function of reading the limit, after and before query parameters into the query.
+// Pages are always ordered from newer to older posts, so any sort other than new is rejected
+func parsePageQuery(r *http.Request, query *repository.PostQuery) error {
+	values := r.URL.Query()
+	if values.Has("sort") && values.Get("sort") != string(ranking.SortNew) {
+		return ErrSortNotPagable
+	}
+
+	query.Limit = defaultPageLimit
+	if values.Has("limit") {
+		limit, err := strconv.Atoi(values.Get("limit"))
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return ErrInvalidLimit
+		}
+		query.Limit = limit
+	}
+
+	if values.Has("after") && values.Has("before") {
+		return ErrBothCursors
+	}
+	var err error
+	if values.Has("after") {
+		query.After, err = decodeCursor(values.Get("after"))
+	} else if values.Has("before") {
+		query.Before, err = decodeCursor(values.Get("before"))
+	}
+	return err
+}
+
+// The common part of the listing handlers for paginated requests: reads the page selected by the filter of the query
+// and the pagination parameters, and writes it with the cursors of the neighbouring pages. handlerName is used in the log messages
+func (server *Server) servePostPage(w http.ResponseWriter, r *http.Request, handlerName string, query repository.PostQuery) {
+	if err := parsePageQuery(r, &query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := server.MemServ.PostRepo.GetPage(query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("%s PostRepo GetPage err: %s", handlerName, err)
+		return
+	}
+	if err := server.fillPosts(page.Posts); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("%s fillPosts err: %s", handlerName, err)
+		return
+	}
+
+	response := PostPageResponse{Posts: page.Posts}
+	if len(page.Posts) > 0 {
+		first, last := page.Posts[0], page.Posts[len(page.Posts)-1]
+		// HasMore refers to the direction of the query, the opposite direction has posts whenever a cursor was given
+		if query.Before != nil {
+			response.Next = encodeCursor(last)
+			if page.HasMore {
+				response.Prev = encodeCursor(first)
+			}
+		} else {
+			if query.After != nil {
+				response.Prev = encodeCursor(first)
+			}
+			if page.HasMore {
+				response.Next = encodeCursor(last)
+			}
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("%s Encode page err: %s", handlerName, err)
+	}
+}
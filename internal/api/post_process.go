@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/ranking"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// The method of filling the post with its votes, comments and rating from their repositories
+func (server *Server) fillPost(post *models.Post) error {
+	votes, err := server.MemServ.VoteRepo.GetByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+	rating, err := server.MemServ.VoteRepo.GetRating(post.ID)
+	if err != nil {
+		return err
+	}
+	comments, err := server.MemServ.CommentRepo.GetByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+
+	post.Votes = votes
+	post.Comments = comments
+	post.Score = rating.Score
+	post.UpvotePercentage = rating.UpvotePercentage
+	return nil
+}
+
+// The method of filling every post of the slice with its votes, comments and rating
+func (server *Server) fillPosts(posts []models.Post) error {
+	for index := range posts {
+		if err := server.fillPost(&posts[index]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The function of ordering the filled posts by the sort query parameter (hot, new, top, controversial, best),
+// top also accepts the t parameter (hour, day, week, month, year, all). Without sort the order of the repository is kept
+func sortPosts(r *http.Request, posts []models.Post) ([]models.Post, error) {
+	query := r.URL.Query()
+	if !query.Has("sort") {
+		return posts, nil
+	}
+	sortBy, err := ranking.ParseSort(query.Get("sort"))
+	if err != nil {
+		return nil, err
+	}
+	if sortBy == ranking.SortTop {
+		window, err := ranking.ParseWindow(query.Get("t"))
+		if err != nil {
+			return nil, err
+		}
+		posts = ranking.FilterWindow(posts, window, time.Now())
+	}
+	ranking.Rank(posts, sortBy)
+	return posts, nil
+}
+
+// The function of ordering the comments of a post by the sort query parameter (hot, new, top, controversial, best),
+// replies are ordered among their siblings and follow their parent. Without sort the order in which they were added is kept
+func sortComments(r *http.Request, comments []models.Comment) error {
+	query := r.URL.Query()
+	if !query.Has("sort") {
+		return nil
+	}
+	sortBy, err := ranking.ParseSort(query.Get("sort"))
+	if err != nil {
+		return err
+	}
+	ranking.RankComments(comments, sortBy)
+	return nil
+}
+
+// The common part of the vote handlers: value 1 is an upvote, -1 is a downvote and 0 cancels the vote of the user.
+// handlerName is used in the log messages
+func (server *Server) votePost(w http.ResponseWriter, r *http.Request, handlerName string, value int) {
+	vars := mux.Vars(r)
+
+	postID, ok := vars["POST_ID"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+
+	// The vote is changed under the lock of the repository, the returned post already contains the new votes and rating
+	post, err := server.MemServ.PostRepo.ApplyVote(postID, user.ID, value)
+	if errors.Is(err, repository.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("%s PostRepo ApplyVote err: %s", handlerName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if post.Comments, err = server.MemServ.CommentRepo.GetByPostID(postID); err != nil {
+		log.Printf("%s CommentRepo GetByPostID err: %s", handlerName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(post); err != nil {
+		log.Printf("%s Encode post err: %s", handlerName, err)
+	}
+}
+
+// The common part of the comment vote handlers: value 1 is an upvote, -1 is a downvote and 0 cancels the vote of the user.
+// Responds with the whole post like the post vote handlers, handlerName is used in the log messages
+func (server *Server) voteComment(w http.ResponseWriter, r *http.Request, handlerName string, value int) {
+	vars := mux.Vars(r)
+
+	postID, okPostID := vars["POST_ID"]
+	commentID, okCommentID := vars["COMMENT_ID"]
+	if !okPostID || !okCommentID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user := requestUser(w, r)
+	if user == nil {
+		return
+	}
+
+	post, err := server.MemServ.PostRepo.GetByID(postID)
+	if errors.Is(err, repository.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("%s PostRepo GetByID err: %s", handlerName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = server.MemServ.CommentRepo.ApplyVote(postID, commentID, user.ID, value)
+	if errors.Is(err, repository.ErrCommentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("%s CommentRepo ApplyVote err: %s", handlerName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := server.fillPost(post); err != nil {
+		log.Printf("%s fillPost err: %s", handlerName, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(post); err != nil {
+		log.Printf("%s Encode post err: %s", handlerName, err)
+	}
+}
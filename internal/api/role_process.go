@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// The longest category a role can be limited to
+const maxRoleCategoryLength = 64
+
+// Errors related to the moderation
+var (
+	ErrUserBanned          = errors.New("user is banned")
+	ErrPostLocked          = errors.New("post is locked")
+	ErrAdminNotRegistered  = errors.New("admin of the config is not registered and has no passwordHash")
+	ErrInvalidPasswordHash = errors.New("passwordHash of the admin is not a bcrypt hash")
+)
+
+// Structure of the "roles" section of the config
+type RoleConfig struct {
+	Admins []AdminConfig `json:"admins"` // the users made admins at the startup
+}
+
+// Structure of an admin of the "roles" section, written as the username alone or as an object with the bcrypt hash
+// of the password the account is created with if the user is not registered
+type AdminConfig struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"passwordHash"`
+}
+
+// The method of reading an admin of the config written as the username alone or as an object
+func (admin *AdminConfig) UnmarshalJSON(data []byte) error {
+	var username string
+	if err := json.Unmarshal(data, &username); err == nil {
+		*admin = AdminConfig{Username: username}
+		return nil
+	}
+	type adminObject AdminConfig
+	return json.Unmarshal(data, (*adminObject)(admin))
+}
+
+// RoleResponse - a role of a user in the list of roles
+type RoleResponse struct {
+	Username string `json:"username"`
+	models.RoleGrant
+}
+
+// The function of making the users of the config admins. An admin that is not registered is created with the password hash
+// of the config, without the hash ErrAdminNotRegistered is returned, so that no role waits for whoever registers the name first.
+// Removing a user from the config does not revoke its role
+func bootstrapAdmins(users repository.UserRepository, roles repository.RoleRepository, admins []AdminConfig, now time.Time) error {
+	for _, admin := range admins {
+		user, err := users.GetByUsername(admin.Username)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			user, err = createAdminAccount(users, admin)
+		}
+		if err != nil {
+			return err
+		}
+		err = roles.Grant(&models.RoleGrant{UserID: user.ID, Role: models.RoleAdmin, Created: now})
+		if errors.Is(err, repository.ErrRoleAlreadyGranted) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("bootstrapAdmins: user %s is made admin", admin.Username)
+	}
+	return nil
+}
+
+// The function of creating the account of an admin of the config that is not registered, with the password hash of the config
+func createAdminAccount(users repository.UserRepository, admin AdminConfig) (*models.User, error) {
+	if admin.PasswordHash == "" {
+		return nil, fmt.Errorf("%w: %s", ErrAdminNotRegistered, admin.Username)
+	}
+	if !validPasswordHash(admin.PasswordHash) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPasswordHash, admin.Username)
+	}
+	userID, err := GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{ID: userID, Username: admin.Username, Password: admin.PasswordHash}
+	if err := users.Create(user); err != nil {
+		return nil, err
+	}
+	log.Printf("bootstrapAdmins: user %s is created", admin.Username)
+	return user, nil
+}
+
+// The function of validating a role and its category, the admins are only granted on the whole site
+func validateRole(role, category string) []FieldError {
+	var problems []FieldError
+	if !slices.Contains(models.Roles, role) {
+		problems = append(problems, FieldError{Location: "params", Param: "role", Value: role,
+			Msg: "must be one of " + strings.Join(models.Roles, ", ")})
+	}
+	switch {
+	case role == models.RoleAdmin && category != "":
+		problems = append(problems, FieldError{Location: "query", Param: "category", Value: category, Msg: "can not be set for admin"})
+	case len([]rune(category)) > maxRoleCategoryLength:
+		problems = append(problems, FieldError{Location: "query", Param: "category", Value: category, Msg: "is too long"})
+	}
+	return problems
+}
+
+// The method of banning or unbanning the user. A ban revokes every session and personal access token of the user,
+// so that it is logged out everywhere at once
+func (server *Server) setBanned(user *models.User, banned bool) error {
+	if err := server.MemServ.UserRepo.SetBanned(user.ID, banned); err != nil {
+		return err
+	}
+	user.Banned = banned
+	if !banned {
+		return nil
+	}
+	if err := server.MemServ.SessionRepo.DeleteByUserID(user.ID); err != nil {
+		return err
+	}
+	return server.MemServ.AccessRepo.DeleteByUserID(user.ID)
+}
+
+// The method of getting the roles of all users with their usernames, the roles of deleted users are skipped
+func (server *Server) listRoles() ([]RoleResponse, error) {
+	grants, err := server.MemServ.RoleRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	response := make([]RoleResponse, 0, len(grants))
+	for _, grant := range grants {
+		user, err := server.MemServ.UserRepo.GetByID(grant.UserID)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, RoleResponse{Username: user.Username, RoleGrant: grant})
+	}
+	slices.SortFunc(response, func(a, b RoleResponse) int {
+		if c := strings.Compare(a.Username, b.Username); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Role, b.Role); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Category, b.Category)
+	})
+	return response, nil
+}
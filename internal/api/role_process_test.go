@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+func TestAdminConfigUnmarshal(t *testing.T) {
+	var config RoleConfig
+	if err := json.Unmarshal([]byte(`{"admins": ["alice", {"username": "root", "passwordHash": "hash"}]}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	want := []AdminConfig{{Username: "alice"}, {Username: "root", PasswordHash: "hash"}}
+	if len(config.Admins) != len(want) || config.Admins[0] != want[0] || config.Admins[1] != want[1] {
+		t.Fatalf("admins %+v, want %+v", config.Admins, want)
+	}
+}
+
+func TestBootstrapAdmins(t *testing.T) {
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		admins []AdminConfig
+		err    error
+	}{
+		{name: "registered user", admins: []AdminConfig{{Username: "alice"}}},
+		{name: "registered user with a hash", admins: []AdminConfig{{Username: "alice", PasswordHash: hash}}},
+		{name: "created from the hash", admins: []AdminConfig{{Username: "root", PasswordHash: hash}}},
+		{name: "not registered without a hash", admins: []AdminConfig{{Username: "mallory"}}, err: ErrAdminNotRegistered},
+		{name: "not a bcrypt hash", admins: []AdminConfig{{Username: "root", PasswordHash: "plain password"}}, err: ErrInvalidPasswordHash},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users := repository.NewMemoryUserRepository()
+			roles := repository.NewMemoryRoleRepository()
+			alice := &models.User{ID: "alice-id", Username: "alice", Password: hash}
+			if err := users.Create(alice); err != nil {
+				t.Fatal(err)
+			}
+
+			err := bootstrapAdmins(users, roles, test.admins, now)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			grants, errGrants := roles.GetAll()
+			if errGrants != nil {
+				t.Fatal(errGrants)
+			}
+			if test.err != nil {
+				if len(grants) != 0 {
+					t.Fatalf("roles %+v granted despite the error", grants)
+				}
+				if _, err := users.GetByUsername(test.admins[0].Username); !errors.Is(err, repository.ErrUserNotFound) {
+					t.Fatalf("account %s created despite the error", test.admins[0].Username)
+				}
+				return
+			}
+
+			user, err := users.GetByUsername(test.admins[0].Username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !CheckPassword(user.Password, testPassword) {
+				t.Fatal("the admin can not log in with the password of the hash")
+			}
+			if len(grants) != 1 || grants[0].UserID != user.ID || grants[0].Role != models.RoleAdmin {
+				t.Fatalf("roles %+v, want admin of %s", grants, user.ID)
+			}
+			// The next startup changes nothing
+			if err := bootstrapAdmins(users, roles, test.admins, now); err != nil {
+				t.Fatalf("second bootstrap: %s", err)
+			}
+		})
+	}
+}
+
+func TestServerBootstrapsAdmins(t *testing.T) {
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, map[string]any{"roles": map[string]any{"admins": []any{map[string]string{"username": "root", "passwordHash": hash}}}})
+	response := ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "root", Password: testPassword})
+	var tokens TokenResponse
+	decodeResponse(t, response, &tokens)
+	ts.expect(http.StatusOK, "GET", "/api/roles", tokens.Token, nil)
+
+	path := writeTestConfig(t, map[string]any{"keyJWT": "secret", "roles": map[string]any{"admins": []string{"mallory"}}})
+	if server := NewServer(":0", path); server != nil {
+		t.Fatal("server started with an admin that is not registered")
+	}
+}
+
+func TestCategoryModeratorOutsideCategory(t *testing.T) {
+	ts := newTestServer(t, nil)
+	alice := ts.register("alice")
+	moderator := ts.register("musicmod")
+	ts.grantRole("musicmod", models.RoleModerator, "music")
+	moderateToken := ts.createAccessToken(moderator, "moderate")
+
+	news := ts.createPost(alice, "news")
+	comment := ts.addComment(alice, news.ID)
+	for _, token := range []string{moderator, moderateToken} {
+		ts.expect(http.StatusForbidden, "PUT", "/api/post/"+news.ID+"/lock", token, LockData{Locked: true})
+		ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+news.ID+"/"+comment.ID, token, nil)
+		ts.expect(http.StatusForbidden, "DELETE", "/api/post/"+news.ID, token, nil)
+	}
+	response := ts.expect(http.StatusOK, "GET", "/api/post/"+news.ID, "", nil)
+	var stored models.Post
+	decodeResponse(t, response, &stored)
+	if stored.Locked || len(stored.Comments) != 1 {
+		t.Fatalf("the post was changed: locked %t, %d comments", stored.Locked, len(stored.Comments))
+	}
+
+	// In the own category the same requests are allowed
+	music := ts.createPost(alice, "music")
+	ts.expect(http.StatusOK, "PUT", "/api/post/"+music.ID+"/lock", moderateToken, LockData{Locked: true})
+	ts.expect(http.StatusOK, "DELETE", "/api/post/"+music.ID, moderator, nil)
+}
+
+func TestBannedUserTokensRefused(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register("bob")
+	tokens := ts.login("bob")
+	accessToken := ts.createAccessToken(tokens.Token, "post", "read")
+	bob, err := ts.MemServ.UserRepo.GetByUsername("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tokens issued before the ban are refused even while their session and the access token still exist
+	if err := ts.MemServ.UserRepo.SetBanned(bob.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	ts.expect(http.StatusForbidden, "GET", "/api/sessions", tokens.Token, nil)
+	ts.expect(http.StatusForbidden, "GET", "/api/sessions", accessToken, nil)
+	ts.expect(http.StatusForbidden, "POST", "/api/posts", accessToken, PostData{Category: "music", Type: "text", Title: "title", Text: "text"})
+	ts.expect(http.StatusForbidden, "POST", "/api/token/refresh", "", RefreshData{RefreshToken: tokens.RefreshToken})
+
+	// The ban through the API also revokes them, so they do not come back with the unban
+	admin := ts.register("admin_user")
+	ts.grantRole("admin_user", models.RoleAdmin, "")
+	ts.expect(http.StatusOK, "PUT", "/api/user/bob/ban", admin, BanData{Banned: true})
+	ts.expect(http.StatusOK, "PUT", "/api/user/bob/ban", admin, BanData{Banned: false})
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", tokens.Token, nil)
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", accessToken, nil)
+	ts.expect(http.StatusUnauthorized, "POST", "/api/token/refresh", "", RefreshData{RefreshToken: tokens.RefreshToken})
+}
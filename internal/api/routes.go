@@ -0,0 +1,70 @@
+package api
+
+import "github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+
+// The method of connecting the api methods to the router of the server
+func (server *Server) RegisterRoutes() {
+	// Public routes are available to anyone, protected routes are only reachable with the valid token of a session.
+	// Reading, writing, voting and moderating routes also take personal access tokens with the read, the post, the vote
+	// and the moderate scopes, verified routes are writing routes that may also require a verified email. Deleting routes take
+	// the tokens with the post or the moderate scope, the handlers check which of them the deletion needs
+	public := server.Router.NewRoute().Subrouter()
+	protected := server.Router.NewRoute().Subrouter()
+	protected.Use(server.AuthMiddleware)
+	reading := server.Router.NewRoute().Subrouter()
+	reading.Use(server.ScopedAuthMiddleware(models.ScopeRead))
+	writing := server.Router.NewRoute().Subrouter()
+	writing.Use(server.ScopedAuthMiddleware(models.ScopePost))
+	verified := writing.NewRoute().Subrouter()
+	verified.Use(server.VerifiedEmailMiddleware)
+	voting := server.Router.NewRoute().Subrouter()
+	voting.Use(server.ScopedAuthMiddleware(models.ScopeVote))
+	deleting := server.Router.NewRoute().Subrouter()
+	deleting.Use(server.ScopedAuthMiddleware(models.ScopePost, models.ScopeModerate))
+	moderating := server.Router.NewRoute().Subrouter()
+	moderating.Use(server.ScopedAuthMiddleware(models.ScopeModerate))
+
+	public.HandleFunc("/api/register", server.RegisterHandler).Methods("POST")                              // registration
+	public.HandleFunc("/api/login", server.LoginHandler).Methods("POST")                                    // login
+	public.HandleFunc("/api/login/2fa", server.LoginTwoFactorHandler).Methods("POST")                       // the second step of the login with two-factor authentication
+	public.HandleFunc("/api/token/refresh", server.RefreshTokenHandler).Methods("POST")                     // exchanging a refresh token for new tokens
+	public.HandleFunc("/api/oidc/{PROVIDER}/login", server.OIDCLoginHandler).Methods("GET")                 // starting a login with an external identity provider
+	public.HandleFunc("/api/oidc/{PROVIDER}/callback", server.OIDCCallbackHandler).Methods("GET")           // the callback of the identity provider
+	public.HandleFunc("/api/password/forgot", server.ForgotPasswordHandler).Methods("POST")                 // requesting a password reset link by email
+	public.HandleFunc("/api/password/reset", server.ResetPasswordHandler).Methods("POST")                   // setting a new password with the token of the link
+	public.HandleFunc("/api/user/email/verify", server.VerifyEmailHandler).Methods("POST")                  // verifying the email with the token of the link
+	public.HandleFunc("/.well-known/jwks.json", server.JWKSHandler).Methods("GET")                          // public keys verifying the tokens
+	public.HandleFunc("/api/posts/", server.GetPostsHandler).Methods("GET")                                 // list of all posts
+	public.HandleFunc("/api/posts/{CATEGORY_NAME}", server.GetPostsByCategory).Methods("GET")               // a list of posts in a specific category
+	public.HandleFunc("/api/post/{POST_ID}", server.GetPostsByID).Methods("GET")                            // details of the post with comments
+	public.HandleFunc("/api/user/{USER_LOGIN}", server.GetPostsByUser).Methods("GET")                       // getting all the posts of a specific user
+	protected.HandleFunc("/api/logout", server.LogoutHandler).Methods("POST")                               // logging out
+	protected.HandleFunc("/api/logout/all", server.LogoutAllHandler).Methods("POST")                        // logging out on all devices
+	reading.HandleFunc("/api/sessions", server.GetSessionsHandler).Methods("GET")                           // list of the sessions of the user
+	protected.HandleFunc("/api/sessions/{SESSION_ID}", server.DeleteSessionHandler).Methods("DELETE")       // revoking a session
+	protected.HandleFunc("/api/user/password", server.ChangePasswordHandler).Methods("PUT")                 // changing the password
+	protected.HandleFunc("/api/user/email", server.ChangeEmailHandler).Methods("PUT")                       // setting the email, a verification link is sent to it
+	protected.HandleFunc("/api/user/email/resend", server.ResendVerificationHandler).Methods("POST")        // sending another verification link
+	protected.HandleFunc("/api/user/2fa/enroll", server.EnrollTwoFactorHandler).Methods("POST")             // starting the enrollment of two-factor authentication
+	protected.HandleFunc("/api/user/2fa/confirm", server.ConfirmTwoFactorHandler).Methods("POST")           // confirming the enrollment
+	protected.HandleFunc("/api/user/2fa", server.DisableTwoFactorHandler).Methods("DELETE")                 // disabling two-factor authentication
+	protected.HandleFunc("/api/tokens", server.CreateAccessTokenHandler).Methods("POST")                    // creating a personal access token
+	reading.HandleFunc("/api/tokens", server.GetAccessTokensHandler).Methods("GET")                         // list of the personal access tokens of the user
+	protected.HandleFunc("/api/tokens/{TOKEN_ID}", server.DeleteAccessTokenHandler).Methods("DELETE")       // revoking a personal access token
+	reading.HandleFunc("/api/roles", server.GetRolesHandler).Methods("GET")                                 // list of the roles of all users
+	protected.HandleFunc("/api/user/{USER_LOGIN}/roles/{ROLE}", server.GrantRoleHandler).Methods("PUT")     // granting a role to a user
+	protected.HandleFunc("/api/user/{USER_LOGIN}/roles/{ROLE}", server.RevokeRoleHandler).Methods("DELETE") // revoking a role of a user
+	verified.HandleFunc("/api/posts", server.PostPostsHandler).Methods("POST")                              // adding a post
+	verified.HandleFunc("/api/post/{POST_ID}", server.AddCommentPost).Methods("POST")                       //  adding a comment
+	verified.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", server.AddCommentPost).Methods("POST")          // replying to a comment
+	deleting.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", server.DeleteCommentPost).Methods("DELETE")     // deleting a comment
+	voting.HandleFunc("/api/post/{POST_ID}/upvote", server.UpvotePost).Methods("GET")                       // the rating of the post is up
+	voting.HandleFunc("/api/post/{POST_ID}/downvote", server.DownvotePost).Methods("GET")                   // the rating of the post is down
+	voting.HandleFunc("/api/post/{POST_ID}/unvote", server.UnvotePost).Methods("GET")                       // voice cancellation
+	deleting.HandleFunc("/api/post/{POST_ID}", server.DeletePost).Methods("DELETE")                         // deleting a post
+	voting.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/upvote", server.UpvoteComment).Methods("GET")       // the rating of the comment is up
+	voting.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/downvote", server.DownvoteComment).Methods("GET")   // the rating of the comment is down
+	voting.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/unvote", server.UnvoteComment).Methods("GET")       // cancelling the vote for the comment
+	moderating.HandleFunc("/api/post/{POST_ID}/lock", server.LockPostHandler).Methods("PUT")                // locking or unlocking a post
+	moderating.HandleFunc("/api/user/{USER_LOGIN}/ban", server.BanUserHandler).Methods("PUT")               // banning or unbanning a user
+}
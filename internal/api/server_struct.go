@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/mail"
 	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
 )
 
@@ -14,18 +17,61 @@ type MemoryService struct {
 	UserRepo    repository.UserRepository
 	SessionRepo repository.SessionRepository
 	PostRepo    repository.PostRepository
+	VoteRepo    repository.VoteRepository
+	CommentRepo repository.CommentRepository
+	TokenRepo   repository.UserTokenRepository    // single-use tokens sent by email
+	IdentRepo   repository.IdentityRepository     // accounts of the users at the external identity providers
+	AccessRepo  repository.AccessTokenRepository  // personal access tokens of the users
+	RoleRepo    repository.RoleRepository         // admins and moderators
+	LoginRepo   repository.LoginAttemptRepository // failed logins, kept in memory by every storage for now
 }
 
 type Server struct {
-	MemServ *MemoryService
-	Router  *mux.Router
-	Addr    string
-	KeyJWT  string
+	MemServ         *MemoryService
+	Router          *mux.Router
+	Addr            string
+	Keys            *KeySet                  // keys signing and verifying the access tokens
+	Policy          *CredentialPolicy        // rules of the usernames and the passwords of the new users
+	Throttle        *LoginThrottle           // delays of the logins after failed attempts
+	TwoFactorIssuer string                   // the name of the service in the otpauth URIs
+	Mailer          mail.Mailer              // sends the password resets and the email verifications
+	MailBaseURL     string                   // address of the frontend the links in the emails lead to
+	Verification    EmailVerificationConfig  // what the accounts without a verified email may do
+	OIDC            map[string]*OIDCProvider // external identity providers by their names
+	Moderator       Moderator                // who besides the authors may delete posts and comments, who may lock posts, ban users and manage roles
+	Tokens          TokenSettings
 }
 
 // Structure for reading JSON
 type Config struct {
-	KeyJWT string `json:"keyJWT"`
+	KeyJWT            string                  `json:"keyJWT"`
+	Signing           SigningConfig           `json:"signing"`
+	Credentials       CredentialConfig        `json:"credentials"`
+	LoginThrottle     LoginThrottleConfig     `json:"loginThrottle"`
+	TwoFactor         TwoFactorConfig         `json:"twoFactor"`
+	Mail              MailConfig              `json:"mail"`
+	EmailVerification EmailVerificationConfig `json:"emailVerification"`
+	OIDC              OIDCConfig              `json:"oidc"`
+	Storage           StorageConfig           `json:"storage"`
+	Roles             RoleConfig              `json:"roles"`
+	Tokens            TokenConfig             `json:"tokens"`
+}
+
+// Structure of the "tokens" section of the config, empty values mean the defaults
+type TokenConfig struct {
+	AccessLifetime  string `json:"accessLifetime"`  // how long an access token is valid, for example "15m"
+	RefreshLifetime string `json:"refreshLifetime"` // how long a session can be refreshed after the login, for example "720h"
+	Issuer          string `json:"issuer"`          // the iss claim of the access tokens
+	Audience        string `json:"audience"`        // the aud claim of the access tokens
+	ClockSkew       string `json:"clockSkew"`       // how far exp, nbf and iat may be off, for example "30s"
+}
+
+// Structure of the "storage" section of the config, an empty driver means storing data in memory
+type StorageConfig struct {
+	Driver           string `json:"driver"`
+	DSN              string `json:"dsn"`              // connection string for postgres
+	Path             string `json:"path"`             // database file for sqlite, journal directory for memory
+	SnapshotInterval string `json:"snapshotInterval"` // how often the memory journals are compacted, for example "5m"
 }
 
 func NewServer(addr, pathConfig string) *Server {
@@ -37,15 +83,83 @@ func NewServer(addr, pathConfig string) *Server {
 		return nil
 	}
 
+	memServ, err := newMemoryService(config.Storage)
+	if err != nil {
+		fmt.Println("Error opening storage:", err)
+		return nil
+	}
+
+	if err := bootstrapAdmins(memServ.UserRepo, memServ.RoleRepo, config.Roles.Admins, time.Now()); err != nil {
+		fmt.Println("Error granting the admins of the config:", err)
+		return nil
+	}
+
+	keys, err := NewKeySet(config.Signing, config.KeyJWT)
+	if err != nil {
+		fmt.Println("Error loading signing keys:", err)
+		return nil
+	}
+
+	policy, err := NewCredentialPolicy(config.Credentials)
+	if err != nil {
+		fmt.Println("Error reading credentials config:", err)
+		return nil
+	}
+
+	throttle, err := NewLoginThrottle(config.LoginThrottle, memServ.LoginRepo)
+	if err != nil {
+		fmt.Println("Error reading loginThrottle config:", err)
+		return nil
+	}
+	// Hashed at startup, so that the first login of an unknown user takes no longer than the others
+	dummyPasswordHash()
+
+	tokens, err := parseTokenConfig(config.Tokens)
+	if err != nil {
+		fmt.Println("Error reading tokens config:", err)
+		return nil
+	}
+
+	twoFactorIssuer := config.TwoFactor.Issuer
+	if twoFactorIssuer == "" {
+		twoFactorIssuer = defaultTwoFactorIssuer
+	}
+
+	mailer, err := newMailer(config.Mail)
+	if err != nil {
+		fmt.Println("Error reading mail config:", err)
+		return nil
+	}
+	mailBaseURL := strings.TrimSuffix(config.Mail.BaseURL, "/")
+	if mailBaseURL == "" {
+		mailBaseURL = defaultMailBaseURL
+	}
+
+	oidcProviders, err := newOIDCProviders(config.OIDC)
+	if err != nil {
+		fmt.Println("Error reading oidc config:", err)
+		return nil
+	}
+
+	go sweepSessions(memServ.SessionRepo, sessionSweepInterval)
+	go sweepLoginAttempts(memServ.LoginRepo, throttle.resetAfter, loginAttemptSweepInterval)
+	go sweepUserTokens(memServ.TokenRepo, userTokenSweepInterval)
+	go sweepAccessTokens(memServ.AccessRepo, accessTokenSweepInterval)
+
 	return &Server{
-		MemServ: &MemoryService{
-			UserRepo:    repository.NewMemoryUserRepository(),
-			SessionRepo: repository.NewMemorySessionRepository(),
-			PostRepo:    repository.NewMemoryPostRepository(),
-		},
-		Router: mux.NewRouter().StrictSlash(true),
-		Addr:   addr,
-		KeyJWT: config.KeyJWT,
+		MemServ:         memServ,
+		Router:          mux.NewRouter().StrictSlash(true),
+		Addr:            addr,
+		Keys:            keys,
+		Policy:          policy,
+		Throttle:        throttle,
+		TwoFactorIssuer: twoFactorIssuer,
+		Mailer:          mailer,
+		MailBaseURL:     mailBaseURL,
+		Verification:    config.EmailVerification,
+		OIDC:            oidcProviders,
+		Moderator:       RoleModerator{Roles: memServ.RoleRepo},
+		Tokens:          tokens,
 	}
 }
 
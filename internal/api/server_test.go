@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/mail/mailtest"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The password of the users registered by the tests
+const testPassword = "pw345678"
+
+// A server built from a config like the real one, with its routes and a mailer that keeps the emails in memory
+type testServer struct {
+	*Server
+	t      *testing.T
+	mailer *mailtest.Recorder
+}
+
+// The function of starting a server with the sections of the config in memory storage, keyJWT is set unless the sections set it
+func newTestServer(t *testing.T, sections map[string]any) *testServer {
+	t.Helper()
+	config := map[string]any{"keyJWT": "secret"}
+	for name, section := range sections {
+		config[name] = section
+	}
+	path := writeTestConfig(t, config)
+
+	server := NewServer(":0", path)
+	if server == nil {
+		t.Fatalf("NewServer failed with the config %v", config)
+	}
+	recorder := mailtest.NewRecorder()
+	server.Mailer = recorder
+	server.RegisterRoutes()
+	return &testServer{Server: server, t: t, mailer: recorder}
+}
+
+// The function of writing the config to a file of a temporary directory, returns the path of the file
+func writeTestConfig(t *testing.T, config map[string]any) string {
+	t.Helper()
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config_server.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The method of sending a request to the router, body is encoded to JSON unless it is nil, token is sent as the bearer token unless it is empty
+func (ts *testServer) request(method, path, token string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	request := httptest.NewRequest(method, path, &reader)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	ts.Router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// The method of sending a request and checking the status of the response
+func (ts *testServer) expect(status int, method, path, token string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	response := ts.request(method, path, token, body)
+	if response.Code != status {
+		ts.t.Fatalf("%s %s: status %d, want %d, body %s", method, path, response.Code, status, response.Body.String())
+	}
+	return response
+}
+
+// The function of decoding the JSON of the response into the value
+func decodeResponse(t *testing.T, response *httptest.ResponseRecorder, value any) {
+	t.Helper()
+	if err := json.Unmarshal(response.Body.Bytes(), value); err != nil {
+		t.Fatalf("decoding %q: %s", response.Body.String(), err)
+	}
+}
+
+// The method of registering the user, returns the access token of its session
+func (ts *testServer) register(username string) string {
+	ts.t.Helper()
+	response := ts.expect(http.StatusCreated, "POST", "/api/register", "", Credentials{Username: username, Password: testPassword})
+	var tokens TokenResponse
+	decodeResponse(ts.t, response, &tokens)
+	return tokens.Token
+}
+
+// The method of adding a text post of the user of the token
+func (ts *testServer) createPost(token, category string) models.Post {
+	ts.t.Helper()
+	data := PostData{Category: category, Type: "text", Title: "title", Text: "text"}
+	response := ts.expect(http.StatusCreated, "POST", "/api/posts", token, data)
+	var post models.Post
+	decodeResponse(ts.t, response, &post)
+	return post
+}
+
+// The method of adding a comment of the user of the token to the post, returns the new comment
+func (ts *testServer) addComment(token, postID string) models.Comment {
+	ts.t.Helper()
+	response := ts.expect(http.StatusCreated, "POST", "/api/post/"+postID, token, CommentData{Comment: "comment"})
+	var post models.Post
+	decodeResponse(ts.t, response, &post)
+	if len(post.Comments) == 0 {
+		ts.t.Fatal("the post has no comments after adding one")
+	}
+	return post.Comments[len(post.Comments)-1]
+}
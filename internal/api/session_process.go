@@ -0,0 +1,248 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// How often the expired sessions are deleted
+const sessionSweepInterval = 10 * time.Minute
+
+// Default settings of the tokens
+const (
+	defaultAccessTokenLifetime  = 15 * time.Minute
+	defaultRefreshTokenLifetime = 30 * 24 * time.Hour
+	defaultTokenIssuer          = "redditclone"
+	defaultTokenAudience        = "redditclone"
+	defaultClockSkew            = 30 * time.Second
+)
+
+// Size of a refresh token in bytes before encoding
+const refreshTokenSize = 32
+
+// How often the last-seen time of a session is written, requests in between do not touch the storage
+const lastSeenResolution = time.Minute
+
+// The longest user agent kept in a session
+const maxUserAgentLength = 256
+
+// Errors related to refreshing the tokens
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session is revoked")
+)
+
+// TokenSettings - how long the access tokens and the sessions that issue them stay valid, the issuer and the audience
+// of the access tokens, and how far the clocks of the servers may drift apart when the times of a token are checked
+type TokenSettings struct {
+	Access    time.Duration
+	Refresh   time.Duration
+	Issuer    string
+	Audience  string
+	ClockSkew time.Duration
+}
+
+// TokenResponse - the tokens issued by the registration, the login and the refresh.
+// The bundled frontend only reads token, the short-lived access token
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // lifetime of the access token in seconds
+}
+
+// The function of reading the settings of the tokens from the config, empty values are replaced with the defaults
+func parseTokenConfig(config TokenConfig) (TokenSettings, error) {
+	settings := TokenSettings{Issuer: defaultTokenIssuer, Audience: defaultTokenAudience}
+	var err error
+	if settings.Access, err = parseDuration(config.AccessLifetime, defaultAccessTokenLifetime); err != nil {
+		return TokenSettings{}, err
+	}
+	if settings.Refresh, err = parseDuration(config.RefreshLifetime, defaultRefreshTokenLifetime); err != nil {
+		return TokenSettings{}, err
+	}
+	if settings.ClockSkew, err = parseDuration(config.ClockSkew, defaultClockSkew); err != nil {
+		return TokenSettings{}, err
+	}
+	if config.Issuer != "" {
+		settings.Issuer = config.Issuer
+	}
+	if config.Audience != "" {
+		settings.Audience = config.Audience
+	}
+	return settings, nil
+}
+
+// The function of parsing a non-negative duration of the config, an empty value is replaced with the fallback
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if parsed < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+	return parsed, nil
+}
+
+// The function of generating an opaque refresh token together with the hash under which it is stored
+func generateRefreshToken() (token, hash string, err error) {
+	bytes := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(bytes)
+	return token, hashRefreshToken(token), nil
+}
+
+// The function of hashing a refresh token, only the hashes are stored so that a leaked storage does not leak the sessions
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionResponse - a session of the user in the list of sessions, Current marks the session of the request
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// The function of getting the IP address of the client of the request without the port
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// The function of getting the user agent of the request, cut to maxUserAgentLength
+func requestUserAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
+
+// The method of starting a new session of the user on the device of the request: stores the session with its refresh token
+// and issues the first access token
+func (server *Server) createSession(user *models.User, r *http.Request) (*TokenResponse, error) {
+	sessionID, err := GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, refreshTokenHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &models.Session{
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: refreshTokenHash,
+		UserAgent:        requestUserAgent(r),
+		IP:               requestIP(r),
+		Created:          now,
+		LastSeen:         now,
+		Expires:          now.Add(server.Tokens.Refresh),
+	}
+	if err := server.MemServ.SessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return server.issueTokens(user, session, refreshToken)
+}
+
+// The method of exchanging a refresh token for a new access token and a new refresh token.
+// Returns ErrRefreshTokenInvalid for an unknown or expired token, ErrUserBanned for a banned user and ErrRefreshTokenReused
+// if the token was already exchanged, in which case the whole session is revoked
+func (server *Server) refreshSession(refreshToken string) (*TokenResponse, error) {
+	newRefreshToken, newRefreshTokenHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session, err := server.MemServ.SessionRepo.Rotate(hashRefreshToken(refreshToken), newRefreshTokenHash, time.Now())
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := server.MemServ.UserRepo.GetByID(session.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// The session outlived its user, it can never be used again
+		if err := server.MemServ.SessionRepo.Delete(session.ID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Banned {
+		return nil, ErrUserBanned
+	}
+	return server.issueTokens(user, session, newRefreshToken)
+}
+
+// The method of issuing an access token of the session and packing it together with the refresh token
+func (server *Server) issueTokens(user *models.User, session *models.Session, refreshToken string) (*TokenResponse, error) {
+	accessToken, err := GenerateToken(user.Username, user.ID, session.ID, server.Tokens, server.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(server.Tokens.Access / time.Second),
+	}, nil
+}
+
+// The function of checking that the session is live: it belongs to the user of the token and has not expired
+func sessionValid(session *models.Session, user *models.User, now time.Time) bool {
+	return session.UserID == user.ID && now.Before(session.Expires)
+}
+
+// The method of recording that the session was used now, the storage is only written once per lastSeenResolution
+func (server *Server) touchSession(session *models.Session, now time.Time) {
+	if now.Sub(session.LastSeen) < lastSeenResolution {
+		return
+	}
+	if err := server.MemServ.SessionRepo.Touch(session.ID, now); err != nil {
+		log.Printf("touchSession SessionRepo Touch err: %s", err)
+		return
+	}
+	session.LastSeen = now
+}
+
+// The function of periodically deleting the expired sessions, it is meant to be run in its own goroutine
+func sweepSessions(sessions repository.SessionRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		deleted, err := sessions.DeleteExpired(now)
+		if err != nil {
+			log.Printf("sweepSessions SessionRepo DeleteExpired err: %s", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("sweepSessions deleted %d expired sessions", deleted)
+		}
+	}
+}
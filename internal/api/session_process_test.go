@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The method of logging the user in with the password, returns the tokens of the new session
+func (ts *testServer) login(username string) TokenResponse {
+	ts.t.Helper()
+	response := ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: username, Password: testPassword})
+	var tokens TokenResponse
+	decodeResponse(ts.t, response, &tokens)
+	return tokens
+}
+
+// The method of exchanging the refresh token for new tokens, returns the response
+func (ts *testServer) refresh(status int, refreshToken string) TokenResponse {
+	ts.t.Helper()
+	response := ts.expect(status, "POST", "/api/token/refresh", "", RefreshData{RefreshToken: refreshToken})
+	var tokens TokenResponse
+	if status == http.StatusOK {
+		decodeResponse(ts.t, response, &tokens)
+	}
+	return tokens
+}
+
+func TestRefreshRotation(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register("alice")
+	first := ts.login("alice")
+
+	// The refresh responds with a new pair, the refresh token it was given stops working
+	second := ts.refresh(http.StatusOK, first.RefreshToken)
+	if second.Token == "" || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh responded %+v, want a new pair", second)
+	}
+	ts.expect(http.StatusOK, "GET", "/api/sessions", second.Token, nil)
+	third := ts.refresh(http.StatusOK, second.RefreshToken)
+
+	// Presenting the rotated token again revokes the whole session: its current tokens stop working
+	ts.refresh(http.StatusUnauthorized, second.RefreshToken)
+	ts.refresh(http.StatusUnauthorized, third.RefreshToken)
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", third.Token, nil)
+
+	// The other sessions of the user are not touched
+	other := ts.login("alice")
+	ts.refresh(http.StatusUnauthorized, first.RefreshToken)
+	ts.expect(http.StatusOK, "GET", "/api/sessions", other.Token, nil)
+	ts.refresh(http.StatusUnauthorized, "unknown")
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.register("alice")
+	first, second, third := ts.login("alice"), ts.login("alice"), ts.login("alice")
+	bob := ts.register("bob")
+
+	// The logout ends only the session of the token
+	ts.expect(http.StatusOK, "POST", "/api/logout", first.Token, nil)
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", first.Token, nil)
+	ts.refresh(http.StatusUnauthorized, first.RefreshToken)
+	ts.expect(http.StatusOK, "GET", "/api/sessions", second.Token, nil)
+
+	// The logout on all devices ends every session of the user and no session of the others
+	ts.expect(http.StatusOK, "POST", "/api/logout/all", second.Token, nil)
+	for _, tokens := range []TokenResponse{second, third} {
+		ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", tokens.Token, nil)
+		ts.refresh(http.StatusUnauthorized, tokens.RefreshToken)
+	}
+	ts.expect(http.StatusOK, "GET", "/api/sessions", bob, nil)
+}
+
+// The method of getting the sessions of the user of the token
+func (ts *testServer) sessions(token string) []SessionResponse {
+	ts.t.Helper()
+	response := ts.expect(http.StatusOK, "GET", "/api/sessions", token, nil)
+	if strings.Contains(response.Body.String(), "refresh") {
+		ts.t.Fatalf("sessions %s show the refresh tokens", response.Body.String())
+	}
+	var sessions []SessionResponse
+	decodeResponse(ts.t, response, &sessions)
+	return sessions
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	first := ts.register("alice")
+	second := ts.login("alice")
+	bob := ts.register("bob")
+
+	// The sessions of the user, only the session of the request is current
+	sessions := ts.sessions(second.Token)
+	if len(sessions) != 2 || sessions[0].Current == sessions[1].Current {
+		t.Fatalf("sessions %+v, want two with one of them current", sessions)
+	}
+	var firstID string
+	for _, session := range sessions {
+		if !session.Current {
+			firstID = session.ID
+		}
+	}
+	if bobSessions := ts.sessions(bob); len(bobSessions) != 1 || bobSessions[0].ID == firstID {
+		t.Fatalf("sessions of bob %+v", bobSessions)
+	}
+
+	// A user can not revoke the session of another user
+	ts.expect(http.StatusNotFound, "DELETE", "/api/sessions/"+firstID, bob, nil)
+	ts.expect(http.StatusOK, "GET", "/api/sessions", first, nil)
+	ts.expect(http.StatusNotFound, "DELETE", "/api/sessions/unknown", second.Token, nil)
+
+	// Revoking another session of the user ends it
+	ts.expect(http.StatusOK, "DELETE", "/api/sessions/"+firstID, second.Token, nil)
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", first, nil)
+	if sessions := ts.sessions(second.Token); len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("sessions after the revocation %+v, want only the current one", sessions)
+	}
+}
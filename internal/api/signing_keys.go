@@ -0,0 +1,229 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The smallest RSA key accepted for signing tokens
+const minRSAKeyBits = 2048
+
+// Errors related to the keys signing the tokens
+var (
+	ErrNoSigningKey       = errors.New("neither keyJWT nor signing keys are configured")
+	ErrNoActiveKey        = errors.New("signing.activeKey must name one of the signing keys")
+	ErrActiveKeyPublic    = errors.New("the active signing key must be a private key")
+	ErrDuplicateKeyID     = errors.New("duplicate signing key id")
+	ErrEmptyKeyID         = errors.New("signing key without kid")
+	ErrInvalidKeyFile     = errors.New("no PEM key found in the file")
+	ErrUnsupportedKeyType = errors.New("only RSA and Ed25519 keys are supported")
+	ErrWeakRSAKey         = errors.New("RSA keys must be at least 2048 bits")
+	ErrUnknownKeyID       = errors.New("unknown key id")
+)
+
+// Structure of the "signing" section of the config. Every key is a PEM file with a private key or, for a key that only
+// verifies the tokens signed before a rotation, a public key. activeKey is the kid of the key signing new tokens
+type SigningConfig struct {
+	ActiveKey string             `json:"activeKey"`
+	Keys      []SigningKeyConfig `json:"keys"`
+}
+
+// Structure of a key in the "signing" section of the config
+type SigningKeyConfig struct {
+	ID   string `json:"kid"`
+	File string `json:"file"` // path to the PEM file, relative to the working directory like the path of the storage
+}
+
+// A key of the key set: the public key verifies the tokens with its kid, the private one is only known for the keys that can sign
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet - the keys the server signs and verifies the access tokens with. New tokens are signed by the active key with its
+// kid in the header, the tokens of every key of the set are accepted, so that a key can be rotated without logging anyone out.
+// The HMAC secret keyJWT only signs the tokens when no asymmetric keys are configured and otherwise only verifies the HS256
+// tokens issued before the migration
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	order  []string // kids in the order of the config
+	secret []byte
+}
+
+// JWK - a public key in the JSON Web Key format
+type JWK struct {
+	KeyType string `json:"kty"`
+	ID      string `json:"kid"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	N       string `json:"n,omitempty"`   // RSA modulus
+	E       string `json:"e,omitempty"`   // RSA public exponent
+	Curve   string `json:"crv,omitempty"` // OKP curve
+	X       string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet - the public keys published at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet constructor, loads the keys of the "signing" section of the config from their PEM files
+func NewKeySet(config SigningConfig, secret string) (*KeySet, error) {
+	keys := &KeySet{keys: make(map[string]*signingKey), secret: []byte(secret)}
+	for _, keyConfig := range config.Keys {
+		if keyConfig.ID == "" {
+			return nil, ErrEmptyKeyID
+		}
+		if _, exists := keys.keys[keyConfig.ID]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKeyID, keyConfig.ID)
+		}
+		key, err := loadSigningKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", keyConfig.ID, err)
+		}
+		keys.keys[key.ID] = key
+		keys.order = append(keys.order, key.ID)
+	}
+
+	if len(keys.keys) == 0 {
+		if len(keys.secret) == 0 {
+			return nil, ErrNoSigningKey
+		}
+		return keys, nil
+	}
+	active, exists := keys.keys[config.ActiveKey]
+	if !exists {
+		return nil, ErrNoActiveKey
+	}
+	if active.Private == nil {
+		return nil, ErrActiveKeyPublic
+	}
+	keys.active = active
+	return keys, nil
+}
+
+// The function of reading a key from its PEM file
+func loadSigningKey(config SigningKeyConfig) (*signingKey, error) {
+	data, err := os.ReadFile(config.File)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKeyFile
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKeyType, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: config.ID}
+	switch parsed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, parsed, &parsed.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, parsed
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, parsed, parsed.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, parsed
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+	if public, ok := key.Public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSAKeyBits {
+		return nil, ErrWeakRSAKey
+	}
+	return key, nil
+}
+
+// The method of signing the claims with the active key, or with the HMAC secret when there are no asymmetric keys
+func (keys *KeySet) sign(claims jwt.Claims) (string, error) {
+	if keys.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(keys.secret)
+	}
+	token := jwt.NewWithClaims(keys.active.Method, claims)
+	token.Header["kid"] = keys.active.ID
+	return token.SignedString(keys.active.Private)
+}
+
+// The method of getting the names of the algorithms the tokens of the set may be signed with
+func (keys *KeySet) methods() []string {
+	var methods []string
+	if len(keys.secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	for _, kid := range keys.order {
+		if alg := keys.keys[kid].Method.Alg(); !slices.Contains(methods, alg) {
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// The method of choosing the key verifying the token, for jwt.ParseWithClaims. An HS256 token is verified with the HMAC secret,
+// any other token with the key of its kid, and only with the algorithm of that key
+func (keys *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if token.Method != jwt.SigningMethodHS256 || len(keys.secret) == 0 {
+			return nil, ErrUnexpectSignMethod
+		}
+		return keys.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, exists := keys.keys[kid]
+	if !exists {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnexpectSignMethod
+	}
+	return key.Public, nil
+}
+
+// The method of getting the public keys of the set in the JWK format, the HMAC secret is never published
+func (keys *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(keys.order))}
+	for _, kid := range keys.order {
+		key := keys.keys[kid]
+		jwk := JWK{ID: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewKeySet(t *testing.T) {
+	keys := newTestKeys(t)
+	dir := t.TempDir()
+	rsaFile, edFile := keys.config.Keys[0].File, keys.config.Keys[1].File
+	publicFile := filepath.Join(dir, "public.pem")
+	if err := os.WriteFile(publicFile, keys.rsaPublicPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakFile := writePEM(t, dir, "weak.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(weakKey))
+	certFile := writePEM(t, dir, "cert.pem", "CERTIFICATE", []byte("certificate"))
+	textFile := filepath.Join(dir, "text.pem")
+	if err := os.WriteFile(textFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config SigningConfig
+		secret string
+		err    error
+	}{
+		{name: "secret only", secret: "secret"},
+		{name: "keys without secret", config: SigningConfig{ActiveKey: "rsa", Keys: []SigningKeyConfig{{ID: "rsa", File: rsaFile}}}},
+		{name: "retired public key", config: SigningConfig{ActiveKey: "ed", Keys: []SigningKeyConfig{{ID: "ed", File: edFile}, {ID: "old", File: publicFile}}}},
+		{name: "nothing configured", err: ErrNoSigningKey},
+		{name: "no active key", config: SigningConfig{Keys: []SigningKeyConfig{{ID: "rsa", File: rsaFile}}}, err: ErrNoActiveKey},
+		{name: "unknown active key", config: SigningConfig{ActiveKey: "ed", Keys: []SigningKeyConfig{{ID: "rsa", File: rsaFile}}}, err: ErrNoActiveKey},
+		{name: "public active key", config: SigningConfig{ActiveKey: "old", Keys: []SigningKeyConfig{{ID: "old", File: publicFile}}}, err: ErrActiveKeyPublic},
+		{name: "duplicate kid", config: SigningConfig{ActiveKey: "rsa", Keys: []SigningKeyConfig{{ID: "rsa", File: rsaFile}, {ID: "rsa", File: edFile}}}, err: ErrDuplicateKeyID},
+		{name: "empty kid", config: SigningConfig{Keys: []SigningKeyConfig{{File: rsaFile}}}, err: ErrEmptyKeyID},
+		{name: "weak RSA key", config: SigningConfig{ActiveKey: "weak", Keys: []SigningKeyConfig{{ID: "weak", File: weakFile}}}, err: ErrWeakRSAKey},
+		{name: "unsupported PEM block", config: SigningConfig{ActiveKey: "cert", Keys: []SigningKeyConfig{{ID: "cert", File: certFile}}}, err: ErrUnsupportedKeyType},
+		{name: "file without PEM", config: SigningConfig{ActiveKey: "text", Keys: []SigningKeyConfig{{ID: "text", File: textFile}}}, err: ErrInvalidKeyFile},
+		{name: "missing file", config: SigningConfig{ActiveKey: "gone", Keys: []SigningKeyConfig{{ID: "gone", File: filepath.Join(dir, "gone.pem")}}}, err: os.ErrNotExist},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := NewKeySet(test.config, test.secret)
+			if test.err == nil && err != nil {
+				t.Fatalf("valid config rejected: %s", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("NewKeySet: got %v (set %+v), want %v", err, set, test.err)
+			}
+		})
+	}
+}
+
+func TestKeySetRoundTrip(t *testing.T) {
+	keys := newTestKeys(t)
+	tests := []struct {
+		name   string
+		active string
+		method jwt.SigningMethod
+	}{
+		{name: "RS256", active: "rsa", method: jwt.SigningMethodRS256},
+		{name: "EdDSA", active: "ed", method: jwt.SigningMethodEdDSA},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := keys.config
+			config.ActiveKey = test.active
+			set, err := NewKeySet(config, "")
+			if err != nil {
+				t.Fatalf("NewKeySet: %s", err)
+			}
+			signed, err := GenerateToken("alice", "user", "session", testTokenSettings, set)
+			if err != nil {
+				t.Fatalf("GenerateToken: %s", err)
+			}
+
+			// The header names the key and its algorithm, the claims come back as they were signed
+			token, _, err := jwt.NewParser().ParseUnverified(signed, &UserClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Method != test.method || token.Header["kid"] != test.active {
+				t.Fatalf("header %v, want alg %s and kid %s", token.Header, test.method.Alg(), test.active)
+			}
+			claims, err := getClaimsByJWT(signed, set, testTokenSettings)
+			if err != nil {
+				t.Fatalf("token of the key rejected: %s", err)
+			}
+			if claims.User.Username != "alice" || claims.User.ID != "user" || claims.SessionID != "session" {
+				t.Fatalf("claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestRetiredKeyVerifies(t *testing.T) {
+	keys := newTestKeys(t)
+	signed := signToken(t, validClaims(time.Now()), jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+
+	// After the rotation the RSA key is only published: its tokens verify, and new tokens are signed by the active key
+	publicFile := filepath.Join(t.TempDir(), "rsa-public.pem")
+	if err := os.WriteFile(publicFile, keys.rsaPublicPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewKeySet(SigningConfig{ActiveKey: "ed", Keys: []SigningKeyConfig{
+		{ID: "ed", File: keys.config.Keys[1].File},
+		{ID: "rsa", File: publicFile},
+	}}, "")
+	if err != nil {
+		t.Fatalf("NewKeySet: %s", err)
+	}
+	if _, err := getClaimsByJWT(signed, rotated, testTokenSettings); err != nil {
+		t.Fatalf("token of the retired key rejected while the key is published: %s", err)
+	}
+	fresh, err := GenerateToken("alice", "user", "session", testTokenSettings, rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _, err := jwt.NewParser().ParseUnverified(fresh, &UserClaims{}); err != nil || token.Header["kid"] != "ed" {
+		t.Fatalf("new token %v signed by another key than the active one (%v)", token, err)
+	}
+
+	// Once the key is removed from the set its tokens are refused, here already by the algorithm no key of the set uses
+	removed, err := NewKeySet(SigningConfig{ActiveKey: "ed", Keys: []SigningKeyConfig{{ID: "ed", File: keys.config.Keys[1].File}}}, "")
+	if err != nil {
+		t.Fatalf("NewKeySet: %s", err)
+	}
+	if claims, err := getClaimsByJWT(signed, removed, testTokenSettings); err == nil {
+		t.Fatalf("token of the removed key accepted with the claims %+v", claims)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	keys := newTestKeys(t)
+	ts := newTestServer(t, map[string]any{"signing": keys.config})
+	response := ts.expect(http.StatusOK, "GET", "/.well-known/jwks.json", "", nil)
+
+	// Only the public members of the keys are published, the private parts and the HMAC secret never are
+	var raw struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("decoding %s: %s", response.Body.String(), err)
+	}
+	public := map[string]bool{"kty": true, "kid": true, "use": true, "alg": true, "n": true, "e": true, "crv": true, "x": true}
+	for _, key := range raw.Keys {
+		for member := range key {
+			if !public[member] {
+				t.Fatalf("the key %s publishes the member %q", key["kid"], member)
+			}
+		}
+	}
+
+	var set JWKSet
+	decodeResponse(t, response, &set)
+	want := []JWK{
+		{
+			KeyType: "RSA", ID: "rsa", Use: "sig", Alg: "RS256",
+			N: base64.RawURLEncoding.EncodeToString(keys.rsaKey.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(keys.rsaKey.E)).Bytes()),
+		},
+		{
+			KeyType: "OKP", ID: "ed", Use: "sig", Alg: "EdDSA", Curve: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(keys.edKey.Public().(ed25519.PublicKey)),
+		},
+	}
+	if len(set.Keys) != len(want) {
+		t.Fatalf("keys %+v, want %+v", set.Keys, want)
+	}
+	for index := range want {
+		if set.Keys[index] != want[index] {
+			t.Fatalf("key %+v, want %+v", set.Keys[index], want[index])
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+)
+
+// Names of the storage drivers that can be specified in the "storage" section of the config
+const (
+	StorageMemory   = "memory"
+	StoragePostgres = "postgres"
+	StorageSQLite   = "sqlite"
+)
+
+// The snapshot interval of the memory journals when it is not specified in the config
+const defaultSnapshotInterval = 5 * time.Minute
+
+var (
+	ErrUnknownStorage = errors.New("unknown storage driver")
+	ErrEmptyDSN       = errors.New("storage dsn is empty")
+	ErrEmptyPath      = errors.New("storage path is empty")
+)
+
+// The function of creating repositories of the driver selected in the config
+func newMemoryService(config StorageConfig) (*MemoryService, error) {
+	switch config.Driver {
+	case "", StorageMemory:
+		if config.Path == "" {
+			voteRepo := repository.NewMemoryVoteRepository()
+			return &MemoryService{
+				UserRepo:    repository.NewMemoryUserRepository(),
+				SessionRepo: repository.NewMemorySessionRepository(),
+				PostRepo:    repository.NewMemoryPostRepository(voteRepo),
+				VoteRepo:    voteRepo,
+				CommentRepo: repository.NewMemoryCommentRepository(),
+				TokenRepo:   repository.NewMemoryUserTokenRepository(),
+				IdentRepo:   repository.NewMemoryIdentityRepository(),
+				AccessRepo:  repository.NewMemoryAccessTokenRepository(),
+				RoleRepo:    repository.NewMemoryRoleRepository(),
+				LoginRepo:   repository.NewMemoryLoginAttemptRepository(),
+			}, nil
+		}
+		return newDurableMemoryService(config)
+	case StoragePostgres:
+		if config.DSN == "" {
+			return nil, ErrEmptyDSN
+		}
+		return newSQLService(repository.DialectPostgres, config.DSN)
+	case StorageSQLite:
+		if config.Path == "" {
+			return nil, ErrEmptyPath
+		}
+		return newSQLService(repository.DialectSQLite, repository.SQLiteDSN(config.Path))
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStorage, config.Driver)
+	}
+}
+
+// The function of opening the SQL database of the dialect and creating repositories over it
+func newSQLService(dialect, dsn string) (*MemoryService, error) {
+	db, err := repository.OpenSQL(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryService{
+		UserRepo:    repository.NewSQLUserRepository(db),
+		SessionRepo: repository.NewSQLSessionRepository(db),
+		PostRepo:    repository.NewSQLPostRepository(db),
+		VoteRepo:    repository.NewSQLVoteRepository(db),
+		CommentRepo: repository.NewSQLCommentRepository(db),
+		TokenRepo:   repository.NewSQLUserTokenRepository(db),
+		IdentRepo:   repository.NewSQLIdentityRepository(db),
+		AccessRepo:  repository.NewSQLAccessTokenRepository(db),
+		RoleRepo:    repository.NewSQLRoleRepository(db),
+		LoginRepo:   repository.NewMemoryLoginAttemptRepository(),
+	}, nil
+}
+
+// The function of creating memory repositories that write their changes to journals in the config.Path directory
+// and compact them into snapshots in the background
+func newDurableMemoryService(config StorageConfig) (*MemoryService, error) {
+	interval := defaultSnapshotInterval
+	if config.SnapshotInterval != "" {
+		parsed, err := time.ParseDuration(config.SnapshotInterval)
+		if err != nil {
+			return nil, err
+		}
+		interval = parsed
+	}
+
+	openJournal := func(name string) (*repository.Journal, error) {
+		return repository.NewJournal(config.Path, name)
+	}
+
+	userJournal, err := openJournal("users")
+	if err != nil {
+		return nil, err
+	}
+	userRepo, err := repository.NewDurableMemoryUserRepository(userJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionJournal, err := openJournal("sessions")
+	if err != nil {
+		return nil, err
+	}
+	sessionRepo, err := repository.NewDurableMemorySessionRepository(sessionJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	voteJournal, err := openJournal("votes")
+	if err != nil {
+		return nil, err
+	}
+	voteRepo, err := repository.NewDurableMemoryVoteRepository(voteJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	postJournal, err := openJournal("posts")
+	if err != nil {
+		return nil, err
+	}
+	postRepo, err := repository.NewDurableMemoryPostRepository(postJournal, voteRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	commentJournal, err := openJournal("comments")
+	if err != nil {
+		return nil, err
+	}
+	commentRepo, err := repository.NewDurableMemoryCommentRepository(commentJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenJournal, err := openJournal("tokens")
+	if err != nil {
+		return nil, err
+	}
+	tokenRepo, err := repository.NewDurableMemoryUserTokenRepository(tokenJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	identityJournal, err := openJournal("identities")
+	if err != nil {
+		return nil, err
+	}
+	identityRepo, err := repository.NewDurableMemoryIdentityRepository(identityJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenJournal, err := openJournal("access_tokens")
+	if err != nil {
+		return nil, err
+	}
+	accessTokenRepo, err := repository.NewDurableMemoryAccessTokenRepository(accessTokenJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	roleJournal, err := openJournal("roles")
+	if err != nil {
+		return nil, err
+	}
+	roleRepo, err := repository.NewDurableMemoryRoleRepository(roleJournal)
+	if err != nil {
+		return nil, err
+	}
+
+	go repository.RunSnapshots(interval, userRepo, sessionRepo, postRepo, voteRepo, commentRepo, tokenRepo, identityRepo, accessTokenRepo,
+		roleRepo)
+
+	return &MemoryService{
+		UserRepo:    userRepo,
+		SessionRepo: sessionRepo,
+		PostRepo:    postRepo,
+		VoteRepo:    voteRepo,
+		CommentRepo: commentRepo,
+		TokenRepo:   tokenRepo,
+		IdentRepo:   identityRepo,
+		AccessRepo:  accessTokenRepo,
+		RoleRepo:    roleRepo,
+		LoginRepo:   repository.NewMemoryLoginAttemptRepository(),
+	}, nil
+}
@@ -4,13 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
@@ -19,6 +17,8 @@ var (
 	ErrUnexpectSignMethod      = errors.New("unexpected signing method")
 	ErrInvalidToken            = errors.New("invalid token")
 	ErrUserNotFoundToken       = errors.New("user data not found in token")
+	ErrSessionNotFoundToken    = errors.New("session not found in token")
+	ErrNotBeforeMissing        = errors.New("token has no nbf claim")
 )
 
 // UserClaims - custom token data
@@ -27,12 +27,21 @@ type UserClaims struct {
 		Username string `json:"username"`
 		ID       string `json:"id"`
 	} `json:"user"`
-	jwt.StandardClaims
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
 }
 
-// Generate Token - a function for generating a JWT token based on username, id, secret, where secret is the key for signing the JWT
-func GenerateToken(username, id string, secret []byte) (string, error) {
+// Generate Token - a function for generating a JWT access token based on username, id, the ID of the session the token belongs to,
+// settings of the tokens (lifetime, issuer and audience) and keys, where keys is the key set signing the JWT
+func GenerateToken(username, id, sessionID string, settings TokenSettings, keys *KeySet) (string, error) {
+	// The ID of the token makes every token unique, even two tokens of the same user issued in the same second
+	tokenID, err := GenerateID()
+	if err != nil {
+		return "", err
+	}
+
 	// Создаем данные токена
+	now := time.Now()
 	claims := UserClaims{
 		User: struct {
 			Username string `json:"username"`
@@ -41,22 +50,19 @@ func GenerateToken(username, id string, secret []byte) (string, error) {
 			Username: username,
 			ID:       id,
 		},
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(7 * 24 * time.Hour).Unix(), // The token expires in 7 days
-			IssuedAt:  time.Now().Unix(),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    settings.Issuer,
+			Audience:  jwt.ClaimStrings{settings.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(settings.Access)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        tokenID,
 		},
 	}
 
-	// Creating a token with the HS256 algorithm and passing claims to it
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Signing the token with a secret key
-	tokenString, err := token.SignedString(secret)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	// Signing the token with the active key of the set
+	return keys.sign(claims)
 }
 
 // GenerateID creates a 24-character token in hexadecimal format
@@ -90,28 +96,37 @@ func getJWTByRequest(r *http.Request) (string, error) {
 	return token, nil
 }
 
-func getUserByJWT(tokenString string, secret []byte) (*models.User, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Checking the signature algorithm
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrUnexpectSignMethod
-		}
-		return secret, nil
-	})
+// The function of getting the options of the parser checking a token of the key set issued for the audience
+func parserOptions(keys *KeySet, settings TokenSettings, audience string) []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithValidMethods(keys.methods()),
+		jwt.WithIssuer(settings.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(settings.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+}
+
+// The function of validating the token and reading its claims: the signature with the keys of the set, the issuer and the audience,
+// and the exp, nbf and iat times, which may be off by the clock skew of the settings
+func getClaimsByJWT(tokenString string, keys *KeySet, settings TokenSettings) (*UserClaims, error) {
+	claims := &UserClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, parserOptions(keys, settings, settings.Audience)...)
 	if err != nil {
 		return nil, err
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Extracting user data from claims["user"]
-		if userMap, ok := claims["user"].(map[string]interface{}); ok {
-			user := &models.User{
-				Username: fmt.Sprintf("%v", userMap["username"]),
-				ID:       fmt.Sprintf("%v", userMap["id"]),
-			}
-			return user, nil
-		}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.NotBefore == nil {
+		return nil, ErrNotBeforeMissing
+	}
+	if claims.User.ID == "" {
 		return nil, ErrUserNotFoundToken
 	}
-	return nil, ErrInvalidToken
+	if claims.SessionID == "" {
+		return nil, ErrSessionNotFoundToken
+	}
+	return claims, nil
 }
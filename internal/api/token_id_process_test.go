@@ -0,0 +1,265 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The settings of the tokens in the tests
+var testTokenSettings = TokenSettings{
+	Access:    15 * time.Minute,
+	Refresh:   time.Hour,
+	Issuer:    defaultTokenIssuer,
+	Audience:  defaultTokenAudience,
+	ClockSkew: 30 * time.Second,
+}
+
+// The function of writing the PEM block to a file of the directory, returns the path of the file
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The keys of the token tests: an active RSA key, an Ed25519 key kept for the tokens signed before a rotation and the HMAC secret
+type testKeys struct {
+	config       SigningConfig
+	set          *KeySet
+	rsaKey       *rsa.PrivateKey
+	edKey        ed25519.PrivateKey
+	rsaPublicPEM []byte
+}
+
+// The function of generating the keys and the key set over them
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := SigningConfig{
+		ActiveKey: "rsa",
+		Keys: []SigningKeyConfig{
+			{ID: "rsa", File: writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+			{ID: "ed", File: writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER)},
+		},
+	}
+	set, err := NewKeySet(config, "secret")
+	if err != nil {
+		t.Fatalf("NewKeySet: %s", err)
+	}
+	return testKeys{
+		config:       config,
+		set:          set,
+		rsaKey:       rsaKey,
+		edKey:        edKey,
+		rsaPublicPEM: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+	}
+}
+
+// The function of making the claims of a valid token issued now
+func validClaims(now time.Time) UserClaims {
+	claims := UserClaims{SessionID: "session"}
+	claims.User.ID = "user"
+	claims.User.Username = "alice"
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    testTokenSettings.Issuer,
+		Audience:  jwt.ClaimStrings{testTokenSettings.Audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(testTokenSettings.Access)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        "token",
+	}
+	return claims
+}
+
+// The function of signing the claims with the method and the key, kid is put in the header unless it is empty
+func signToken(t *testing.T, claims UserClaims, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestGetClaimsByJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	valid := signToken(t, validClaims(now), jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token func() string
+		valid bool
+	}{
+		{name: "valid RS256", valid: true, token: func() string { return valid }},
+		{name: "token of GenerateToken", valid: true, token: func() string {
+			token, err := GenerateToken("alice", "user", "session", testTokenSettings, keys.set)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}},
+		{name: "valid EdDSA of the rotated key", valid: true, token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodEdDSA, "ed", keys.edKey)
+		}},
+		{name: "valid HS256 issued before the migration", valid: true, token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodHS256, "", []byte("secret"))
+		}},
+		{name: "expired within the clock skew", valid: true, token: func() string {
+			claims := validClaims(now.Add(-testTokenSettings.Access - 10*time.Second))
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "changed payload", token: func() string {
+			claims := validClaims(now)
+			claims.User.ID = "admin"
+			forged := signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+			return parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+		}},
+		{name: "changed signature", token: func() string {
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature[0] ^= 0xff
+			return parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(signature)
+		}},
+		{name: "expired beyond the clock skew", token: func() string {
+			claims := validClaims(now.Add(-testTokenSettings.Access - time.Minute))
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "without exp", token: func() string {
+			claims := validClaims(now)
+			claims.ExpiresAt = nil
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "not valid yet beyond the clock skew", token: func() string {
+			claims := validClaims(now.Add(time.Minute))
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "without nbf", token: func() string {
+			claims := validClaims(now)
+			claims.NotBefore = nil
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "alg none", token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType)
+		}},
+		{name: "HS256 signed with the RSA public key", token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodHS256, "rsa", keys.rsaPublicPEM)
+		}},
+		{name: "HS256 signed with another secret", token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodHS256, "", []byte("guessed"))
+		}},
+		{name: "HS512 signed with the secret", token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodHS512, "", []byte("secret"))
+		}},
+		{name: "EdDSA under the kid of the RSA key", token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodEdDSA, "rsa", keys.edKey)
+		}},
+		{name: "unknown kid", token: func() string {
+			return signToken(t, validClaims(now), jwt.SigningMethodRS256, "retired", keys.rsaKey)
+		}},
+		{name: "wrong issuer", token: func() string {
+			claims := validClaims(now)
+			claims.Issuer = "elsewhere"
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "wrong audience", token: func() string {
+			claims := validClaims(now)
+			claims.Audience = jwt.ClaimStrings{"oidc-client"}
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "without user", token: func() string {
+			claims := validClaims(now)
+			claims.User.ID = ""
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+		{name: "without session", token: func() string {
+			claims := validClaims(now)
+			claims.SessionID = ""
+			return signToken(t, claims, jwt.SigningMethodRS256, "rsa", keys.rsaKey)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := getClaimsByJWT(test.token(), keys.set, testTokenSettings)
+			if test.valid && err != nil {
+				t.Fatalf("valid token rejected: %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("invalid token accepted with the claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestHS256RejectedWithoutSecret(t *testing.T) {
+	keys := newTestKeys(t)
+	// The same keys without keyJWT: an HS256 token is refused whatever it is signed with
+	withoutSecret := *keys.set
+	withoutSecret.secret = nil
+	token := signToken(t, validClaims(time.Now()), jwt.SigningMethodHS256, "rsa", keys.rsaPublicPEM)
+	if _, err := getClaimsByJWT(token, &withoutSecret, testTokenSettings); err == nil {
+		t.Fatal("HS256 token accepted by a key set without the secret")
+	}
+}
+
+func TestAuthMiddlewareRejectsTokenOfDeletedUser(t *testing.T) {
+	ts := newTestServer(t, nil)
+	token := ts.register("alice")
+	ts.expect(http.StatusOK, "GET", "/api/sessions", token, nil)
+
+	// A correctly signed token of a live session whose user no longer exists
+	now := time.Now()
+	session := &models.Session{ID: "ghost-session", UserID: "ghost", Created: now, LastSeen: now, Expires: now.Add(time.Hour)}
+	if err := ts.MemServ.SessionRepo.Create(session); err != nil {
+		t.Fatal(err)
+	}
+	ghost, err := GenerateToken("ghost", "ghost", session.ID, ts.Tokens, ts.Keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", ghost, nil)
+
+	// A token of a real user is refused once its session is deleted
+	ts.expect(http.StatusOK, "POST", "/api/logout", token, nil)
+	ts.expect(http.StatusUnauthorized, "GET", "/api/sessions", token, nil)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/repository"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/totp"
+)
+
+// Settings of the second step of the login and of the recovery codes
+const (
+	twoFactorChallengeLifetime = 5 * time.Minute
+	twoFactorAudienceSuffix    = "#2fa" // the challenges are issued for their own audience, so they are never taken for access tokens
+	recoveryCodeCount          = 10
+	recoveryCodeSize           = 10 // bytes, 16 characters of base32
+	defaultTwoFactorIssuer     = "redditclone"
+)
+
+// Errors related to the two-factor authentication
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication was not enrolled")
+	ErrInvalidSecondFactor  = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("two-factor challenge is invalid or expired")
+)
+
+// Structure of the "twoFactor" section of the config
+type TwoFactorConfig struct {
+	Issuer string `json:"issuer"` // the name of the service shown by the authenticator apps
+}
+
+// TwoFactorEnrollment - the secret of a new enrollment, uri is the otpauth:// URI to show as a QR code
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse - the recovery codes issued by the confirmation of the enrollment, they are shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TwoFactorChallenge - the response of the login of a user with two-factor authentication instead of the tokens.
+// The challenge is sent back to /api/login/2fa together with the code
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+	ExpiresIn         int    `json:"expiresIn"` // lifetime of the challenge in seconds
+}
+
+// The encoding of the recovery codes
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// The method of starting the enrollment of the user: stores a new secret, which is only used for the login after the confirmation.
+// Returns ErrTwoFactorEnabled if the user already has two-factor authentication
+func (server *Server) enrollTwoFactor(user *models.User) (*TwoFactorEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = server.MemServ.UserRepo.EnrollTOTP(user.ID, secret)
+	if errors.Is(err, repository.ErrTOTPStateChanged) {
+		return nil, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{Secret: secret, URI: totp.URI(server.TwoFactorIssuer, user.Username, secret)}, nil
+}
+
+// The method of confirming the enrollment with a code of the new secret, enables two-factor authentication and issues the recovery codes.
+// The code is accepted only once and only for the secret it was checked with, even if another enrollment or confirmation runs at the same time
+func (server *Server) confirmTwoFactor(user *models.User, code string, now time.Time) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	step, ok := totp.Validate(user.TOTPSecret, code, now, user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidSecondFactor
+	}
+	err := server.MemServ.UserRepo.AdvanceTOTPStep(user.ID, step)
+	if errors.Is(err, repository.ErrTOTPStepUsed) {
+		return nil, ErrInvalidSecondFactor
+	}
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = server.MemServ.UserRepo.EnableTOTP(user.ID, user.TOTPSecret, hashes)
+	if errors.Is(err, repository.ErrTOTPStateChanged) {
+		return nil, ErrInvalidSecondFactor
+	}
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// The method of turning off two-factor authentication of the user, it takes a code like the login does
+func (server *Server) disableTwoFactor(user *models.User, code string, now time.Time) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := server.checkSecondFactor(user, code, now); err != nil {
+		return err
+	}
+	return server.MemServ.UserRepo.DisableTOTP(user.ID)
+}
+
+// The method of checking the second factor of the user: a TOTP code of the authenticator or one of the recovery codes.
+// Every code is accepted only once, returns ErrInvalidSecondFactor for a wrong or used code
+func (server *Server) checkSecondFactor(user *models.User, code string, now time.Time) error {
+	if step, ok := totp.Validate(user.TOTPSecret, code, now, user.TOTPLastStep); ok {
+		err := server.MemServ.UserRepo.AdvanceTOTPStep(user.ID, step)
+		if errors.Is(err, repository.ErrTOTPStepUsed) {
+			return ErrInvalidSecondFactor
+		}
+		return err
+	}
+	if len(code) == totp.Digits {
+		return ErrInvalidSecondFactor
+	}
+	err := server.MemServ.UserRepo.UseRecoveryCode(user.ID, hashRecoveryCode(code))
+	if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+		return ErrInvalidSecondFactor
+	}
+	return err
+}
+
+// The function of generating the recovery codes together with the hashes under which they are stored
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		bytes := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(bytes))
+		code := encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// The function of hashing a recovery code, the case, the dashes and the spaces of the code do not matter
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// The method of issuing the challenge of the second step of the login of the user, a short-lived token of the key set
+func (server *Server) issueTwoFactorChallenge(user *models.User) (*TwoFactorChallenge, error) {
+	challengeID, err := GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	challenge, err := server.Keys.sign(jwt.RegisteredClaims{
+		Issuer:    server.Tokens.Issuer,
+		Subject:   user.ID,
+		Audience:  jwt.ClaimStrings{server.Tokens.Audience + twoFactorAudienceSuffix},
+		ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeLifetime)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        challengeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallenge{
+		TwoFactorRequired: true,
+		Challenge:         challenge,
+		ExpiresIn:         int(twoFactorChallengeLifetime / time.Second),
+	}, nil
+}
+
+// The method of checking the challenge of the second step of the login, returns the ID of the user it was issued for
+func (server *Server) parseTwoFactorChallenge(challenge string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(challenge, claims, server.Keys.keyFunc,
+		parserOptions(server.Keys, server.Tokens, server.Tokens.Audience+twoFactorAudienceSuffix)...)
+	if err != nil || claims.Subject == "" {
+		return "", ErrInvalidChallenge
+	}
+	return claims.Subject, nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/totp"
+)
+
+// The method of getting the code of the authenticator with the secret at the time step
+func (ts *testServer) totpCode(secret string, step int64) string {
+	ts.t.Helper()
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return code
+}
+
+// The method of logging the user with two-factor authentication in with the password, returns the challenge of the second step
+func (ts *testServer) twoFactorChallenge(username string) string {
+	ts.t.Helper()
+	response := ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: username, Password: testPassword})
+	var challenge TwoFactorChallenge
+	decodeResponse(ts.t, response, &challenge)
+	if !challenge.TwoFactorRequired || challenge.Challenge == "" {
+		ts.t.Fatalf("login responded %s, want a challenge", response.Body.String())
+	}
+	return challenge.Challenge
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ts := newTestServer(t, nil)
+	token := ts.register("alice")
+
+	// Enrollment: the secret is not asked for at the login until it is confirmed
+	response := ts.expect(http.StatusOK, "POST", "/api/user/2fa/enroll", token, nil)
+	var enrollment TwoFactorEnrollment
+	decodeResponse(t, response, &enrollment)
+	if enrollment.Secret == "" || enrollment.URI == "" {
+		t.Fatalf("enrollment %+v", enrollment)
+	}
+	ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "alice", Password: testPassword})
+
+	// Confirmation with a wrong code and then with the code of the authenticator
+	step := totp.Step(time.Now())
+	ts.expect(http.StatusUnprocessableEntity, "POST", "/api/user/2fa/confirm", token, TwoFactorData{Code: "000000"})
+	confirmCode := ts.totpCode(enrollment.Secret, step)
+	response = ts.expect(http.StatusOK, "POST", "/api/user/2fa/confirm", token, TwoFactorData{Code: confirmCode})
+	var recovery RecoveryCodesResponse
+	decodeResponse(t, response, &recovery)
+	if len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(recovery.RecoveryCodes), recoveryCodeCount)
+	}
+	ts.expect(http.StatusConflict, "POST", "/api/user/2fa/enroll", token, nil)
+
+	// Login with a TOTP code: the code of the confirmation is not accepted again
+	ts.expect(http.StatusUnauthorized, "POST", "/api/login/2fa", "",
+		TwoFactorData{Challenge: ts.twoFactorChallenge("alice"), Code: confirmCode})
+	response = ts.expect(http.StatusOK, "POST", "/api/login/2fa", "",
+		TwoFactorData{Challenge: ts.twoFactorChallenge("alice"), Code: ts.totpCode(enrollment.Secret, step+1)})
+	var tokens TokenResponse
+	decodeResponse(t, response, &tokens)
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("second step responded %s, want the tokens", response.Body.String())
+	}
+
+	// Login with a recovery code, the second use of it is refused
+	ts.expect(http.StatusOK, "POST", "/api/login/2fa", "",
+		TwoFactorData{Challenge: ts.twoFactorChallenge("alice"), Code: recovery.RecoveryCodes[0]})
+	ts.expect(http.StatusUnauthorized, "POST", "/api/login/2fa", "",
+		TwoFactorData{Challenge: ts.twoFactorChallenge("alice"), Code: recovery.RecoveryCodes[0]})
+	ts.expect(http.StatusUnauthorized, "POST", "/api/login/2fa", "", TwoFactorData{Challenge: "forged", Code: recovery.RecoveryCodes[1]})
+
+	// Disabling takes a code, then the password is enough again
+	ts.expect(http.StatusUnprocessableEntity, "DELETE", "/api/user/2fa", token, TwoFactorData{Code: recovery.RecoveryCodes[0]})
+	ts.expect(http.StatusOK, "DELETE", "/api/user/2fa", token, TwoFactorData{Code: recovery.RecoveryCodes[1]})
+	ts.expect(http.StatusConflict, "DELETE", "/api/user/2fa", token, TwoFactorData{Code: recovery.RecoveryCodes[2]})
+	response = ts.expect(http.StatusOK, "POST", "/api/login", "", Credentials{Username: "alice", Password: testPassword})
+	decodeResponse(t, response, &tokens)
+	if tokens.Token == "" {
+		t.Fatalf("login after disabling responded %s, want the tokens", response.Body.String())
+	}
+	user, err := ts.MemServ.UserRepo.GetByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.TOTPEnabled || user.TOTPSecret != "" || len(user.RecoveryCodes) != 0 {
+		t.Fatalf("second factors left after disabling: %+v", user)
+	}
+}
@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Errors related to sending the mail
+var (
+	ErrInvalidHeader = errors.New("mail header contains a line break")
+)
+
+// Message - a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - an interface for sending the emails of the server, so that the transport can be replaced in the config or in tests
+type Mailer interface {
+	Send(message Message) error
+}
+
+// The method of checking that the headers of the message and the sender contain no line breaks, which would inject other headers
+func (message Message) CheckHeaders(from string) error {
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return ErrInvalidHeader
+		}
+	}
+	return nil
+}
+
+// The function of formatting the message as an RFC 5322 email from the sender
+func (message Message) format(from string, now time.Time) ([]byte, error) {
+	if err := message.CheckHeaders(from); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", from)
+	fmt.Fprintf(&buffer, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("\r\n")
+	buffer.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	buffer.WriteString("\r\n")
+	return buffer.Bytes(), nil
+}
+
+// SMTPMailer - sends the emails through an SMTP server, with PLAIN authentication if the username is set.
+// net/smtp only sends the password over TLS or to localhost
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// SMTPMailer constructor, addr is the host:port of the SMTP server
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	mailer := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host := addr
+		if colon := strings.LastIndex(addr, ":"); colon >= 0 {
+			host = addr[:colon]
+		}
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+// The method of sending the message through the SMTP server
+func (mailer *SMTPMailer) Send(message Message) error {
+	data, err := message.format(mailer.from, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(mailer.addr, mailer.auth, mailer.from, []string{message.To}, data)
+}
+
+// LogMailer - writes the emails to the log instead of sending them, for development
+type LogMailer struct {
+	From string
+}
+
+// The method of writing the message to the log
+func (mailer LogMailer) Send(message Message) error {
+	data, err := message.format(mailer.From, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("LogMailer message:\n%s", data)
+	return nil
+}
+
+// FileMailer - writes every email to its own .eml file in a directory instead of sending it
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// FileMailer constructor, creates the directory if it does not exist
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// The method of writing the message to a new file named after the time it was sent
+func (mailer *FileMailer) Send(message Message) error {
+	now := time.Now()
+	data, err := message.format(mailer.from, now)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(mailer.dir, name), data, 0o600)
+}
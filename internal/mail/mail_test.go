@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// A mail received by the SMTP stand-in
+type received struct {
+	auth string // the decoded PLAIN credentials, empty without authentication
+	from string
+	to   []string
+	data string
+}
+
+// The function of starting a local SMTP stand-in that accepts one mail and sends it to the channel, returns its address
+func startSMTP(t *testing.T) (string, <-chan received) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	mails := make(chan received, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		var mail received
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 AUTH PLAIN")
+			case strings.HasPrefix(command, "AUTH PLAIN "):
+				credentials, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+				mail.auth = string(credentials)
+				text.PrintfLine("235 authenticated")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				mail.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+				text.PrintfLine("250 ok")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				mail.to = append(mail.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+				text.PrintfLine("250 ok")
+			case command == "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				mail.data = string(data)
+				text.PrintfLine("250 queued")
+			case command == "QUIT":
+				text.PrintfLine("221 bye")
+				mails <- mail
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), mails
+}
+
+func TestSMTPMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		auth     string
+	}{
+		{name: "with authentication", username: "user", auth: "\x00user\x00secret"},
+		{name: "without authentication"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr, mails := startSMTP(t)
+			mailer := NewSMTPMailer(addr, "noreply@example.com", test.username, "secret")
+			message := Message{To: "alice@example.com", Subject: "Password reset", Body: "first line\nsecond line"}
+			if err := mailer.Send(message); err != nil {
+				t.Fatalf("Send: %s", err)
+			}
+
+			mail := <-mails
+			if mail.auth != test.auth {
+				t.Fatalf("auth %q, want %q", mail.auth, test.auth)
+			}
+			if mail.from != "noreply@example.com" || len(mail.to) != 1 || mail.to[0] != "alice@example.com" {
+				t.Fatalf("envelope from %q to %v", mail.from, mail.to)
+			}
+			header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(mail.data))).ReadMIMEHeader()
+			if err != nil {
+				t.Fatalf("reading the headers of %q: %s", mail.data, err)
+			}
+			if header.Get("From") != "noreply@example.com" || header.Get("To") != "alice@example.com" ||
+				header.Get("Subject") != "Password reset" || header.Get("Message-Id") == "" {
+				t.Fatalf("headers %v", header)
+			}
+			if !strings.HasSuffix(mail.data, "\nfirst line\nsecond line\n") {
+				t.Fatalf("body of %q", mail.data)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	// Nothing listens at the address, the message is refused before connecting
+	mailer := NewSMTPMailer("127.0.0.1:1", "noreply@example.com", "", "")
+	message := Message{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "subject", Body: "body"}
+	if err := mailer.Send(message); !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("Send: got %v, want ErrInvalidHeader", err)
+	}
+}
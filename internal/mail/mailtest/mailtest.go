@@ -0,0 +1,47 @@
+// Package mailtest provides a mailer keeping the emails in memory, for the tests of the code that sends emails
+package mailtest
+
+import (
+	"sync"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/mail"
+)
+
+// Recorder - keeps the emails in memory instead of sending them
+type Recorder struct {
+	mu       sync.Mutex
+	messages []mail.Message
+	sent     chan mail.Message
+}
+
+// Recorder constructor, Sent receives every message once it is recorded
+func NewRecorder() *Recorder {
+	return &Recorder{sent: make(chan mail.Message, 64)}
+}
+
+// The method of recording the message, the headers are checked like the other mailers do
+func (recorder *Recorder) Send(message mail.Message) error {
+	if err := message.CheckHeaders("recorder@localhost"); err != nil {
+		return err
+	}
+	recorder.mu.Lock()
+	recorder.messages = append(recorder.messages, message)
+	recorder.mu.Unlock()
+	select {
+	case recorder.sent <- message:
+	default:
+	}
+	return nil
+}
+
+// The method of getting a copy of the recorded messages in the order they were sent
+func (recorder *Recorder) Messages() []mail.Message {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return append([]mail.Message(nil), recorder.messages...)
+}
+
+// The method of getting the channel that receives the messages as they are sent, for waiting on the emails sent in the background
+func (recorder *Recorder) Sent() <-chan mail.Message {
+	return recorder.sent
+}
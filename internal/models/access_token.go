@@ -0,0 +1,35 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// The scopes of the personal access tokens
+const (
+	ScopeRead     = "read"     // requests that only read
+	ScopePost     = "post"     // adding and deleting own posts and comments
+	ScopeVote     = "vote"     // voting for posts and comments
+	ScopeModerate = "moderate" // deleting posts and comments of others, if the user may
+)
+
+// All scopes of the personal access tokens
+var Scopes = []string{ScopeRead, ScopePost, ScopeVote, ScopeModerate}
+
+// A structure of a personal access token of the user for the bots and the scripts, only the hash of the token is stored.
+// LastUsed is nil until the token is used
+type AccessToken struct {
+	ID       string     `json:"id"`
+	UserID   string     `json:"-"`
+	Name     string     `json:"name"`
+	Hash     string     `json:"-"`
+	Scopes   []string   `json:"scopes"`
+	Created  time.Time  `json:"created"`
+	Expires  time.Time  `json:"expires"`
+	LastUsed *time.Time `json:"lastUsed"`
+}
+
+// The method of checking that the token has the scope
+func (token *AccessToken) HasScope(scope string) bool {
+	return slices.Contains(token.Scopes, scope)
+}
@@ -2,10 +2,17 @@ package models
 
 import "time"
 
-// A structure for comment abstraction and working with JSON
+// A structure for comment abstraction and working with JSON.
+// Comments of a post form a flat list in which replies refer to their parent comment, top-level comments have no parent and depth 0
 type Comment struct {
-	ID      string    `json:"id"`
-	Author  User      `json:"author"`
-	Body    string    `json:"body"`
-	Created time.Time `json:"created"`
+	ID               string    `json:"id"`
+	ParentID         string    `json:"parentID,omitempty"`
+	Depth            int       `json:"depth"`
+	Author           User      `json:"author"`
+	Body             string    `json:"body"`
+	Score            int       `json:"score"`
+	Votes            []Vote    `json:"votes"`
+	UpvotePercentage int       `json:"upvotePercentage"`
+	Created          time.Time `json:"created"`
+	Deleted          bool      `json:"deleted,omitempty"`
 }
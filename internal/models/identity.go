@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// A structure of an account of the user at an external identity provider, Subject is the "sub" claim of the provider.
+// A user may have several identities, an identity belongs to one user
+type Identity struct {
+	Provider string
+	Subject  string
+	UserID   string
+	Created  time.Time
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// A structure of the failed login attempts counted under one key, an account or an IP address
+type LoginAttempts struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+}
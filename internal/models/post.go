@@ -17,4 +17,5 @@ type Post struct {
 	Comments         []Comment `json:"comments"`
 	Created          time.Time `json:"created"`
 	UpvotePercentage int       `json:"upvotePercentage"`
+	Locked           bool      `json:"locked"` // a locked post takes no new comments
 }
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// The roles of the users
+const (
+	RoleAdmin     = "admin"     // has every permission and manages the roles, only on the whole site
+	RoleModerator = "moderator" // moderates the whole site or one category
+)
+
+// All roles of the users
+var Roles = []string{RoleAdmin, RoleModerator}
+
+// Permission - an action on the content or the accounts of other users
+type Permission string
+
+// The permissions given by the roles
+const (
+	PermissionDeletePost    Permission = "delete_post"
+	PermissionRemoveComment Permission = "remove_comment"
+	PermissionLockPost      Permission = "lock_post"
+	PermissionBanUser       Permission = "ban_user"
+	PermissionManageRoles   Permission = "manage_roles"
+)
+
+// The permissions of every role
+var RolePermissions = map[string][]Permission{
+	RoleAdmin:     {PermissionDeletePost, PermissionRemoveComment, PermissionLockPost, PermissionBanUser, PermissionManageRoles},
+	RoleModerator: {PermissionDeletePost, PermissionRemoveComment, PermissionLockPost, PermissionBanUser},
+}
+
+// A structure of a role of the user, on the whole site when Category is empty or only in the category
+type RoleGrant struct {
+	UserID   string    `json:"-"`
+	Role     string    `json:"role"`
+	Category string    `json:"category,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// The method of checking that the role gives the permission in the category. An empty category is an action outside
+// the categories, such as a ban, it is only allowed by the roles on the whole site
+func (grant RoleGrant) Allows(permission Permission, category string) bool {
+	if grant.Category != "" && grant.Category != category {
+		return false
+	}
+	return slices.Contains(RolePermissions[grant.Role], permission)
+}
@@ -1,7 +1,16 @@
 package models
 
-// A structure for abstracting the user's session and processing it in JSON
+import "time"
+
+// A structure for abstracting the user's session and processing it in JSON. A session is started by a login on one device
+// and lasts until Expires, its refresh token is rotated on every refresh and only the hash of the current one is stored
 type Session struct {
-	Token  string `json:"token"`
-	UserID string `json:"-"`
+	ID               string    `json:"id"`
+	UserID           string    `json:"-"`
+	RefreshTokenHash string    `json:"-"`
+	UserAgent        string    `json:"userAgent"`
+	IP               string    `json:"ip"`
+	Created          time.Time `json:"created"`
+	LastSeen         time.Time `json:"lastSeen"`
+	Expires          time.Time `json:"expires"`
 }
@@ -5,4 +5,18 @@ type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"-"`
+
+	// The optional email of the user, the password reset is only sent to a verified one
+	Email         string `json:"-"`
+	EmailVerified bool   `json:"-"`
+
+	// Two-factor authentication: the base32 TOTP secret is set by the enrollment and only checked at the login
+	// once the enrollment is confirmed, TOTPLastStep is the time step of the last accepted code so that no code is accepted twice
+	TOTPSecret    string   `json:"-"`
+	TOTPEnabled   bool     `json:"-"`
+	TOTPLastStep  int64    `json:"-"`
+	RecoveryCodes []string `json:"-"` // hashes of the unused recovery codes
+
+	// A banned user can not log in and its tokens are rejected
+	Banned bool `json:"-"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// The purposes of the single-use tokens sent to the users by email
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// A structure of a single-use token sent to the user by email, only the hash of the token is stored.
+// Email is the address the token was sent to, a verification token is only valid while the user still has that address
+type UserToken struct {
+	Hash    string
+	UserID  string
+	Purpose string
+	Email   string
+	Expires time.Time
+}
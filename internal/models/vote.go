@@ -4,3 +4,9 @@ type Vote struct {
 	UserID string `json:"user"`
 	Vote   int    `json:"vote"`
 }
+
+// A structure of the rating of a post, maintained by the vote repository on every vote change
+type Rating struct {
+	Score            int `json:"score"`
+	UpvotePercentage int `json:"upvotePercentage"`
+}
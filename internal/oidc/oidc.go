@@ -0,0 +1,446 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Settings of the requests to the providers
+const (
+	discoveryPath    = "/.well-known/openid-configuration"
+	keysRefetchDelay = time.Minute // the shortest time between two fetches of the keys, an unknown kid does not make every request fetch them
+	maxResponseSize  = 1 << 20
+	verifierSize     = 32 // bytes of the PKCE code verifier, 43 characters of base64url
+)
+
+// The signing algorithms accepted for the ID tokens, the symmetric ones and "none" are never accepted
+var idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Errors related to the login with an OpenID Connect provider
+var (
+	ErrDiscovery      = errors.New("provider discovery failed")
+	ErrIssuerMismatch = errors.New("provider issuer does not match the config")
+	ErrNoPKCE         = errors.New("provider does not support PKCE with S256")
+	ErrExchange       = errors.New("authorization code exchange failed")
+	ErrNoIDToken      = errors.New("token response has no id_token")
+	ErrInvalidIDToken = errors.New("id_token is invalid")
+	ErrUnknownKey     = errors.New("id_token is signed with an unknown key")
+	ErrNonceMismatch  = errors.New("id_token nonce does not match")
+)
+
+// Config - the settings of an OpenID Connect provider and of this server as its client
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string   // sent with HTTP basic authentication, a public client has none
+	RedirectURL  string   // the callback of this server registered at the provider
+	Scopes       []string // "openid" is always requested
+}
+
+// Metadata - the part of the discovery document of the provider that the login uses
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Claims - the claims of an ID token
+type Claims struct {
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Provider - an OpenID Connect provider. The discovery document and the keys are fetched on the first login and cached,
+// so that the server starts while the provider is down. The requests to the provider are made without holding the lock,
+// so that a slow provider does not hold up the logins that have what they need in the cache
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu           sync.Mutex
+	metadata     *Metadata
+	keys         map[string]any // public keys by kid
+	keysFetched  time.Time
+	keysFetching chan struct{} // closed when the fetch of the keys in progress ends, nil when the keys are not being fetched
+}
+
+// Provider constructor, client makes the requests to the provider
+func NewProvider(config Config, client *http.Client) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{config: config, client: client}
+}
+
+// The function of generating a PKCE code verifier
+func GenerateVerifier() (string, error) {
+	bytes := make([]byte, verifierSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// The function of getting the S256 PKCE code challenge of the verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// The method of building the URL of the authorization endpoint the user is sent to, with the state, the nonce and the challenge
+// of the verifier
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrDiscovery, err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", p.scope())
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", Challenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// The method of getting the requested scopes, "openid" first
+func (p *Provider) scope() string {
+	scopes := []string{"openid"}
+	for _, scope := range p.config.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// The method of exchanging the authorization code and the PKCE verifier for the tokens at the token endpoint,
+// returns the ID token checked by Verify
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(request, &response)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrExchange, err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("%w: status %d %s %s", ErrExchange, status, response.Error, response.ErrorDescription)
+	}
+	if response.IDToken == "" {
+		return "", ErrNoIDToken
+	}
+	return response.IDToken, nil
+}
+
+// The method of checking the ID token: the signature with the keys of the provider, the issuer, the audience of this client,
+// the times, which may be off by the leeway, and the nonce of the login
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string, leeway time.Duration) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata, kid)
+	},
+		jwt.WithValidMethods(idTokenMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithLeeway(leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		if errors.Is(err, ErrUnknownKey) || errors.Is(err, ErrDiscovery) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no sub claim", ErrInvalidIDToken)
+	}
+	// A token issued to several clients names the one it was meant for
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match the client", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
+
+// The method of getting the discovery document of the provider, fetched once and cached.
+// The first logins may fetch it at the same time, the document they cache first is kept
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	cached := p.metadata
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+discoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	status, err := p.do(request, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDiscovery, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrDiscovery, status)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("%w: %s", ErrIssuerMismatch, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	// Providers that do not list the methods may still support PKCE, only an explicit list without S256 is refused
+	if metadata.CodeChallengeMethods != nil && !slices.Contains(metadata.CodeChallengeMethods, "S256") {
+		return nil, ErrNoPKCE
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata == nil {
+		p.metadata = &metadata
+	}
+	return p.metadata, nil
+}
+
+// The method of getting the public key of the provider with the kid, the keys are fetched again when the kid is unknown,
+// so that the rotations of the provider are picked up. Only one fetch runs at a time, the other logins wait for its keys
+func (p *Provider) key(ctx context.Context, metadata *Metadata, kid string) (any, error) {
+	p.mu.Lock()
+	for {
+		if key, ok := p.lookup(kid); ok {
+			p.mu.Unlock()
+			return key, nil
+		}
+		fetching := p.keysFetching
+		if fetching == nil {
+			break
+		}
+		p.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: keys: %s", ErrDiscovery, ctx.Err())
+		}
+		p.mu.Lock()
+	}
+	if time.Since(p.keysFetched) < keysRefetchDelay {
+		p.mu.Unlock()
+		return nil, ErrUnknownKey
+	}
+	fetching := make(chan struct{})
+	p.keysFetching = fetching
+	p.mu.Unlock()
+
+	keys, err := p.fetchKeys(ctx, metadata.JWKSURI)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keysFetching = nil
+	close(fetching)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// The method of finding the key with the kid, a token without a kid takes the only key of the provider. Must be called under the lock
+func (p *Provider) lookup(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// The method of fetching the keys of the provider by kid, keys of unknown types are skipped. Must be called without the lock
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]any, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := p.do(request, &set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: keys: %s", ErrDiscovery, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: keys: status %d", ErrDiscovery, status)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if public, err := key.publicKey(); err == nil {
+			keys[key.ID] = public
+		}
+	}
+	return keys, nil
+}
+
+// The method of making the request and decoding its JSON body into value, returns the status of the response
+func (p *Provider) do(request *http.Request, value any) (int, error) {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, value); err != nil && response.StatusCode == http.StatusOK {
+		return 0, err
+	}
+	return response.StatusCode, nil
+}
+
+// A public key of the provider in the JWK format
+type jwk struct {
+	KeyType string `json:"kty"`
+	ID      string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`   // RSA modulus
+	E       string `json:"e"`   // RSA public exponent
+	Curve   string `json:"crv"` // EC or OKP curve
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// The method of converting the JWK to a public key of the crypto packages
+func (key jwk) publicKey() (any, error) {
+	switch key.KeyType {
+	case "RSA":
+		n, err := decodeInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", key.Curve)
+		}
+		x, err := decodeInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if key.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", key.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", key.KeyType)
+}
+
+// The function of decoding a base64url big-endian integer of a JWK
+func decodeInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,234 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/oidc/oidctest"
+)
+
+// The client of the provider in the tests
+const (
+	testClientID    = "client"
+	testRedirectURL = "http://localhost/api/oidc/test/callback"
+)
+
+// The function of starting the test provider and the client of it
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	mock, err := oidctest.NewProvider(testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+	provider := NewProvider(Config{Issuer: mock.Issuer(), ClientID: testClientID, RedirectURL: testRedirectURL}, mock.Server.Client())
+	return mock, provider
+}
+
+// The function of logging the identity in at the provider, returns the code of the callback
+func authorize(t *testing.T, mock *oidctest.Provider, provider *Provider, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := mock.Authorize(authURL, oidctest.Identity{Subject: "subject"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Query().Get("state") != "state" {
+		t.Fatalf("the callback %s does not return the state", callback)
+	}
+	return parsed.Query().Get("code")
+}
+
+func TestExchangePKCE(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+	verifier, err := GenerateVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := authorize(t, mock, provider, "nonce", verifier)
+	if _, err := provider.Exchange(ctx, code, other); !errors.Is(err, ErrExchange) {
+		t.Fatalf("exchange with another verifier: %v, want %v", err, ErrExchange)
+	}
+
+	code = authorize(t, mock, provider, "nonce", verifier)
+	idToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("exchange with the verifier: %s", err)
+	}
+	claims, err := provider.Verify(ctx, idToken, "nonce", time.Minute)
+	if err != nil {
+		t.Fatalf("verifying the ID token: %s", err)
+	}
+	if claims.Subject != "subject" {
+		t.Fatalf("subject %q", claims.Subject)
+	}
+	if _, err := provider.Exchange(ctx, code, verifier); !errors.Is(err, ErrExchange) {
+		t.Fatalf("second exchange of the code: %v, want %v", err, ErrExchange)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(claims jwt.MapClaims)
+		key    *rsa.PrivateKey
+		kid    string
+		err    error
+	}{
+		{name: "valid"},
+		{name: "wrong nonce", change: func(claims jwt.MapClaims) { claims["nonce"] = "other" }, err: ErrNonceMismatch},
+		{name: "no nonce", change: func(claims jwt.MapClaims) { delete(claims, "nonce") }, err: ErrNonceMismatch},
+		{name: "wrong issuer", change: func(claims jwt.MapClaims) { claims["iss"] = "https://elsewhere.example" }, err: ErrInvalidIDToken},
+		{name: "wrong audience", change: func(claims jwt.MapClaims) { claims["aud"] = "other-client" }, err: ErrInvalidIDToken},
+		{name: "several audiences without azp", change: func(claims jwt.MapClaims) {
+			claims["aud"] = []string{testClientID, "other-client"}
+		}, err: ErrInvalidIDToken},
+		{name: "several audiences with azp", change: func(claims jwt.MapClaims) {
+			claims["aud"] = []string{testClientID, "other-client"}
+			claims["azp"] = testClientID
+		}},
+		{name: "expired", change: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }, err: ErrInvalidIDToken},
+		{name: "without exp", change: func(claims jwt.MapClaims) { delete(claims, "exp") }, err: ErrInvalidIDToken},
+		{name: "without sub", change: func(claims jwt.MapClaims) { delete(claims, "sub") }, err: ErrInvalidIDToken},
+		{name: "signed with another key", key: otherKey, err: ErrInvalidIDToken},
+		{name: "signed with an unknown key", key: otherKey, kid: "unknown", err: ErrUnknownKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := mock.Claims(oidctest.Identity{Subject: "subject"}, "nonce")
+			if test.change != nil {
+				test.change(claims)
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = oidctest.KeyID
+			if test.kid != "" {
+				token.Header["kid"] = test.kid
+			}
+			key := mock.Key
+			if test.key != nil {
+				key = test.key
+			}
+			signed, err := token.SignedString(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = provider.Verify(context.Background(), signed, "nonce", time.Minute)
+			if test.err == nil && err != nil {
+				t.Fatalf("valid token rejected: %s", err)
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer": "https://elsewhere.example", "authorization_endpoint": "https://elsewhere.example/authorize",
+			"token_endpoint": "https://elsewhere.example/token", "jwks_uri": "https://elsewhere.example/jwks"}`))
+	}))
+	defer server.Close()
+	provider := NewProvider(Config{Issuer: server.URL, ClientID: testClientID, RedirectURL: testRedirectURL}, server.Client())
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); !errors.Is(err, ErrIssuerMismatch) {
+		t.Fatalf("error %v, want %v", err, ErrIssuerMismatch)
+	}
+}
+
+func TestSlowKeysDoNotHoldLock(t *testing.T) {
+	mock, err := oidctest.NewProvider(testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	// A provider whose keys are served only once the test lets them
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			fetches.Add(1)
+			requested <- struct{}{}
+			<-release
+			mock.Server.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer": "` + server.URL + `", "authorization_endpoint": "` + server.URL + `/authorize",
+			"token_endpoint": "` + server.URL + `/token", "jwks_uri": "` + server.URL + `/jwks"}`))
+	}))
+	defer server.Close()
+	provider := NewProvider(Config{Issuer: server.URL, ClientID: testClientID, RedirectURL: testRedirectURL}, server.Client())
+
+	claims := mock.Claims(oidctest.Identity{Subject: "subject"}, "nonce")
+	claims["iss"] = server.URL
+	token, err := mock.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const logins = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.Verify(context.Background(), token, "nonce", time.Minute)
+			errs <- err
+		}()
+	}
+	<-requested
+
+	// While the keys are being fetched a login that needs only the cached discovery document goes on
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier"); err != nil {
+		t.Fatalf("AuthCodeURL while the keys are fetched: %s", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Verify: %s", err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("the keys were fetched %d times, want once", fetches.Load())
+	}
+}
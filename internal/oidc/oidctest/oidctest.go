@@ -0,0 +1,234 @@
+// Package oidctest provides an OpenID Connect provider running on a local test server, for the tests of the login with a provider
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The kid of the key the provider signs the ID tokens with
+const KeyID = "oidctest"
+
+// Errors of the authorization requests sent to the provider
+var (
+	ErrInvalidRequest = errors.New("invalid authorization request")
+)
+
+// Identity - the user logging in at the provider, its claims are put in the ID token
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// Provider - an OpenID Connect provider serving the discovery document, the keys and the token endpoint.
+// The authorization endpoint is not served, Authorize plays the part of the user logging in there
+type Provider struct {
+	Server   *httptest.Server
+	ClientID string
+	Key      *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant           // the authorization codes not exchanged yet
+	tamper func(claims jwt.MapClaims) // changes the claims of the ID tokens of the token endpoint
+}
+
+// The grant of an authorization code
+type grant struct {
+	identity    Identity
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Provider constructor, starts the server of the provider of the client, it must be closed by Close
+func NewProvider(clientID string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	provider := &Provider{ClientID: clientID, Key: key, grants: make(map[string]grant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", provider.discoveryHandler)
+	mux.HandleFunc("GET /jwks", provider.keysHandler)
+	mux.HandleFunc("POST /token", provider.tokenHandler)
+	provider.Server = httptest.NewServer(mux)
+	return provider, nil
+}
+
+// The method of getting the issuer of the provider, the URL of its server
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// The method of stopping the server of the provider
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// The method of logging the identity in at the authorization URL built by the client: checks the request like the authorization
+// endpoint does and returns the URL of the callback the user is redirected to with the code and the state
+func (p *Provider) Authorize(authURL string, identity Identity) (string, error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.ClientID || query.Get("redirect_uri") == "" ||
+		query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		return "", ErrInvalidRequest
+	}
+	callback, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		return "", err
+	}
+
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(bytes)
+	p.mu.Lock()
+	p.grants[code] = grant{
+		identity:    identity,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+
+	callbackQuery := callback.Query()
+	callbackQuery.Set("code", code)
+	callbackQuery.Set("state", query.Get("state"))
+	callback.RawQuery = callbackQuery.Encode()
+	return callback.String(), nil
+}
+
+// The method of setting the function changing the claims of every ID token issued by the token endpoint, nil stops the changes
+func (p *Provider) SetTamper(tamper func(claims jwt.MapClaims)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tamper = tamper
+}
+
+// The method of signing the claims as an ID token of the provider
+func (p *Provider) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(p.Key)
+}
+
+// The method of getting the claims of a valid ID token of the identity issued now
+func (p *Provider) Claims(identity Identity, nonce string) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"sub":   identity.Subject,
+		"nonce": nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if identity.Email != "" {
+		claims["email"] = identity.Email
+		claims["email_verified"] = identity.EmailVerified
+	}
+	if identity.PreferredUsername != "" {
+		claims["preferred_username"] = identity.PreferredUsername
+	}
+	if identity.Name != "" {
+		claims["name"] = identity.Name
+	}
+	return claims
+}
+
+// The discovery document of the provider
+func (p *Provider) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                           p.Issuer(),
+		"authorization_endpoint":           p.Issuer() + "/authorize",
+		"token_endpoint":                   p.Issuer() + "/token",
+		"jwks_uri":                         p.Issuer() + "/jwks",
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+// The public key of the provider in the JWK format
+func (p *Provider) keysHandler(w http.ResponseWriter, r *http.Request) {
+	public := p.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+// The token endpoint: the code is exchanged once, with the redirect URI it was issued for and the verifier of its challenge
+func (p *Provider) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, _, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != p.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	grant, exists := p.grants[code]
+	delete(p.grants, code)
+	tamper := p.tamper
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !exists || grant.redirectURI != r.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := p.Claims(grant.identity, grant.nonce)
+	if tamper != nil {
+		tamper(claims)
+	}
+	idToken, err := p.Sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "access_token": code, "token_type": "Bearer"})
+}
+
+// The function of writing the value as the JSON response with the status
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,234 @@
+package ranking
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/scoring"
+)
+
+// Errors related to parsing the sorting parameters
+var (
+	ErrUnknownSort   = errors.New("unknown sort")
+	ErrUnknownWindow = errors.New("unknown time window")
+)
+
+// Sort - the order of a post listing
+type Sort string
+
+const (
+	SortHot           Sort = "hot"
+	SortNew           Sort = "new"
+	SortTop           Sort = "top"
+	SortControversial Sort = "controversial"
+	SortBest          Sort = "best"
+)
+
+// Window - the time window of the top listing, only posts created inside it are shown
+type Window string
+
+const (
+	WindowHour  Window = "hour"
+	WindowDay   Window = "day"
+	WindowWeek  Window = "week"
+	WindowMonth Window = "month"
+	WindowYear  Window = "year"
+	WindowAll   Window = "all"
+)
+
+// The moment from which the age of posts is counted in the hot formula, the same as on reddit
+var hotEpoch = time.Unix(1134028003, 0)
+
+// Every 45000 seconds (12.5 hours) of age weigh as much as a tenfold difference in the score
+const hotDecaySeconds = 45000
+
+// The z-score of the 80% confidence level used in the Wilson lower bound
+const wilsonZ = 1.281551565545
+
+var windowDurations = map[Window]time.Duration{
+	WindowHour:  time.Hour,
+	WindowDay:   24 * time.Hour,
+	WindowWeek:  7 * 24 * time.Hour,
+	WindowMonth: 30 * 24 * time.Hour,
+	WindowYear:  365 * 24 * time.Hour,
+}
+
+// The function of parsing the sort query parameter, returns ErrUnknownSort for an unknown value
+func ParseSort(value string) (Sort, error) {
+	switch parsed := Sort(value); parsed {
+	case SortHot, SortNew, SortTop, SortControversial, SortBest:
+		return parsed, nil
+	}
+	return "", ErrUnknownSort
+}
+
+// The function of parsing the t query parameter, an empty value means all time, returns ErrUnknownWindow for an unknown value
+func ParseWindow(value string) (Window, error) {
+	if value == "" {
+		return WindowAll, nil
+	}
+	window := Window(value)
+	if _, ok := windowDurations[window]; ok || window == WindowAll {
+		return window, nil
+	}
+	return "", ErrUnknownWindow
+}
+
+// The function of the hot rank: the logarithm of the score plus the age bonus, newer posts need fewer votes to be on top
+func Hot(score int, created time.Time) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := created.Sub(hotEpoch).Seconds()
+	return sign*order + seconds/hotDecaySeconds
+}
+
+// The function of the controversy rank: many votes split evenly between upvotes and downvotes rank highest
+func Controversy(upvotes, downvotes int) float64 {
+	if upvotes <= 0 || downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(upvotes + downvotes)
+	balance := float64(downvotes) / float64(upvotes)
+	if upvotes < downvotes {
+		balance = float64(upvotes) / float64(downvotes)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+// The function of the lower bound of the Wilson score interval of the share of upvotes, a post without votes gets 0
+func Wilson(upvotes, downvotes int) float64 {
+	n := float64(upvotes + downvotes)
+	if n == 0 {
+		return 0
+	}
+	p := float64(upvotes) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// The function of keeping only the posts created inside the window ending at now, the order of posts is kept
+func FilterWindow(posts []models.Post, window Window, now time.Time) []models.Post {
+	duration, ok := windowDurations[window]
+	if !ok {
+		return posts
+	}
+	since := now.Add(-duration)
+	filtered := make([]models.Post, 0, len(posts))
+	for _, post := range posts {
+		if !post.Created.Before(since) {
+			filtered = append(filtered, post)
+		}
+	}
+	return filtered
+}
+
+// The function of sorting the posts in place by the rank of the sort, the votes of the posts must be filled.
+// Posts with equal rank are ordered from newer to older and then by ID, so the order is deterministic
+func Rank(posts []models.Post, sortBy Sort) {
+	rank(posts, sortBy, func(post models.Post) entry {
+		return entry{votes: post.Votes, created: post.Created, id: post.ID}
+	})
+}
+
+// The function of sorting the comments of a post in place by the rank of the sort, the votes of the comments must be filled.
+// Replies are ranked among their siblings and the list is ordered depth-first, so every reply follows its parent.
+// A comment whose parent is not in the list is ranked as a top-level comment
+func RankComments(comments []models.Comment, sortBy Sort) {
+	rank(comments, sortBy, func(comment models.Comment) entry {
+		return entry{votes: comment.Votes, created: comment.Created, id: comment.ID}
+	})
+
+	present := make(map[string]bool, len(comments))
+	for _, comment := range comments {
+		present[comment.ID] = true
+	}
+	children := make(map[string][]models.Comment, len(comments))
+	for _, comment := range comments {
+		parentID := comment.ParentID
+		if !present[parentID] {
+			parentID = ""
+		}
+		children[parentID] = append(children[parentID], comment)
+	}
+
+	threaded := make([]models.Comment, 0, len(comments))
+	var walk func(parentID string)
+	walk = func(parentID string) {
+		for _, comment := range children[parentID] {
+			threaded = append(threaded, comment)
+			walk(comment.ID)
+		}
+	}
+	walk("")
+	copy(comments, threaded)
+}
+
+// The part of an item of a listing that its rank is computed from
+type entry struct {
+	votes   []models.Vote
+	created time.Time
+	id      string
+}
+
+// The function of sorting the items in place by the rank of the sort
+func rank[T any](items []T, sortBy Sort, entryOf func(T) entry) {
+	entries := make([]entry, len(items))
+	keys := make([]float64, len(items))
+	for index, item := range items {
+		entries[index] = entryOf(item)
+		keys[index] = key(entries[index], sortBy)
+	}
+	sort.Sort(&byKey[T]{items: items, entries: entries, keys: keys})
+}
+
+// The function of the rank of the item for the sort, bigger ranks go first
+func key(item entry, sortBy Sort) float64 {
+	tally := scoring.FromVotes(item.votes)
+	switch sortBy {
+	case SortHot:
+		return Hot(tally.Score, item.created)
+	case SortTop:
+		return float64(tally.Score)
+	case SortControversial:
+		return Controversy(tally.Upvotes, tally.Downvotes)
+	case SortBest:
+		return Wilson(tally.Upvotes, tally.Downvotes)
+	default:
+		return float64(item.created.UnixNano())
+	}
+}
+
+// The items together with their precomputed ranks, sorted as one slice
+type byKey[T any] struct {
+	items   []T
+	entries []entry
+	keys    []float64
+}
+
+func (b *byKey[T]) Len() int {
+	return len(b.items)
+}
+
+func (b *byKey[T]) Less(i, j int) bool {
+	if b.keys[i] != b.keys[j] {
+		return b.keys[i] > b.keys[j]
+	}
+	if !b.entries[i].created.Equal(b.entries[j].created) {
+		return b.entries[i].created.After(b.entries[j].created)
+	}
+	return b.entries[i].id < b.entries[j].id
+}
+
+func (b *byKey[T]) Swap(i, j int) {
+	b.items[i], b.items[j] = b.items[j], b.items[i]
+	b.entries[i], b.entries[j] = b.entries[j], b.entries[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
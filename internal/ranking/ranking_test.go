@@ -0,0 +1,265 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The fixed moment the tests are computed at
+var testNow = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// The function of comparing floats computed in different ways
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// The function of making votes of the post: the upvotes followed by the downvotes
+func makeVotes(upvotes, downvotes int) []models.Vote {
+	votes := make([]models.Vote, 0, upvotes+downvotes)
+	for i := 0; i < upvotes; i++ {
+		votes = append(votes, models.Vote{UserID: "up" + string(rune('a'+i)), Vote: 1})
+	}
+	for i := 0; i < downvotes; i++ {
+		votes = append(votes, models.Vote{UserID: "down" + string(rune('a'+i)), Vote: -1})
+	}
+	return votes
+}
+
+// The function of making a post created age before testNow with the votes
+func makePost(id string, age time.Duration, upvotes, downvotes int) models.Post {
+	return models.Post{ID: id, Created: testNow.Add(-age), Votes: makeVotes(upvotes, downvotes)}
+}
+
+// The function of getting the IDs of the posts in their order
+func ids(posts []models.Post) []string {
+	result := make([]string, len(posts))
+	for index, post := range posts {
+		result[index] = post.ID
+	}
+	return result
+}
+
+// The function of comparing two lists of IDs
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHot(t *testing.T) {
+	tests := []struct {
+		score   int
+		created time.Time
+		want    float64
+	}{
+		{score: 0, created: hotEpoch, want: 0},
+		{score: 1, created: hotEpoch, want: 0},
+		{score: 10, created: hotEpoch, want: 1},
+		{score: -100, created: hotEpoch, want: -2},
+		{score: 0, created: hotEpoch.Add(hotDecaySeconds * time.Second), want: 1},
+		{score: 1000, created: hotEpoch.Add(2 * hotDecaySeconds * time.Second), want: 5},
+	}
+	for _, test := range tests {
+		if got := Hot(test.score, test.created); !near(got, test.want) {
+			t.Errorf("Hot(%d, %s) = %v, want %v", test.score, test.created, got, test.want)
+		}
+	}
+	// 12.5 hours of age weigh as much as a tenfold score
+	if !near(Hot(100, testNow.Add(-hotDecaySeconds*time.Second)), Hot(10, testNow)) {
+		t.Error("a tenfold score does not make up for 12.5 hours of age")
+	}
+}
+
+func TestWilson(t *testing.T) {
+	tests := []struct {
+		upvotes, downvotes int
+		want               float64
+	}{
+		{0, 0, 0},
+		{1, 0, 0.37844750322520615},
+		{0, 1, 0},
+		{1, 1, 0.16425172002984176},
+		{10, 1, 0.7394949884518779},
+		{100, 100, 0.45487521055824565},
+	}
+	for _, test := range tests {
+		if got := Wilson(test.upvotes, test.downvotes); !near(got, test.want) {
+			t.Errorf("Wilson(%d, %d) = %v, want %v", test.upvotes, test.downvotes, got, test.want)
+		}
+	}
+	// More votes with the same share give more confidence
+	if Wilson(100, 100) <= Wilson(1, 1) {
+		t.Error("Wilson of 100/100 is not above Wilson of 1/1")
+	}
+}
+
+func TestControversy(t *testing.T) {
+	tests := []struct {
+		upvotes, downvotes int
+		want               float64
+	}{
+		{0, 0, 0},
+		{5, 0, 0},
+		{0, 5, 0},
+		{1, 1, 2},
+		{10, 10, 20},
+		{10, 5, 3.872983346207417},
+		{5, 10, 3.872983346207417},
+	}
+	for _, test := range tests {
+		if got := Controversy(test.upvotes, test.downvotes); !near(got, test.want) {
+			t.Errorf("Controversy(%d, %d) = %v, want %v", test.upvotes, test.downvotes, got, test.want)
+		}
+	}
+}
+
+func TestFilterWindow(t *testing.T) {
+	posts := []models.Post{
+		makePost("minutes", 30*time.Minute, 0, 0),
+		makePost("boundary", time.Hour, 0, 0),
+		makePost("hours", 2*time.Hour, 0, 0),
+		makePost("days", 2*24*time.Hour, 0, 0),
+		makePost("years", 2*365*24*time.Hour, 0, 0),
+	}
+	tests := []struct {
+		window Window
+		want   []string
+	}{
+		{WindowHour, []string{"minutes", "boundary"}},
+		{WindowDay, []string{"minutes", "boundary", "hours"}},
+		{WindowWeek, []string{"minutes", "boundary", "hours", "days"}},
+		{WindowYear, []string{"minutes", "boundary", "hours", "days"}},
+		{WindowAll, []string{"minutes", "boundary", "hours", "days", "years"}},
+	}
+	for _, test := range tests {
+		if got := ids(FilterWindow(posts, test.window, testNow)); !equalIDs(got, test.want) {
+			t.Errorf("FilterWindow(%s) = %v, want %v", test.window, got, test.want)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		sortBy Sort
+		posts  []models.Post
+		want   []string
+	}{
+		{
+			sortBy: SortNew,
+			posts: []models.Post{
+				makePost("old", 3*time.Hour, 5, 0),
+				makePost("b", time.Hour, 0, 0),
+				makePost("a", time.Hour, 0, 0),
+				makePost("newest", 0, 0, 3),
+			},
+			want: []string{"newest", "a", "b", "old"},
+		},
+		{
+			// Equal scores are ordered from newer to older and then by ID
+			sortBy: SortTop,
+			posts: []models.Post{
+				makePost("older-two", 2*time.Hour, 2, 0),
+				makePost("negative", 0, 0, 1),
+				makePost("newer-two", time.Hour, 3, 1),
+				makePost("zero-b", time.Hour, 0, 0),
+				makePost("zero-a", time.Hour, 1, 1),
+			},
+			want: []string{"newer-two", "older-two", "zero-a", "zero-b", "negative"},
+		},
+		{
+			// A score of 100 from 12.5 hours ago beats a score of 1 now, a score of 10 from 25 hours ago does not
+			sortBy: SortHot,
+			posts: []models.Post{
+				makePost("old-ten", 25*time.Hour, 10, 0),
+				makePost("new-one", 0, 1, 0),
+				makePost("half-day-hundred", 12*time.Hour+30*time.Minute, 100, 0),
+				makePost("new-none", 0, 0, 0),
+			},
+			want: []string{"half-day-hundred", "new-none", "new-one", "old-ten"},
+		},
+		{
+			// Posts without downvotes or without votes are not controversial and keep the order by age
+			sortBy: SortControversial,
+			posts: []models.Post{
+				makePost("one-sided", 0, 10, 0),
+				makePost("small-split", time.Hour, 2, 2),
+				makePost("no-votes", 2*time.Hour, 0, 0),
+				makePost("big-split", 3*time.Hour, 5, 5),
+			},
+			want: []string{"big-split", "small-split", "one-sided", "no-votes"},
+		},
+		{
+			sortBy: SortBest,
+			posts: []models.Post{
+				makePost("single-up", 0, 1, 0),
+				makePost("no-votes", 0, 0, 0),
+				makePost("many-up", time.Hour, 10, 1),
+				makePost("single-down", 0, 0, 1),
+			},
+			want: []string{"many-up", "single-up", "no-votes", "single-down"},
+		},
+	}
+	for _, test := range tests {
+		posts := append([]models.Post(nil), test.posts...)
+		Rank(posts, test.sortBy)
+		if got := ids(posts); !equalIDs(got, test.want) {
+			t.Errorf("Rank(%s) = %v, want %v", test.sortBy, got, test.want)
+		}
+		// The order does not depend on the order of the input
+		reversed := make([]models.Post, len(test.posts))
+		for index, post := range test.posts {
+			reversed[len(test.posts)-1-index] = post
+		}
+		Rank(reversed, test.sortBy)
+		if got := ids(reversed); !equalIDs(got, test.want) {
+			t.Errorf("Rank(%s) of the reversed input = %v, want %v", test.sortBy, got, test.want)
+		}
+	}
+}
+
+func TestRankComments(t *testing.T) {
+	comment := func(id, parentID string, upvotes int) models.Comment {
+		return models.Comment{ID: id, ParentID: parentID, Created: testNow, Votes: makeVotes(upvotes, 0)}
+	}
+	comments := []models.Comment{
+		comment("low", "", 1),
+		comment("high", "", 5),
+		comment("low-reply", "low", 9),
+		comment("high-reply-low", "high", 0),
+		comment("high-reply-high", "high", 2),
+		comment("orphan", "missing", 3),
+	}
+	RankComments(comments, SortTop)
+	want := []string{"high", "high-reply-high", "high-reply-low", "orphan", "low", "low-reply"}
+	got := make([]string, len(comments))
+	for index, comment := range comments {
+		got[index] = comment.ID
+	}
+	if !equalIDs(got, want) {
+		t.Fatalf("RankComments = %v, want %v", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := ParseSort("rising"); err != ErrUnknownSort {
+		t.Errorf("ParseSort(rising) err %v, want ErrUnknownSort", err)
+	}
+	if sortBy, err := ParseSort("best"); err != nil || sortBy != SortBest {
+		t.Errorf("ParseSort(best) = %s, %v", sortBy, err)
+	}
+	if window, err := ParseWindow(""); err != nil || window != WindowAll {
+		t.Errorf("ParseWindow() = %s, %v, want all", window, err)
+	}
+	if _, err := ParseWindow("decade"); err != ErrUnknownWindow {
+		t.Errorf("ParseWindow(decade) err %v, want ErrUnknownWindow", err)
+	}
+}
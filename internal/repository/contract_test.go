@@ -0,0 +1,628 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The environment variable with the dsn of a Postgres database for the contract tests, the Postgres run is skipped without it
+const postgresDSNEnv = "REDDITCLONE_TEST_POSTGRES_DSN"
+
+// The repositories of one storage that the contract tests run against
+type contractStores struct {
+	users    UserRepository
+	sessions SessionRepository
+	posts    PostRepository
+	votes    VoteRepository
+	comments CommentRepository
+}
+
+// The function of running the test against every storage: memory, SQLite in a temporary file and Postgres if postgresDSNEnv is set
+func runContract(t *testing.T, test func(t *testing.T, stores contractStores)) {
+	t.Run("memory", func(t *testing.T) {
+		votes := NewMemoryVoteRepository()
+		test(t, contractStores{
+			users:    NewMemoryUserRepository(),
+			sessions: NewMemorySessionRepository(),
+			posts:    NewMemoryPostRepository(votes),
+			votes:    votes,
+			comments: NewMemoryCommentRepository(),
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, openSQLStores(t, DialectSQLite, SQLiteDSN(filepath.Join(t.TempDir(), "contract.db"))))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(postgresDSNEnv)
+		if dsn == "" {
+			t.Skipf("%s is not set", postgresDSNEnv)
+		}
+		test(t, openSQLStores(t, DialectPostgres, dsn))
+	})
+}
+
+// The function of opening the SQL database of the dialect and creating the repositories over it, the database is closed with the test
+func openSQLStores(t *testing.T, dialect, dsn string) contractStores {
+	t.Helper()
+	db, err := OpenSQL(dialect, dsn)
+	if err != nil {
+		t.Fatalf("OpenSQL: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return contractStores{
+		users:    NewSQLUserRepository(db),
+		sessions: NewSQLSessionRepository(db),
+		posts:    NewSQLPostRepository(db),
+		votes:    NewSQLVoteRepository(db),
+		comments: NewSQLCommentRepository(db),
+	}
+}
+
+// The function of generating an ID that is unique across the runs, so that a shared Postgres database can be reused
+func contractID(t *testing.T) string {
+	t.Helper()
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// The function of storing a new user
+func createContractUser(t *testing.T, stores contractStores) models.User {
+	t.Helper()
+	id := contractID(t)
+	user := models.User{ID: id, Username: "user" + id, Password: "hash"}
+	if err := stores.users.Create(&user); err != nil {
+		t.Fatalf("UserRepo Create: %s", err)
+	}
+	return models.User{ID: user.ID, Username: user.Username}
+}
+
+// The function of storing a new post of the author in the category
+func createContractPost(t *testing.T, stores contractStores, author models.User, category string, created time.Time) models.Post {
+	t.Helper()
+	post := models.Post{
+		ID:       contractID(t),
+		Type:     "text",
+		Title:    "title",
+		Author:   author,
+		Category: category,
+		Text:     "text",
+		Votes:    make([]models.Vote, 0),
+		Comments: make([]models.Comment, 0),
+		Created:  created,
+	}
+	if err := stores.posts.Create(&post); err != nil {
+		t.Fatalf("PostRepo Create: %s", err)
+	}
+	return post
+}
+
+// The function of storing a new comment of the author, a reply if parentID is set
+func createContractComment(t *testing.T, stores contractStores, postID, parentID string, author models.User) models.Comment {
+	t.Helper()
+	comment := models.Comment{
+		ID:       contractID(t),
+		ParentID: parentID,
+		Author:   author,
+		Body:     "body",
+		Created:  time.Now().UTC().Truncate(time.Second),
+	}
+	if err := stores.comments.Create(postID, &comment); err != nil {
+		t.Fatalf("CommentRepo Create: %s", err)
+	}
+	return comment
+}
+
+// The function of storing a new session of the user with the refresh token hash that expires at the time
+func createContractSession(t *testing.T, stores contractStores, user models.User, refreshTokenHash string, expires time.Time) models.Session {
+	t.Helper()
+	created := expires.Add(-time.Hour)
+	session := models.Session{
+		ID:               contractID(t),
+		UserID:           user.ID,
+		RefreshTokenHash: refreshTokenHash,
+		Created:          created,
+		LastSeen:         created,
+		Expires:          expires,
+	}
+	if err := stores.sessions.Create(&session); err != nil {
+		t.Fatalf("SessionRepo Create: %s", err)
+	}
+	return session
+}
+
+// The function of getting the IDs of the posts in their order
+func postIDs(posts []models.Post) []string {
+	ids := make([]string, len(posts))
+	for index, post := range posts {
+		ids[index] = post.ID
+	}
+	return ids
+}
+
+// The function of comparing two lists of IDs
+func sameIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestContractApplyVote(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		author := createContractUser(t, stores)
+		voters := []models.User{createContractUser(t, stores), createContractUser(t, stores), createContractUser(t, stores)}
+		post := createContractPost(t, stores, author, "music", time.Now().UTC().Truncate(time.Second))
+
+		steps := []struct {
+			voter      int
+			value      int
+			score      int
+			votes      int
+			percentage int
+		}{
+			{voter: 0, value: 1, score: 1, votes: 1, percentage: 100},
+			{voter: 1, value: 1, score: 2, votes: 2, percentage: 100},
+			{voter: 2, value: -1, score: 1, votes: 3, percentage: 67},
+			{voter: 2, value: 1, score: 3, votes: 3, percentage: 100},
+			{voter: 2, value: 1, score: 3, votes: 3, percentage: 100},
+			{voter: 0, value: 0, score: 2, votes: 2, percentage: 100},
+			{voter: 0, value: 0, score: 2, votes: 2, percentage: 100},
+			{voter: 1, value: -1, score: 0, votes: 2, percentage: 50},
+		}
+		for index, step := range steps {
+			voted, err := stores.posts.ApplyVote(post.ID, voters[step.voter].ID, step.value)
+			if err != nil {
+				t.Fatalf("step %d: ApplyVote: %s", index, err)
+			}
+			if voted.Score != step.score || len(voted.Votes) != step.votes || voted.UpvotePercentage != step.percentage {
+				t.Fatalf("step %d: got score %d, %d votes, %d%%, want %d, %d votes, %d%%",
+					index, voted.Score, len(voted.Votes), voted.UpvotePercentage, step.score, step.votes, step.percentage)
+			}
+			rating, err := stores.votes.GetRating(post.ID)
+			if err != nil {
+				t.Fatalf("step %d: GetRating: %s", index, err)
+			}
+			if rating.Score != step.score || rating.UpvotePercentage != step.percentage {
+				t.Fatalf("step %d: stored rating %+v, want score %d, %d%%", index, rating, step.score, step.percentage)
+			}
+		}
+
+		// The votes keep the order in which they were first cast
+		votes, err := stores.votes.GetByPostID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByPostID: %s", err)
+		}
+		if len(votes) != 2 || votes[0].UserID != voters[1].ID || votes[1].UserID != voters[2].ID {
+			t.Fatalf("votes %+v, want the votes of the second and the third voter", votes)
+		}
+
+		if _, err := stores.posts.ApplyVote(contractID(t), voters[0].ID, 1); !errors.Is(err, ErrPostNotFound) {
+			t.Fatalf("vote for an unknown post: got %v, want ErrPostNotFound", err)
+		}
+		if _, err := stores.posts.ApplyVote(post.ID, voters[0].ID, 2); !errors.Is(err, ErrInvalidVote) {
+			t.Fatalf("vote of 2: got %v, want ErrInvalidVote", err)
+		}
+	})
+}
+
+func TestContractGetPage(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		author := createContractUser(t, stores)
+		// A category of its own, so that the posts of the earlier runs on a shared database are not listed
+		category := "page" + contractID(t)
+		base := time.Now().UTC().Truncate(time.Second)
+
+		// Two posts are created at the same moment and are ordered by ID
+		created := []time.Time{base.Add(-4 * time.Hour), base.Add(-3 * time.Hour), base.Add(-2 * time.Hour), base.Add(-2 * time.Hour), base.Add(-time.Hour)}
+		posts := make([]models.Post, len(created))
+		for index, at := range created {
+			posts[index] = createContractPost(t, stores, author, category, at)
+		}
+		createContractPost(t, stores, author, "other"+contractID(t), base)
+
+		expected := append([]models.Post(nil), posts...)
+		sortNewestFirst(expected)
+		want := postIDs(expected)
+
+		first, err := stores.posts.GetPage(PostQuery{Category: category, Limit: 2})
+		if err != nil {
+			t.Fatalf("GetPage: %s", err)
+		}
+		if !sameIDs(postIDs(first.Posts), want[0:2]) || !first.HasMore {
+			t.Fatalf("first page %v (more %t), want %v (more true)", postIDs(first.Posts), first.HasMore, want[0:2])
+		}
+
+		cursor := CursorOf(first.Posts[1])
+		second, err := stores.posts.GetPage(PostQuery{Category: category, Limit: 2, After: &cursor})
+		if err != nil {
+			t.Fatalf("GetPage after: %s", err)
+		}
+		if !sameIDs(postIDs(second.Posts), want[2:4]) || !second.HasMore {
+			t.Fatalf("second page %v (more %t), want %v (more true)", postIDs(second.Posts), second.HasMore, want[2:4])
+		}
+
+		cursor = CursorOf(second.Posts[1])
+		last, err := stores.posts.GetPage(PostQuery{Category: category, Limit: 2, After: &cursor})
+		if err != nil {
+			t.Fatalf("GetPage after: %s", err)
+		}
+		if !sameIDs(postIDs(last.Posts), want[4:]) || last.HasMore {
+			t.Fatalf("last page %v (more %t), want %v (more false)", postIDs(last.Posts), last.HasMore, want[4:])
+		}
+
+		// Going back from the last page returns the second page in the same order
+		cursor = CursorOf(last.Posts[0])
+		back, err := stores.posts.GetPage(PostQuery{Category: category, Limit: 2, Before: &cursor})
+		if err != nil {
+			t.Fatalf("GetPage before: %s", err)
+		}
+		if !sameIDs(postIDs(back.Posts), want[2:4]) || !back.HasMore {
+			t.Fatalf("page before %v (more %t), want %v (more true)", postIDs(back.Posts), back.HasMore, want[2:4])
+		}
+
+		byAuthor, err := stores.posts.GetPage(PostQuery{Category: category, AuthorID: author.ID, Limit: 10})
+		if err != nil {
+			t.Fatalf("GetPage by author: %s", err)
+		}
+		if !sameIDs(postIDs(byAuthor.Posts), want) || byAuthor.HasMore {
+			t.Fatalf("posts of the author %v (more %t), want %v (more false)", postIDs(byAuthor.Posts), byAuthor.HasMore, want)
+		}
+	})
+}
+
+func TestContractSetLocked(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		author := createContractUser(t, stores)
+		post := createContractPost(t, stores, author, "news", time.Now().UTC().Truncate(time.Second))
+
+		locked, err := stores.posts.SetLocked(post.ID, true)
+		if err != nil {
+			t.Fatalf("SetLocked: %s", err)
+		}
+		if !locked.Locked || locked.ID != post.ID {
+			t.Fatalf("SetLocked returned %+v, want the locked post", locked)
+		}
+
+		// An update made with a copy read before the lock keeps the lock
+		post.Title = "edited"
+		if err := stores.posts.Update(&post); err != nil {
+			t.Fatalf("Update: %s", err)
+		}
+		stored, err := stores.posts.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %s", err)
+		}
+		if !stored.Locked || stored.Title != "edited" {
+			t.Fatalf("after Update locked %t with the title %q, want locked with the new title", stored.Locked, stored.Title)
+		}
+
+		unlocked, err := stores.posts.SetLocked(post.ID, false)
+		if err != nil {
+			t.Fatalf("SetLocked: %s", err)
+		}
+		if unlocked.Locked {
+			t.Fatal("SetLocked false returned a locked post")
+		}
+		if _, err := stores.posts.SetLocked(contractID(t), true); !errors.Is(err, ErrPostNotFound) {
+			t.Fatalf("SetLocked of an unknown post: got %v, want ErrPostNotFound", err)
+		}
+	})
+}
+
+func TestContractIncrementViews(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		author := createContractUser(t, stores)
+		post := createContractPost(t, stores, author, "news", time.Now().UTC().Truncate(time.Second))
+
+		const views = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, views)
+		for i := 0; i < views; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- stores.posts.IncrementViews(post.ID)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("IncrementViews: %s", err)
+			}
+		}
+
+		// An update made with a copy read before the views keeps them
+		post.Title = "edited"
+		if err := stores.posts.Update(&post); err != nil {
+			t.Fatalf("Update: %s", err)
+		}
+		stored, err := stores.posts.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %s", err)
+		}
+		if stored.Views != views || stored.Title != "edited" {
+			t.Fatalf("after Update %d views with the title %q, want %d views with the new title", stored.Views, stored.Title, views)
+		}
+		if err := stores.posts.IncrementViews(contractID(t)); !errors.Is(err, ErrPostNotFound) {
+			t.Fatalf("IncrementViews of an unknown post: got %v, want ErrPostNotFound", err)
+		}
+	})
+}
+
+func TestContractSetBanned(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		user := createContractUser(t, stores)
+		if err := stores.users.SetBanned(user.ID, true); err != nil {
+			t.Fatalf("SetBanned: %s", err)
+		}
+
+		// An update made with a copy read before the ban keeps the ban
+		user.Email = "banned@example.com"
+		if err := stores.users.Update(&user); err != nil {
+			t.Fatalf("Update: %s", err)
+		}
+		stored, err := stores.users.GetByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %s", err)
+		}
+		if !stored.Banned || stored.Email != "banned@example.com" {
+			t.Fatalf("after Update banned %t with the email %q, want banned with the new email", stored.Banned, stored.Email)
+		}
+
+		if err := stores.users.SetBanned(user.ID, false); err != nil {
+			t.Fatalf("SetBanned: %s", err)
+		}
+		if stored, err = stores.users.GetByID(user.ID); err != nil || stored.Banned {
+			t.Fatalf("after SetBanned false: %+v, %v", stored, err)
+		}
+		if err := stores.users.SetBanned(contractID(t), true); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("SetBanned of an unknown user: got %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+func TestContractVerifiedEmail(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		email := contractID(t) + "@example.com"
+		owner := createContractUser(t, stores)
+		owner.Password, owner.Email, owner.EmailVerified = "hash", email, true
+		if err := stores.users.Update(&owner); err != nil {
+			t.Fatalf("Update verifying the email: %s", err)
+		}
+
+		// The email may be set by other users, but not verified
+		other := createContractUser(t, stores)
+		other.Password, other.Email = "hash", email
+		if err := stores.users.Update(&other); err != nil {
+			t.Fatalf("Update with the unverified email: %s", err)
+		}
+		other.EmailVerified = true
+		if err := stores.users.Update(&other); !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("Update verifying the taken email: got %v, want ErrEmailTaken", err)
+		}
+		id := contractID(t)
+		created := models.User{ID: id, Username: "user" + id, Password: "hash", Email: email, EmailVerified: true}
+		if err := stores.users.Create(&created); !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("Create with the taken email: got %v, want ErrEmailTaken", err)
+		}
+		if stored, err := stores.users.GetByEmail(email); err != nil || stored.ID != owner.ID {
+			t.Fatalf("GetByEmail: %+v, %v, want the owner", stored, err)
+		}
+
+		// The ID and the username are taken too
+		for _, duplicate := range []models.User{{ID: owner.ID, Username: "user" + contractID(t)}, {ID: contractID(t), Username: owner.Username}} {
+			duplicate.Password = "hash"
+			if err := stores.users.Create(&duplicate); !errors.Is(err, ErrUserAlreadyExists) {
+				t.Fatalf("Create of %+v: got %v, want ErrUserAlreadyExists", duplicate, err)
+			}
+		}
+
+		// Once the owner changes the email, another user may verify it
+		owner.Email, owner.EmailVerified = "other-"+email, false
+		if err := stores.users.Update(&owner); err != nil {
+			t.Fatalf("Update changing the email: %s", err)
+		}
+		if err := stores.users.Update(&other); err != nil {
+			t.Fatalf("Update verifying the released email: %s", err)
+		}
+	})
+}
+
+func TestContractTOTP(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		user := createContractUser(t, stores)
+		if err := stores.users.EnrollTOTP(user.ID, "FIRST"); err != nil {
+			t.Fatalf("EnrollTOTP: %s", err)
+		}
+		if err := stores.users.EnrollTOTP(user.ID, "SECOND"); err != nil {
+			t.Fatalf("second EnrollTOTP: %s", err)
+		}
+		// The confirmation of the replaced secret is refused
+		if err := stores.users.EnableTOTP(user.ID, "FIRST", []string{"code"}); !errors.Is(err, ErrTOTPStateChanged) {
+			t.Fatalf("EnableTOTP of the replaced secret: got %v, want ErrTOTPStateChanged", err)
+		}
+		if err := stores.users.AdvanceTOTPStep(user.ID, 10); err != nil {
+			t.Fatalf("AdvanceTOTPStep: %s", err)
+		}
+		if err := stores.users.EnableTOTP(user.ID, "SECOND", []string{"first", "second"}); err != nil {
+			t.Fatalf("EnableTOTP: %s", err)
+		}
+		if err := stores.users.EnableTOTP(user.ID, "SECOND", []string{"other"}); !errors.Is(err, ErrTOTPStateChanged) {
+			t.Fatalf("second EnableTOTP: got %v, want ErrTOTPStateChanged", err)
+		}
+		if err := stores.users.EnrollTOTP(user.ID, "THIRD"); !errors.Is(err, ErrTOTPStateChanged) {
+			t.Fatalf("EnrollTOTP while enabled: got %v, want ErrTOTPStateChanged", err)
+		}
+
+		// An update made with a copy read before the enrollment keeps the second factors
+		user.Email = "totp@example.com"
+		if err := stores.users.Update(&user); err != nil {
+			t.Fatalf("Update: %s", err)
+		}
+		stored, err := stores.users.GetByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %s", err)
+		}
+		if !stored.TOTPEnabled || stored.TOTPSecret != "SECOND" || stored.TOTPLastStep != 10 || len(stored.RecoveryCodes) != 2 ||
+			stored.Email != "totp@example.com" {
+			t.Fatalf("after Update %+v, want the enabled TOTP and the new email", stored)
+		}
+
+		if err := stores.users.DisableTOTP(user.ID); err != nil {
+			t.Fatalf("DisableTOTP: %s", err)
+		}
+		if stored, err = stores.users.GetByID(user.ID); err != nil || stored.TOTPEnabled || stored.TOTPSecret != "" ||
+			stored.TOTPLastStep != 0 || len(stored.RecoveryCodes) != 0 {
+			t.Fatalf("after DisableTOTP: %+v, %v", stored, err)
+		}
+		if err := stores.users.DisableTOTP(contractID(t)); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("DisableTOTP of an unknown user: got %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+func TestContractRotate(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		now := time.Now().UTC().Truncate(time.Second)
+		user := createContractUser(t, stores)
+		first, second, third := contractID(t), contractID(t), contractID(t)
+		session := createContractSession(t, stores, user, first, now.Add(time.Hour))
+
+		rotated, err := stores.sessions.Rotate(first, second, now)
+		if err != nil {
+			t.Fatalf("Rotate: %s", err)
+		}
+		if rotated.ID != session.ID || rotated.RefreshTokenHash != second {
+			t.Fatalf("rotated session %+v, want %s with the new refresh token", rotated, session.ID)
+		}
+		if _, err := stores.sessions.Rotate(contractID(t), third, now); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("Rotate of an unknown token: got %v, want ErrSessionNotFound", err)
+		}
+
+		// The rotated token deletes the whole session, the current token of it stops working too
+		if _, err := stores.sessions.Rotate(first, third, now); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("Rotate of the rotated token: got %v, want ErrRefreshTokenReused", err)
+		}
+		if _, err := stores.sessions.GetByID(session.ID); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("GetByID after the reuse: got %v, want ErrSessionNotFound", err)
+		}
+		if _, err := stores.sessions.Rotate(second, third, now); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("Rotate of the current token after the reuse: got %v, want ErrSessionNotFound", err)
+		}
+
+		// An expired session is not rotated
+		expired := contractID(t)
+		createContractSession(t, stores, user, expired, now.Add(-time.Minute))
+		if _, err := stores.sessions.Rotate(expired, contractID(t), now); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("Rotate of an expired session: got %v, want ErrSessionNotFound", err)
+		}
+	})
+}
+
+func TestContractDeleteExpired(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		now := time.Now().UTC().Truncate(time.Second)
+		user := createContractUser(t, stores)
+		expired := createContractSession(t, stores, user, contractID(t), now.Add(-time.Minute))
+		expiring := createContractSession(t, stores, user, contractID(t), now)
+		live := createContractSession(t, stores, user, contractID(t), now.Add(time.Hour))
+
+		deleted, err := stores.sessions.DeleteExpired(now)
+		if err != nil {
+			t.Fatalf("DeleteExpired: %s", err)
+		}
+		if deleted < 1 {
+			t.Fatalf("DeleteExpired deleted %d sessions, want the expired one", deleted)
+		}
+		if _, err := stores.sessions.GetByID(expired.ID); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("GetByID of the expired session: got %v, want ErrSessionNotFound", err)
+		}
+		for _, kept := range []models.Session{expiring, live} {
+			if _, err := stores.sessions.GetByID(kept.ID); err != nil {
+				t.Fatalf("GetByID of the session expiring at %s: %s", kept.Expires, err)
+			}
+		}
+	})
+}
+
+func TestContractCommentTombstones(t *testing.T) {
+	runContract(t, func(t *testing.T, stores contractStores) {
+		author := createContractUser(t, stores)
+		post := createContractPost(t, stores, author, "funny", time.Now().UTC().Truncate(time.Second))
+
+		root := createContractComment(t, stores, post.ID, "", author)
+		reply := createContractComment(t, stores, post.ID, root.ID, author)
+		other := createContractComment(t, stores, post.ID, "", author)
+		if reply.Depth != 1 {
+			t.Fatalf("reply depth %d, want 1", reply.Depth)
+		}
+
+		// A comment with a reply becomes a tombstone
+		if err := stores.comments.Delete(post.ID, root.ID); err != nil {
+			t.Fatalf("Delete: %s", err)
+		}
+		comments, err := stores.comments.GetByPostID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByPostID: %s", err)
+		}
+		if len(comments) != 3 || comments[0].ID != root.ID {
+			t.Fatalf("comments %+v, want the tombstone, the reply and the other comment", comments)
+		}
+		tombstone := comments[0]
+		if !tombstone.Deleted || tombstone.Body != DeletedCommentBody || tombstone.Author.ID != "" {
+			t.Fatalf("tombstone %+v, want a deleted comment without body and author", tombstone)
+		}
+
+		// A tombstone can not be deleted, voted on or replied to
+		if err := stores.comments.Delete(post.ID, root.ID); !errors.Is(err, ErrCommentNotFound) {
+			t.Fatalf("Delete of a tombstone: got %v, want ErrCommentNotFound", err)
+		}
+		if _, err := stores.comments.ApplyVote(post.ID, root.ID, author.ID, 1); !errors.Is(err, ErrCommentNotFound) {
+			t.Fatalf("vote for a tombstone: got %v, want ErrCommentNotFound", err)
+		}
+		orphan := models.Comment{ID: contractID(t), ParentID: root.ID, Author: author, Body: "body", Created: time.Now().UTC()}
+		if err := stores.comments.Create(post.ID, &orphan); !errors.Is(err, ErrCommentNotFound) {
+			t.Fatalf("reply to a tombstone: got %v, want ErrCommentNotFound", err)
+		}
+
+		// Deleting the last reply removes the tombstone as well
+		if err := stores.comments.Delete(post.ID, reply.ID); err != nil {
+			t.Fatalf("Delete of the reply: %s", err)
+		}
+		comments, err = stores.comments.GetByPostID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByPostID: %s", err)
+		}
+		if len(comments) != 1 || comments[0].ID != other.ID {
+			t.Fatalf("comments %+v, want only the other comment", comments)
+		}
+
+		voted, err := stores.comments.ApplyVote(post.ID, other.ID, author.ID, -1)
+		if err != nil {
+			t.Fatalf("ApplyVote: %s", err)
+		}
+		if voted.Score != -1 || len(voted.Votes) != 1 {
+			t.Fatalf("voted comment %+v, want score -1 with one vote", voted)
+		}
+		if err := stores.comments.Delete(post.ID, contractID(t)); !errors.Is(err, ErrCommentNotFound) {
+			t.Fatalf("Delete of an unknown comment: got %v, want ErrCommentNotFound", err)
+		}
+	})
+}
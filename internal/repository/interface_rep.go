@@ -1,26 +1,46 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
 )
 
 // Implementation under Dependency Injection
 
-// User Service - an interface for working with users
+// User Service - an interface for working with users. UseRecoveryCode and AdvanceTOTPStep consume the second factors atomically,
+// so that a recovery code or a TOTP code accepted by one request is rejected for every other. Update keeps the ban and the second
+// factors of the user, they are only changed by SetBanned and the TOTP methods, so that saving a user read before a ban or
+// an enrollment does not undo it
 type UserRepository interface {
 	GetByUsername(username string) (*models.User, error)
 	GetByID(userID string) (*models.User, error)
+	GetByEmail(email string) (*models.User, error)
 	Create(user *models.User) error
+	Update(user *models.User) error
+	UseRecoveryCode(userID, codeHash string) error
+	AdvanceTOTPStep(userID string, step int64) error
+	EnrollTOTP(userID, secret string) error
+	EnableTOTP(userID, secret string, recoveryCodes []string) error
+	DisableTOTP(userID string) error
+	SetBanned(userID string, banned bool) error
 }
 
-// Session Repository session management interface
+// Session Repository session management interface. Rotate replaces the current refresh token of a session,
+// presenting an already rotated refresh token deletes its whole session and returns ErrRefreshTokenReused
 type SessionRepository interface {
-	GetByToken(token string) (*models.Session, error)
-	GetByUserID(userID string) (*models.Session, error)
+	GetByID(sessionID string) (*models.Session, error)
+	GetByUserID(userID string) ([]models.Session, error)
 	Create(session *models.Session) error
+	Rotate(refreshTokenHash, newRefreshTokenHash string, now time.Time) (*models.Session, error)
+	Touch(sessionID string, lastSeen time.Time) error
+	Delete(sessionID string) error
+	DeleteByUserID(userID string) error
+	DeleteExpired(now time.Time) (int, error)
 }
 
-// PostRepository interface for managing posts
+// PostRepository interface for managing posts, Update keeps the lock and the views of the post, they are only changed
+// by SetLocked and IncrementViews, so that concurrent views of a post are all counted
 type PostRepository interface {
 	GetAll() ([]models.Post, error)
 	GetByID(postID string) (*models.Post, error)
@@ -29,4 +49,73 @@ type PostRepository interface {
 	Create(post *models.Post) error
 	Delete(postID string) error
 	Update(post *models.Post) error
+	ApplyVote(postID, userID string, value int) (*models.Post, error)
+	SetLocked(postID string, locked bool) (*models.Post, error)
+	IncrementViews(postID string) error
+	GetPage(query PostQuery) (*PostPage, error)
+}
+
+// VoteRepository interface for managing the votes of posts, every method changes the votes atomically and keeps the rating of the post up to date
+type VoteRepository interface {
+	GetByPostID(postID string) ([]models.Vote, error)
+	GetRating(postID string) (models.Rating, error)
+	Cast(postID, userID string, value int) (models.Rating, error)
+	Remove(postID, userID string) (models.Rating, error)
+	DeleteByPostID(postID string) error
+}
+
+// CommentRepository interface for managing the comments of posts
+type CommentRepository interface {
+	GetByPostID(postID string) ([]models.Comment, error)
+	Create(postID string, comment *models.Comment) error
+	Delete(postID, commentID string) error
+	DeleteByPostID(postID string) error
+	ApplyVote(postID, commentID, userID string, value int) (*models.Comment, error)
+}
+
+// LoginAttemptRepository interface for counting the login attempts of the accounts and the IP addresses. Reserve checks the delay
+// of the key and counts the attempt as a failure in one step, so that parallel attempts can not all pass the check before any
+// of them is counted, the count starts over when the previous failure is older than resetAfter. Release takes back an attempt
+// that turned out to be successful. Only the counts are stored, the delays are decided by the caller
+type LoginAttemptRepository interface {
+	Reserve(key string, now time.Time, resetAfter time.Duration, delay func(failures int) time.Duration) (time.Duration, error)
+	Release(key string) error
+	Reset(key string) error
+	DeleteExpired(before time.Time) (int, error)
+}
+
+// UserTokenRepository interface for the single-use tokens sent to the users by email. Consume deletes the token and returns it
+// only if it has the purpose and has not expired, so that a token is accepted once
+type UserTokenRepository interface {
+	Create(token *models.UserToken) error
+	Consume(hash, purpose string, now time.Time) (*models.UserToken, error)
+	DeleteByUserID(userID, purpose string) error
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// IdentityRepository interface for the accounts of the users at the external identity providers
+type IdentityRepository interface {
+	Create(identity *models.Identity) error
+	Get(provider, subject string) (*models.Identity, error)
+}
+
+// AccessTokenRepository interface for the personal access tokens of the users. GetByHash returns the token whatever its expiry,
+// the caller checks it
+type AccessTokenRepository interface {
+	Create(token *models.AccessToken) error
+	GetByID(tokenID string) (*models.AccessToken, error)
+	GetByHash(hash string) (*models.AccessToken, error)
+	GetByUserID(userID string) ([]models.AccessToken, error)
+	Touch(tokenID string, lastUsed time.Time) error
+	Delete(tokenID string) error
+	DeleteByUserID(userID string) error
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// RoleRepository interface for the roles of the users, a role is granted to the user once for the whole site or for a category
+type RoleRepository interface {
+	Grant(grant *models.RoleGrant) error
+	Revoke(userID, role, category string) error
+	GetByUserID(userID string) ([]models.RoleGrant, error)
+	GetAll() ([]models.RoleGrant, error)
 }
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Errors related to the journal of memory repositories
+var (
+	ErrJournalClosed    = errors.New("journal is closed")
+	ErrCorruptedRecord  = errors.New("corrupted journal record")
+	ErrCorruptedJournal = errors.New("corrupted journal record followed by valid records")
+	ErrJournalNotLoaded = errors.New("journal is not loaded")
+)
+
+// Names of the operations written to the journals of the repositories
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+	opClear  = "clear"
+	opExpire = "expire"
+)
+
+// Size of the record header: the length of the payload and its crc32 checksum
+const journalHeaderSize = 8
+
+// The maximum payload size, a larger length in the header can only be the result of corruption
+const maxJournalRecordSize = 64 << 20
+
+// Journal - an append-only log of changes of one memory repository together with a compacted snapshot of its state.
+// Every record is stored as the length of the payload, its crc32 checksum and the JSON payload itself
+type Journal struct {
+	mu       sync.Mutex
+	logPath  string
+	snapPath string
+	file     journalFile
+}
+
+// The log file of the journal, the tests replace it to fail the writes
+type journalFile interface {
+	io.Writer
+	io.Seeker
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// A structure of one record of the journal
+type journalRecord struct {
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Snapshotter - an interface of the repositories whose state can be compacted into a snapshot
+type Snapshotter interface {
+	Snapshot() error
+}
+
+// The journal constructor, the files of the journal are named name.wal and name.snapshot in the directory dir
+func NewJournal(dir, name string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Journal{
+		logPath:  filepath.Join(dir, name+".wal"),
+		snapPath: filepath.Join(dir, name+".snapshot"),
+	}, nil
+}
+
+// The method of restoring the state: passes the snapshot to restore, then passes every record of the log to apply.
+// A corrupted last record, left by a write interrupted by a crash, is truncated, after which the journal is opened for appending.
+// A corrupted record followed by valid records is not truncated, so that they are not lost, and ErrCorruptedJournal is returned
+func (j *Journal) Load(restore func(snapshot json.RawMessage) error, apply func(op string, data json.RawMessage) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := os.ReadFile(j.snapPath)
+	if err == nil {
+		if err := restore(data); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	file, err := os.OpenFile(j.logPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	validSize, errReplay := replayJournal(file, apply)
+	if errors.Is(errReplay, ErrCorruptedRecord) {
+		trailing, err := lastRecordCorrupted(file, validSize)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if !trailing {
+			file.Close()
+			return fmt.Errorf("journal %s: %w at offset %d", j.logPath, ErrCorruptedJournal, validSize)
+		}
+		log.Printf("Journal %s: %s at offset %d, truncating", j.logPath, errReplay, validSize)
+		if err := file.Truncate(validSize); err != nil {
+			file.Close()
+			return err
+		}
+	} else if errReplay != nil {
+		file.Close()
+		return errReplay
+	}
+
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	j.file = file
+	return nil
+}
+
+// The method of appending a record about the operation op with the value to the log, the record is synced to the disk before returning.
+// A record that failed to be written or synced is cut off the log, so that the records appended after it are not taken for the
+// records following a corrupted one
+func (j *Journal) Append(op string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(journalRecord{Op: op, Data: data})
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, journalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[journalHeaderSize:], payload)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return ErrJournalNotLoaded
+	}
+	offset, err := j.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(frame); err != nil {
+		return j.rollback(offset, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return j.rollback(offset, err)
+	}
+	return nil
+}
+
+// The method of cutting the log back to the offset after the failed append err, returns err.
+// If the log can not be cut the journal is closed, so that no record is appended after the broken one
+func (j *Journal) rollback(offset int64, err error) error {
+	errTruncate := j.file.Truncate(offset)
+	if errTruncate == nil {
+		_, errTruncate = j.file.Seek(offset, io.SeekStart)
+	}
+	if errTruncate != nil {
+		log.Printf("Journal %s: rollback to offset %d err: %s, closing", j.logPath, offset, errTruncate)
+		j.file.Close()
+		j.file = nil
+		return errors.Join(err, errTruncate)
+	}
+	return err
+}
+
+// The method of replacing the snapshot with the state and clearing the log.
+// The caller must hold the lock of the repository so that no records are appended in between
+func (j *Journal) Compact(state any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return ErrJournalNotLoaded
+	}
+
+	tmpPath := j.snapPath + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, j.snapPath); err != nil {
+		return err
+	}
+	// The rename must reach the disk before the log is cleared, otherwise a crash could lose both of them
+	if err := syncDir(filepath.Dir(j.snapPath)); err != nil {
+		return err
+	}
+
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = j.file.Seek(0, io.SeekStart)
+	return err
+}
+
+// The method of closing the log file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return ErrJournalClosed
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// The function of reading the records of the log from the beginning, returns the size of the correct part of the log.
+// ErrCorruptedRecord is returned at the first incomplete or damaged record
+func replayJournal(file *os.File, apply func(op string, data json.RawMessage) error) (int64, error) {
+	reader := bufio.NewReader(file)
+	var offset int64
+	header := make([]byte, journalHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, ErrCorruptedRecord
+		}
+
+		size := binary.BigEndian.Uint32(header[0:4])
+		if size > maxJournalRecordSize {
+			return offset, ErrCorruptedRecord
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return offset, ErrCorruptedRecord
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return offset, ErrCorruptedRecord
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return offset, ErrCorruptedRecord
+		}
+		if err := apply(record.Op, record.Data); err != nil {
+			return offset, err
+		}
+		offset += int64(journalHeaderSize) + int64(size)
+	}
+}
+
+// The function of checking that the corrupted record at the offset is the last record of the log: no valid record starts anywhere after it.
+// Appends are written with one write each, so a crash can only damage the last record
+func lastRecordCorrupted(file *os.File, offset int64) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	rest := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(rest, offset); err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	for start := 1; start+journalHeaderSize <= len(rest); start++ {
+		if validRecordAt(rest[start:]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// The function of checking that the data starts with a complete record whose checksum matches and whose payload is a journal record
+func validRecordAt(data []byte) bool {
+	size := binary.BigEndian.Uint32(data[0:4])
+	if size > maxJournalRecordSize || uint64(size) > uint64(len(data)-journalHeaderSize) {
+		return false
+	}
+	payload := data[journalHeaderSize : journalHeaderSize+int(size)]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:8]) {
+		return false
+	}
+	var record journalRecord
+	return json.Unmarshal(payload, &record) == nil && record.Op != ""
+}
+
+// The function of syncing the directory to the disk, so that the files renamed in it are not lost in a crash
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// The function of periodically taking snapshots of the repositories, it is meant to be run in its own goroutine
+func RunSnapshots(interval time.Duration, repos ...Snapshotter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, repo := range repos {
+			if err := repo.Snapshot(); err != nil {
+				log.Printf("RunSnapshots Snapshot err: %s", err)
+			}
+		}
+	}
+}
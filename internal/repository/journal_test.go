@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The function of loading the journal and collecting the values of the records it replays
+func loadJournal(t *testing.T, journal *Journal) ([]string, error) {
+	t.Helper()
+	var values []string
+	apply := func(op string, data json.RawMessage) error {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		values = append(values, value)
+		return nil
+	}
+	restore := func(snapshot json.RawMessage) error {
+		return json.Unmarshal(snapshot, &values)
+	}
+	err := journal.Load(restore, apply)
+	return values, err
+}
+
+// The function of writing the values to a new journal in the directory and closing it, returns the sizes of the log after every record
+func writeJournal(t *testing.T, dir string, values ...string) []int64 {
+	t.Helper()
+	journal, err := NewJournal(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJournal(t, journal); err != nil {
+		t.Fatal(err)
+	}
+	sizes := make([]int64, 0, len(values))
+	for _, value := range values {
+		if err := journal.Append(opCreate, value); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(dir, "test.wal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, info.Size())
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sizes
+}
+
+// The function of changing one byte of the file
+func flipByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A log file whose next write stores only a part of the data and fails, or whose next sync fails
+type failingFile struct {
+	*os.File
+	failWrite bool
+	failSync  bool
+}
+
+// The method of writing the data, a failing write stores only its first half
+func (f *failingFile) Write(data []byte) (int, error) {
+	if f.failWrite {
+		f.failWrite = false
+		n, _ := f.File.Write(data[:len(data)/2])
+		return n, errors.New("disk full")
+	}
+	return f.File.Write(data)
+}
+
+// The method of syncing the file to the disk
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		f.failSync = false
+		return errors.New("sync failed")
+	}
+	return f.File.Sync()
+}
+
+func TestJournalTruncatesTornLastRecord(t *testing.T) {
+	dir := t.TempDir()
+	sizes := writeJournal(t, dir, "a", "b", "c")
+	logPath := filepath.Join(dir, "test.wal")
+	// A crash in the middle of the last write leaves only a part of the record
+	if err := os.Truncate(logPath, sizes[2]-3); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, _ := NewJournal(dir, "test")
+	values, err := loadJournal(t, journal)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer journal.Close()
+	if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Fatalf("values %v, want [a b]", values)
+	}
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != sizes[1] {
+		t.Fatalf("log size %d, want %d", info.Size(), sizes[1])
+	}
+}
+
+func TestJournalTruncatesDamagedLastRecord(t *testing.T) {
+	dir := t.TempDir()
+	sizes := writeJournal(t, dir, "a", "b")
+	flipByte(t, filepath.Join(dir, "test.wal"), sizes[1]-2)
+
+	journal, _ := NewJournal(dir, "test")
+	values, err := loadJournal(t, journal)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer journal.Close()
+	if len(values) != 1 || values[0] != "a" {
+		t.Fatalf("values %v, want [a]", values)
+	}
+}
+
+func TestJournalRefusesDamagedMiddleRecord(t *testing.T) {
+	dir := t.TempDir()
+	sizes := writeJournal(t, dir, "a", "b", "c")
+	logPath := filepath.Join(dir, "test.wal")
+	flipByte(t, logPath, sizes[1]-2)
+
+	journal, _ := NewJournal(dir, "test")
+	if _, err := loadJournal(t, journal); !errors.Is(err, ErrCorruptedJournal) {
+		t.Fatalf("Load: got %v, want ErrCorruptedJournal", err)
+	}
+	// The valid record after the damaged one is kept for the repair
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != sizes[2] {
+		t.Fatalf("log size %d, want the untouched %d", info.Size(), sizes[2])
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := NewJournal(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJournal(t, journal); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"a", "b"} {
+		if err := journal.Append(opCreate, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Compact([]string{"a", "b"}); err != nil {
+		t.Fatalf("Compact: %s", err)
+	}
+	if err := journal.Append(opCreate, "c"); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	reopened, _ := NewJournal(dir, "test")
+	values, err := loadJournal(t, reopened)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer reopened.Close()
+	if len(values) != 3 || values[0] != "a" || values[1] != "b" || values[2] != "c" {
+		t.Fatalf("values %v, want [a b c]", values)
+	}
+}
+
+func TestJournalAppendRollsBackFailedRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		file func(file *os.File) *failingFile
+	}{
+		{name: "failed write", file: func(file *os.File) *failingFile { return &failingFile{File: file, failWrite: true} }},
+		{name: "failed sync", file: func(file *os.File) *failingFile { return &failingFile{File: file, failSync: true} }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			journal, err := NewJournal(dir, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadJournal(t, journal); err != nil {
+				t.Fatal(err)
+			}
+			if err := journal.Append(opCreate, "a"); err != nil {
+				t.Fatal(err)
+			}
+			journal.file = test.file(journal.file.(*os.File))
+			if err := journal.Append(opCreate, "lost"); err == nil {
+				t.Fatal("Append succeeded despite the failure")
+			}
+			// The record appended after the failed one follows the previous record, not the broken one
+			if err := journal.Append(opCreate, "b"); err != nil {
+				t.Fatalf("Append after the failure: %s", err)
+			}
+			journal.Close()
+
+			reopened, _ := NewJournal(dir, "test")
+			values, err := loadJournal(t, reopened)
+			if err != nil {
+				t.Fatalf("Load: %s", err)
+			}
+			defer reopened.Close()
+			if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+				t.Fatalf("values %v, want [a b]", values)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+var (
+	ErrAccessTokenNotFound      = errors.New("access token not found")
+	ErrAccessTokenAlreadyExists = errors.New("access token already exists")
+)
+
+type MemoryAccessTokenRepository struct {
+	tokens  map[string]*models.AccessToken // tokens by ID
+	hashes  map[string]string              // hash of a token -> its ID
+	mu      sync.RWMutex
+	journal *Journal
+}
+
+// A structure of the access token in the journal
+type accessTokenRecord struct {
+	ID       string     `json:"id"`
+	UserID   string     `json:"userID"`
+	Name     string     `json:"name,omitempty"`
+	Hash     string     `json:"hash,omitempty"`
+	Scopes   []string   `json:"scopes,omitempty"`
+	Created  time.Time  `json:"created"`
+	Expires  time.Time  `json:"expires"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// Access token repository constructor
+func NewMemoryAccessTokenRepository() *MemoryAccessTokenRepository {
+	return &MemoryAccessTokenRepository{
+		tokens: make(map[string]*models.AccessToken),
+		hashes: make(map[string]string),
+	}
+}
+
+// Access token repository constructor that restores tokens from the journal and writes every change to it
+func NewDurableMemoryAccessTokenRepository(journal *Journal) (*MemoryAccessTokenRepository, error) {
+	r := NewMemoryAccessTokenRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var records []accessTokenRecord
+		if err := json.Unmarshal(snapshot, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			r.add(record.toAccessToken())
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all tokens and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryAccessTokenRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	records := make([]accessTokenRecord, 0, len(r.tokens))
+	for _, token := range r.tokens {
+		records = append(records, newAccessTokenRecord(token))
+	}
+	return r.journal.Compact(records)
+}
+
+// The method of applying a journal record to the tokens during the restore
+func (r *MemoryAccessTokenRepository) apply(op string, data json.RawMessage) error {
+	var record accessTokenRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	switch op {
+	case opCreate:
+		r.add(record.toAccessToken())
+	case opUpdate:
+		if record.LastUsed != nil {
+			r.touch(record.ID, *record.LastUsed)
+		}
+	case opDelete:
+		r.delete(record.ID)
+	case opClear:
+		r.deleteByUserID(record.UserID)
+	case opExpire:
+		r.deleteExpired(record.Expires)
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the maps
+func (r *MemoryAccessTokenRepository) writeJournal(op string, record accessTokenRecord) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, record)
+}
+
+// The function of converting the token to its journal record
+func newAccessTokenRecord(token *models.AccessToken) accessTokenRecord {
+	return accessTokenRecord{
+		ID:       token.ID,
+		UserID:   token.UserID,
+		Name:     token.Name,
+		Hash:     token.Hash,
+		Scopes:   token.Scopes,
+		Created:  token.Created,
+		Expires:  token.Expires,
+		LastUsed: token.LastUsed,
+	}
+}
+
+// The method of converting the journal record back to the token
+func (record accessTokenRecord) toAccessToken() *models.AccessToken {
+	return &models.AccessToken{
+		ID:       record.ID,
+		UserID:   record.UserID,
+		Name:     record.Name,
+		Hash:     record.Hash,
+		Scopes:   record.Scopes,
+		Created:  record.Created,
+		Expires:  record.Expires,
+		LastUsed: record.LastUsed,
+	}
+}
+
+// The function of copying the token, so that the callers do not share its scopes and last-used time with the repository
+func copyAccessToken(token *models.AccessToken) *models.AccessToken {
+	copied := *token
+	copied.Scopes = append([]string(nil), token.Scopes...)
+	if token.LastUsed != nil {
+		lastUsed := *token.LastUsed
+		copied.LastUsed = &lastUsed
+	}
+	return &copied
+}
+
+// The method of saving a new token; causes an error ErrAccessTokenAlreadyExists if a token with such an ID or hash already exists
+func (r *MemoryAccessTokenRepository) Create(token *models.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tokens[token.ID]; exists {
+		return ErrAccessTokenAlreadyExists
+	}
+	if _, exists := r.hashes[token.Hash]; exists {
+		return ErrAccessTokenAlreadyExists
+	}
+	if err := r.writeJournal(opCreate, newAccessTokenRecord(token)); err != nil {
+		return err
+	}
+	r.add(copyAccessToken(token))
+	return nil
+}
+
+// The method of obtaining a token by ID; returns ErrAccessTokenNotFound if there is no such token
+func (r *MemoryAccessTokenRepository) GetByID(tokenID string) (*models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	token, exists := r.tokens[tokenID]
+	if !exists {
+		return nil, ErrAccessTokenNotFound
+	}
+	return copyAccessToken(token), nil
+}
+
+// The method of obtaining a token by the hash of its value; returns ErrAccessTokenNotFound if there is no such token
+func (r *MemoryAccessTokenRepository) GetByHash(hash string) (*models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tokenID, exists := r.hashes[hash]
+	if !exists {
+		return nil, ErrAccessTokenNotFound
+	}
+	return copyAccessToken(r.tokens[tokenID]), nil
+}
+
+// The method of obtaining all tokens of the user, a user without tokens gets an empty slice
+func (r *MemoryAccessTokenRepository) GetByUserID(userID string) ([]models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tokens := make([]models.AccessToken, 0)
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, *copyAccessToken(token))
+		}
+	}
+	return tokens, nil
+}
+
+// The method of recording the time the token was last used, returns ErrAccessTokenNotFound if there is no such token
+func (r *MemoryAccessTokenRepository) Touch(tokenID string, lastUsed time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tokens[tokenID]; !exists {
+		return ErrAccessTokenNotFound
+	}
+	if err := r.writeJournal(opUpdate, accessTokenRecord{ID: tokenID, LastUsed: &lastUsed}); err != nil {
+		return err
+	}
+	r.touch(tokenID, lastUsed)
+	return nil
+}
+
+// The method of deleting the token with the ID, returns ErrAccessTokenNotFound if there is no such token
+func (r *MemoryAccessTokenRepository) Delete(tokenID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tokens[tokenID]; !exists {
+		return ErrAccessTokenNotFound
+	}
+	if err := r.writeJournal(opDelete, accessTokenRecord{ID: tokenID}); err != nil {
+		return err
+	}
+	r.delete(tokenID)
+	return nil
+}
+
+// The method of deleting all tokens of the user
+func (r *MemoryAccessTokenRepository) DeleteByUserID(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writeJournal(opClear, accessTokenRecord{UserID: userID}); err != nil {
+		return err
+	}
+	r.deleteByUserID(userID)
+	return nil
+}
+
+// The method of deleting the tokens that have expired by now, returns the number of deleted tokens
+func (r *MemoryAccessTokenRepository) DeleteExpired(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := false
+	for _, token := range r.tokens {
+		if !now.Before(token.Expires) {
+			expired = true
+			break
+		}
+	}
+	// Sweeps that find nothing are not written to the journal
+	if !expired {
+		return 0, nil
+	}
+	if err := r.writeJournal(opExpire, accessTokenRecord{Expires: now}); err != nil {
+		return 0, err
+	}
+	return r.deleteExpired(now), nil
+}
+
+// The method of adding the token to the maps, must be called under the lock
+func (r *MemoryAccessTokenRepository) add(token *models.AccessToken) {
+	r.tokens[token.ID] = token
+	r.hashes[token.Hash] = token.ID
+}
+
+// The method of moving the last-used time of the token forward, must be called under the lock
+func (r *MemoryAccessTokenRepository) touch(tokenID string, lastUsed time.Time) {
+	token, exists := r.tokens[tokenID]
+	if exists && (token.LastUsed == nil || lastUsed.After(*token.LastUsed)) {
+		token.LastUsed = &lastUsed
+	}
+}
+
+// The method of deleting the token together with its hash, must be called under the lock
+func (r *MemoryAccessTokenRepository) delete(tokenID string) {
+	token, exists := r.tokens[tokenID]
+	if !exists {
+		return
+	}
+	delete(r.hashes, token.Hash)
+	delete(r.tokens, tokenID)
+}
+
+// The method of deleting all tokens of the user, must be called under the lock
+func (r *MemoryAccessTokenRepository) deleteByUserID(userID string) {
+	for tokenID, token := range r.tokens {
+		if token.UserID == userID {
+			r.delete(tokenID)
+		}
+	}
+}
+
+// The method of deleting the tokens that have expired by now, must be called under the lock
+func (r *MemoryAccessTokenRepository) deleteExpired(now time.Time) int {
+	deleted := 0
+	for tokenID, token := range r.tokens {
+		if !now.Before(token.Expires) {
+			r.delete(tokenID)
+			deleted++
+		}
+	}
+	return deleted
+}
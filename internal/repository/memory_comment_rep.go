@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/scoring"
+)
+
+// Errors related to processing comments
+var (
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrCommentAlreadyExists = errors.New("comment already exists")
+	ErrCommentTooDeep       = errors.New("comment is nested too deep")
+)
+
+// The maximum depth of a reply, top-level comments have depth 0
+const MaxCommentDepth = 10
+
+// The body that replaces the body of a deleted comment which still has replies
+const DeletedCommentBody = "[deleted]"
+
+// A structure that stores the comments of posts and implements the CommentRepository interface
+type MemoryCommentRepository struct {
+	comments map[string][]models.Comment
+	mu       sync.RWMutex
+	journal  *Journal
+}
+
+// A structure of the comment in the journal, UserID and Vote are only set in the records of votes
+type commentRecord struct {
+	PostID  string         `json:"postID"`
+	Comment models.Comment `json:"comment"`
+	UserID  string         `json:"userID,omitempty"`
+	Vote    int            `json:"vote,omitempty"`
+}
+
+// Comment repository constructor
+func NewMemoryCommentRepository() *MemoryCommentRepository {
+	return &MemoryCommentRepository{comments: make(map[string][]models.Comment)}
+}
+
+// Comment repository constructor that restores comments from the journal and writes every change to it
+func NewDurableMemoryCommentRepository(journal *Journal) (*MemoryCommentRepository, error) {
+	r := NewMemoryCommentRepository()
+	restore := func(snapshot json.RawMessage) error {
+		return json.Unmarshal(snapshot, &r.comments)
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all comments and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryCommentRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Compact(r.comments)
+}
+
+// The method of getting the comments of the post in the order in which they were added
+func (r *MemoryCommentRepository) GetByPostID(postID string) ([]models.Comment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	comments := make([]models.Comment, len(r.comments[postID]))
+	for index, comment := range r.comments[postID] {
+		comments[index] = copyComment(comment)
+	}
+	return comments, nil
+}
+
+// The method of adding a comment to the post. A reply must have ParentID set, its depth is derived from the parent.
+// Returns ErrCommentAlreadyExists if the post already has a comment with the same ID, ErrCommentNotFound if the parent
+// does not exist or is deleted and ErrCommentTooDeep if the reply would be deeper than MaxCommentDepth
+func (r *MemoryCommentRepository) Create(postID string, comment *models.Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.indexOf(postID, comment.ID) >= 0 {
+		return ErrCommentAlreadyExists
+	}
+	comment.Depth = 0
+	comment.Votes = make([]models.Vote, 0)
+	comment.Score, comment.UpvotePercentage = 0, 0
+	if comment.ParentID != "" {
+		index := r.indexOf(postID, comment.ParentID)
+		if index < 0 || r.comments[postID][index].Deleted {
+			return ErrCommentNotFound
+		}
+		comment.Depth = r.comments[postID][index].Depth + 1
+		if comment.Depth > MaxCommentDepth {
+			return ErrCommentTooDeep
+		}
+	}
+	if err := r.writeJournal(opCreate, commentRecord{PostID: postID, Comment: *comment}); err != nil {
+		return err
+	}
+	r.comments[postID] = append(r.comments[postID], *comment)
+	return nil
+}
+
+// The method of deleting the comment of the post, returns ErrCommentNotFound if the post has no such comment.
+// A comment with replies is replaced with a tombstone so that the thread stays intact
+func (r *MemoryCommentRepository) Delete(postID, commentID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index := r.indexOf(postID, commentID)
+	if index < 0 || r.comments[postID][index].Deleted {
+		return ErrCommentNotFound
+	}
+	record := commentRecord{PostID: postID, Comment: models.Comment{ID: commentID}}
+	if err := r.writeJournal(opDelete, record); err != nil {
+		return err
+	}
+	r.remove(postID, commentID)
+	return nil
+}
+
+// The method of deleting all comments of the post
+func (r *MemoryCommentRepository) DeleteByPostID(postID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writeJournal(opClear, commentRecord{PostID: postID}); err != nil {
+		return err
+	}
+	delete(r.comments, postID)
+	return nil
+}
+
+// The method of casting (value 1 or -1) or removing (value 0) the vote of the user for the comment of the post under the lock of the repository,
+// returns a copy of the comment with its votes and rating right after the change, or ErrCommentNotFound if there is no such comment or it is deleted
+func (r *MemoryCommentRepository) ApplyVote(postID, commentID, userID string, value int) (*models.Comment, error) {
+	if value != 1 && value != -1 && value != 0 {
+		return nil, ErrInvalidVote
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index := r.indexOf(postID, commentID)
+	if index < 0 || r.comments[postID][index].Deleted {
+		return nil, ErrCommentNotFound
+	}
+	record := commentRecord{PostID: postID, Comment: models.Comment{ID: commentID}, UserID: userID, Vote: value}
+	if err := r.writeJournal(opUpdate, record); err != nil {
+		return nil, err
+	}
+	comment := &r.comments[postID][index]
+	changeCommentVote(comment, userID, value)
+	commentCopy := copyComment(*comment)
+	return &commentCopy, nil
+}
+
+// The function of casting (value 1 or -1) or removing (value 0) the vote of the user and updating the rating of the comment
+func changeCommentVote(comment *models.Comment, userID string, value int) {
+	index := -1
+	for i, vote := range comment.Votes {
+		if vote.UserID == userID {
+			index = i
+			break
+		}
+	}
+	switch {
+	case value == 0 && index >= 0:
+		comment.Votes = append(comment.Votes[:index], comment.Votes[index+1:]...)
+	case value != 0 && index >= 0:
+		comment.Votes[index].Vote = value
+	case value != 0:
+		comment.Votes = append(comment.Votes, models.Vote{UserID: userID, Vote: value})
+	}
+	rating := scoring.FromVotes(comment.Votes).Rating()
+	comment.Score = rating.Score
+	comment.UpvotePercentage = rating.UpvotePercentage
+}
+
+// The function of copying the comment together with its votes
+func copyComment(comment models.Comment) models.Comment {
+	votes := make([]models.Vote, len(comment.Votes))
+	copy(votes, comment.Votes)
+	comment.Votes = votes
+	return comment
+}
+
+// The method of finding the index of the comment of the post, returns -1 if there is no such comment, must be called under the lock
+func (r *MemoryCommentRepository) indexOf(postID, commentID string) int {
+	for index, comment := range r.comments[postID] {
+		if comment.ID == commentID {
+			return index
+		}
+	}
+	return -1
+}
+
+// The method of checking that the comment of the post has replies, must be called under the lock
+func (r *MemoryCommentRepository) hasReplies(postID, commentID string) bool {
+	for _, comment := range r.comments[postID] {
+		if comment.ParentID == commentID {
+			return true
+		}
+	}
+	return false
+}
+
+// The method of deleting the comment or replacing it with a tombstone if it has replies.
+// Tombstones left without replies are removed up the thread, must be called under the lock
+func (r *MemoryCommentRepository) remove(postID, commentID string) {
+	for commentID != "" {
+		index := r.indexOf(postID, commentID)
+		if index < 0 {
+			return
+		}
+		comment := &r.comments[postID][index]
+		if r.hasReplies(postID, commentID) {
+			comment.Deleted = true
+			comment.Body = DeletedCommentBody
+			comment.Author = models.User{}
+			return
+		}
+		parentID := comment.ParentID
+		r.comments[postID] = append(r.comments[postID][:index], r.comments[postID][index+1:]...)
+
+		commentID = ""
+		if parent := r.indexOf(postID, parentID); parent >= 0 && r.comments[postID][parent].Deleted {
+			commentID = parentID
+		}
+	}
+}
+
+// The method of applying a journal record to the comments during the restore
+func (r *MemoryCommentRepository) apply(op string, data json.RawMessage) error {
+	var record commentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	switch op {
+	case opCreate:
+		if r.indexOf(record.PostID, record.Comment.ID) < 0 {
+			r.comments[record.PostID] = append(r.comments[record.PostID], record.Comment)
+		}
+	case opUpdate:
+		if index := r.indexOf(record.PostID, record.Comment.ID); index >= 0 {
+			changeCommentVote(&r.comments[record.PostID][index], record.UserID, record.Vote)
+		}
+	case opDelete:
+		r.remove(record.PostID, record.Comment.ID)
+	case opClear:
+		delete(r.comments, record.PostID)
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemoryCommentRepository) writeJournal(op string, record commentRecord) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, record)
+}
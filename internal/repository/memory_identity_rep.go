@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+var (
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrIdentityAlreadyExists = errors.New("identity already exists")
+)
+
+type MemoryIdentityRepository struct {
+	identities map[identityKey]*models.Identity
+	mu         sync.RWMutex
+	journal    *Journal
+}
+
+// The key of an identity: the provider and the subject at it
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+// A structure of the identity in the journal
+type identityRecord struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	UserID   string    `json:"userID"`
+	Created  time.Time `json:"created"`
+}
+
+// Identity repository constructor
+func NewMemoryIdentityRepository() *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{identities: make(map[identityKey]*models.Identity)}
+}
+
+// Identity repository constructor that restores identities from the journal and writes every change to it
+func NewDurableMemoryIdentityRepository(journal *Journal) (*MemoryIdentityRepository, error) {
+	r := NewMemoryIdentityRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var records []identityRecord
+		if err := json.Unmarshal(snapshot, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			r.add(record.toIdentity())
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all identities and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryIdentityRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	records := make([]identityRecord, 0, len(r.identities))
+	for _, identity := range r.identities {
+		records = append(records, newIdentityRecord(identity))
+	}
+	return r.journal.Compact(records)
+}
+
+// The method of applying a journal record to the identities during the restore
+func (r *MemoryIdentityRepository) apply(op string, data json.RawMessage) error {
+	var record identityRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	if op == opCreate {
+		r.add(record.toIdentity())
+	}
+	return nil
+}
+
+// The function of converting the identity to its journal record
+func newIdentityRecord(identity *models.Identity) identityRecord {
+	return identityRecord{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   identity.UserID,
+		Created:  identity.Created,
+	}
+}
+
+// The method of converting the journal record back to the identity
+func (record identityRecord) toIdentity() *models.Identity {
+	return &models.Identity{
+		Provider: record.Provider,
+		Subject:  record.Subject,
+		UserID:   record.UserID,
+		Created:  record.Created,
+	}
+}
+
+// The method of saving a new identity; causes an error ErrIdentityAlreadyExists if the subject of the provider is already linked
+func (r *MemoryIdentityRepository) Create(identity *models.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.identities[identityKey{identity.Provider, identity.Subject}]; exists {
+		return ErrIdentityAlreadyExists
+	}
+	if r.journal != nil {
+		if err := r.journal.Append(opCreate, newIdentityRecord(identity)); err != nil {
+			return err
+		}
+	}
+	identityCopy := *identity
+	r.add(&identityCopy)
+	return nil
+}
+
+// The method of obtaining the identity of the subject at the provider; return ErrIdentityNotFound if it is not linked to any user
+func (r *MemoryIdentityRepository) Get(provider, subject string) (*models.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	identity, exists := r.identities[identityKey{provider, subject}]
+	if !exists {
+		return nil, ErrIdentityNotFound
+	}
+	identityCopy := *identity
+	return &identityCopy, nil
+}
+
+// The method of adding the identity to the map, must be called under the lock
+func (r *MemoryIdentityRepository) add(identity *models.Identity) {
+	r.identities[identityKey{identity.Provider, identity.Subject}] = identity
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The repository of the failed login attempts of one server, the counts are lost on restart
+type MemoryLoginAttemptRepository struct {
+	attempts map[string]*models.LoginAttempts
+	mu       sync.Mutex
+}
+
+// Login attempt repository constructor
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{attempts: make(map[string]*models.LoginAttempts)}
+}
+
+// The method of reserving an attempt under the key: if the delay of the failures counted so far has not passed since the last
+// of them, returns how long is left and counts nothing, otherwise counts the attempt as a failure and returns 0.
+// The count starts over if the previous failure is older than resetAfter
+func (r *MemoryLoginAttemptRepository) Reserve(key string, now time.Time, resetAfter time.Duration, delay func(failures int) time.Duration) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempts, exists := r.attempts[key]
+	if !exists || now.Sub(attempts.LastFailure) > resetAfter {
+		attempts = &models.LoginAttempts{Key: key}
+		r.attempts[key] = attempts
+	}
+	if wait := attempts.LastFailure.Add(delay(attempts.Failures)).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	return 0, nil
+}
+
+// The method of taking back an attempt reserved under the key that turned out to be successful, the time of the last failure is kept
+func (r *MemoryLoginAttemptRepository) Release(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempts, exists := r.attempts[key]
+	if !exists {
+		return nil
+	}
+	attempts.Failures--
+	if attempts.Failures <= 0 {
+		delete(r.attempts, key)
+	}
+	return nil
+}
+
+// The method of forgetting the failed attempts under the key
+func (r *MemoryLoginAttemptRepository) Reset(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
+
+// The method of forgetting the attempts whose last failure happened before the time, returns how many keys were forgotten
+func (r *MemoryLoginAttemptRepository) DeleteExpired(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deleted := 0
+	for key, attempts := range r.attempts {
+		if attempts.LastFailure.Before(before) {
+			delete(r.attempts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
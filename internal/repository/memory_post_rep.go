@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"encoding/json"
 	"errors"
 	"sync"
 
@@ -16,27 +17,96 @@ var (
 )
 
 // A structure that stores posts and implements the PostRepository interface
+// The repository keeps copies of the posts, so the callers can't change a stored post without the lock
 type MemoryPostRepository struct {
-	posts map[string]*models.Post
-	mu    sync.RWMutex
+	posts   map[string]*models.Post
+	votes   *MemoryVoteRepository
+	mu      sync.RWMutex
+	journal *Journal
 }
 
-// The constructor of the MemoryPostRepository structure, which returns a reference to the created instance
-func NewMemoryPostRepository() *MemoryPostRepository {
-	return &MemoryPostRepository{posts: make(map[string]*models.Post)}
+// The constructor of the MemoryPostRepository structure, which returns a reference to the created instance.
+// votes is the repository in which ApplyVote changes the votes of the posts
+func NewMemoryPostRepository(votes *MemoryVoteRepository) *MemoryPostRepository {
+	return &MemoryPostRepository{posts: make(map[string]*models.Post), votes: votes}
+}
+
+// The constructor of the MemoryPostRepository that restores posts from the journal and writes every change to it
+func NewDurableMemoryPostRepository(journal *Journal, votes *MemoryVoteRepository) (*MemoryPostRepository, error) {
+	r := NewMemoryPostRepository(votes)
+	restore := func(snapshot json.RawMessage) error {
+		return json.Unmarshal(snapshot, &r.posts)
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all posts and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryPostRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Compact(r.posts)
+}
+
+// The method of applying a journal record to the posts during the restore
+func (r *MemoryPostRepository) apply(op string, data json.RawMessage) error {
+	switch op {
+	case opCreate, opUpdate:
+		var post models.Post
+		if err := json.Unmarshal(data, &post); err != nil {
+			return err
+		}
+		r.posts[post.ID] = &post
+	case opDelete:
+		var postID string
+		if err := json.Unmarshal(data, &postID); err != nil {
+			return err
+		}
+		delete(r.posts, postID)
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemoryPostRepository) writeJournal(op string, value any) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, value)
 }
 
 // The method of getting all the storing posts
 func (r *MemoryPostRepository) GetAll() ([]models.Post, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	allPosts := make([]models.Post, 0, 100)
+	allPosts := make([]models.Post, 0, len(r.posts))
 	for _, post := range r.posts {
 		allPosts = append(allPosts, *post)
 	}
 	return allPosts, nil
 }
 
+// The method of getting a page of the posts selected by the query, ordered from newer to older
+func (r *MemoryPostRepository) GetPage(query PostQuery) (*PostPage, error) {
+	r.mu.RLock()
+	matching := make([]models.Post, 0)
+	for _, post := range r.posts {
+		if query.matches(post) {
+			matching = append(matching, *post)
+		}
+	}
+	r.mu.RUnlock()
+
+	sortNewestFirst(matching)
+	return pagePosts(matching, query), nil
+}
+
 // The method of getting a post by its ID, return ErrPostNotFound if post with id equals postID not exists
 func (r *MemoryPostRepository) GetByID(postID string) (*models.Post, error) {
 	r.mu.RLock()
@@ -45,7 +115,8 @@ func (r *MemoryPostRepository) GetByID(postID string) (*models.Post, error) {
 	if !exists {
 		return nil, ErrPostNotFound
 	}
-	return post, nil
+	postCopy := *post
+	return &postCopy, nil
 }
 
 // The method of obtaining all stored posts corresponding to the category, return ErrNoPostsInCategory  if posts in this category not found
@@ -84,7 +155,11 @@ func (r *MemoryPostRepository) Create(post *models.Post) error {
 	if _, exists := r.posts[post.ID]; exists {
 		return ErrPostAlreadyExists
 	}
-	r.posts[post.ID] = post
+	if err := r.writeJournal(opCreate, post); err != nil {
+		return err
+	}
+	postCopy := *post
+	r.posts[post.ID] = &postCopy
 	return nil
 }
 
@@ -95,17 +170,87 @@ func (r *MemoryPostRepository) Delete(postID string) error {
 	if _, exists := r.posts[postID]; !exists {
 		return ErrPostNotFound
 	}
+	if err := r.writeJournal(opDelete, postID); err != nil {
+		return err
+	}
 	delete(r.posts, postID)
 	return nil
 }
 
-// The update method of the modified post, which accepts a pointer to the post, returns ErrPostNotFound if there is no such post in the database at the time of the update
+// The update method of the modified post, which accepts a pointer to the post, returns ErrPostNotFound if there is no such post in the database at the time of the update.
+// The lock of the post is only changed by SetLocked, so that an update of the views does not unlock it
 func (r *MemoryPostRepository) Update(post *models.Post) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, exists := r.posts[post.ID]; !exists {
+	stored, exists := r.posts[post.ID]
+	if !exists {
 		return ErrPostNotFound
 	}
-	r.posts[post.ID] = post
+	postCopy := *post
+	postCopy.Locked = stored.Locked
+	postCopy.Views = stored.Views
+	if err := r.writeJournal(opUpdate, &postCopy); err != nil {
+		return err
+	}
+	r.posts[post.ID] = &postCopy
 	return nil
 }
+
+// The method of locking or unlocking the post, returns a copy of the changed post or ErrPostNotFound if there is no such post
+func (r *MemoryPostRepository) SetLocked(postID string, locked bool) (*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.posts[postID]
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+	postCopy := *stored
+	postCopy.Locked = locked
+	if err := r.writeJournal(opUpdate, &postCopy); err != nil {
+		return nil, err
+	}
+	r.posts[postID] = &postCopy
+	result := postCopy
+	return &result, nil
+}
+
+// The method of counting one more view of the post, returns ErrPostNotFound if there is no such post
+func (r *MemoryPostRepository) IncrementViews(postID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.posts[postID]
+	if !exists {
+		return ErrPostNotFound
+	}
+	postCopy := *stored
+	postCopy.Views++
+	if err := r.writeJournal(opUpdate, &postCopy); err != nil {
+		return err
+	}
+	r.posts[postID] = &postCopy
+	return nil
+}
+
+// The method of casting (value 1 or -1) or removing (value 0) the vote of the user for the post under the lock of the repository,
+// returns a copy of the post with its votes and rating right after the change, or ErrPostNotFound if there is no such post
+func (r *MemoryPostRepository) ApplyVote(postID, userID string, value int) (*models.Post, error) {
+	if value != 1 && value != -1 && value != 0 {
+		return nil, ErrInvalidVote
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	post, exists := r.posts[postID]
+	if !exists {
+		return nil, ErrPostNotFound
+	}
+
+	votes, rating, err := r.votes.change(postID, userID, value)
+	if err != nil {
+		return nil, err
+	}
+	postCopy := *post
+	postCopy.Votes = votes
+	postCopy.Score = rating.Score
+	postCopy.UpvotePercentage = rating.UpvotePercentage
+	return &postCopy, nil
+}
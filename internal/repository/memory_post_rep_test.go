@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The function of summing the values of the votes
+func sumVotes(votes []models.Vote) int {
+	sum := 0
+	for _, vote := range votes {
+		sum += vote.Vote
+	}
+	return sum
+}
+
+func TestMemoryPostApplyVoteConcurrent(t *testing.T) {
+	const voters = 300
+	votes := NewMemoryVoteRepository()
+	posts := NewMemoryPostRepository(votes)
+	post := &models.Post{ID: "post", Author: models.User{ID: "author"}, Category: "music", Created: time.Now()}
+	if err := posts.Create(post); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every voter upvotes, then the voters with an even number change their vote to a downvote
+	// and every third voter cancels it, all of them at once
+	want := make(map[string]int, voters)
+	var wg sync.WaitGroup
+	for i := 0; i < voters; i++ {
+		userID := fmt.Sprintf("user%d", i)
+		final := 1
+		if i%2 == 0 {
+			final = -1
+		}
+		if i%3 == 0 {
+			final = 0
+		}
+		if final != 0 {
+			want[userID] = final
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sequence := []int{1}
+			if i%2 == 0 {
+				sequence = append(sequence, -1)
+			}
+			if i%3 == 0 {
+				sequence = append(sequence, 0)
+			}
+			for _, value := range sequence {
+				voted, err := posts.ApplyVote("post", userID, value)
+				if err != nil {
+					t.Errorf("ApplyVote %s %d: %s", userID, value, err)
+					return
+				}
+				// Every returned post is consistent on its own
+				if voted.Score != sumVotes(voted.Votes) {
+					t.Errorf("returned score %d, sum of the returned votes %d", voted.Score, sumVotes(voted.Votes))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stored, err := votes.GetByPostID("post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(want) {
+		t.Fatalf("%d votes stored, want %d", len(stored), len(want))
+	}
+	for _, vote := range stored {
+		if want[vote.UserID] != vote.Vote {
+			t.Fatalf("vote of %s is %d, want %d", vote.UserID, vote.Vote, want[vote.UserID])
+		}
+	}
+	rating, err := votes.GetRating("post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rating.Score != sumVotes(stored) {
+		t.Fatalf("score %d, sum of the votes %d", rating.Score, sumVotes(stored))
+	}
+
+	// The last vote sees the same state
+	voted, err := posts.ApplyVote("post", "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voted.Score != rating.Score || len(voted.Votes) != len(stored) {
+		t.Fatalf("after a repeated vote score %d with %d votes, want %d with %d", voted.Score, len(voted.Votes), rating.Score, len(stored))
+	}
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleAlreadyGranted = errors.New("role already granted")
+)
+
+type MemoryRoleRepository struct {
+	roles   map[roleKey]*models.RoleGrant
+	mu      sync.RWMutex
+	journal *Journal
+}
+
+// The key of a role of the user: the user, the role and the category, empty for the whole site
+type roleKey struct {
+	userID   string
+	role     string
+	category string
+}
+
+// A structure of the role in the journal
+type roleRecord struct {
+	UserID   string    `json:"userID"`
+	Role     string    `json:"role"`
+	Category string    `json:"category,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// Role repository constructor
+func NewMemoryRoleRepository() *MemoryRoleRepository {
+	return &MemoryRoleRepository{roles: make(map[roleKey]*models.RoleGrant)}
+}
+
+// Role repository constructor that restores roles from the journal and writes every change to it
+func NewDurableMemoryRoleRepository(journal *Journal) (*MemoryRoleRepository, error) {
+	r := NewMemoryRoleRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var records []roleRecord
+		if err := json.Unmarshal(snapshot, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			r.roles[record.key()] = record.toRoleGrant()
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all roles and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryRoleRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	records := make([]roleRecord, 0, len(r.roles))
+	for _, grant := range r.roles {
+		records = append(records, newRoleRecord(grant))
+	}
+	return r.journal.Compact(records)
+}
+
+// The method of applying a journal record to the roles during the restore
+func (r *MemoryRoleRepository) apply(op string, data json.RawMessage) error {
+	var record roleRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	switch op {
+	case opCreate:
+		r.roles[record.key()] = record.toRoleGrant()
+	case opDelete:
+		delete(r.roles, record.key())
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemoryRoleRepository) writeJournal(op string, record roleRecord) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, record)
+}
+
+// The function of converting the role to its journal record
+func newRoleRecord(grant *models.RoleGrant) roleRecord {
+	return roleRecord{
+		UserID:   grant.UserID,
+		Role:     grant.Role,
+		Category: grant.Category,
+		Created:  grant.Created,
+	}
+}
+
+// The method of converting the journal record back to the role
+func (record roleRecord) toRoleGrant() *models.RoleGrant {
+	return &models.RoleGrant{
+		UserID:   record.UserID,
+		Role:     record.Role,
+		Category: record.Category,
+		Created:  record.Created,
+	}
+}
+
+// The method of getting the key of the role of the record
+func (record roleRecord) key() roleKey {
+	return roleKey{userID: record.UserID, role: record.Role, category: record.Category}
+}
+
+// The method of granting a role to the user; causes an error ErrRoleAlreadyGranted if the user already has the role in the category
+func (r *MemoryRoleRepository) Grant(grant *models.RoleGrant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := newRoleRecord(grant)
+	if _, exists := r.roles[record.key()]; exists {
+		return ErrRoleAlreadyGranted
+	}
+	if err := r.writeJournal(opCreate, record); err != nil {
+		return err
+	}
+	r.roles[record.key()] = record.toRoleGrant()
+	return nil
+}
+
+// The method of revoking the role of the user in the category, returns ErrRoleNotFound if the user has no such role
+func (r *MemoryRoleRepository) Revoke(userID, role, category string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := roleRecord{UserID: userID, Role: role, Category: category}
+	if _, exists := r.roles[record.key()]; !exists {
+		return ErrRoleNotFound
+	}
+	if err := r.writeJournal(opDelete, record); err != nil {
+		return err
+	}
+	delete(r.roles, record.key())
+	return nil
+}
+
+// The method of obtaining all roles of the user, a user without roles gets an empty slice
+func (r *MemoryRoleRepository) GetByUserID(userID string) ([]models.RoleGrant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	grants := make([]models.RoleGrant, 0)
+	for _, grant := range r.roles {
+		if grant.UserID == userID {
+			grants = append(grants, *grant)
+		}
+	}
+	return grants, nil
+}
+
+// The method of obtaining the roles of all users
+func (r *MemoryRoleRepository) GetAll() ([]models.RoleGrant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	grants := make([]models.RoleGrant, 0, len(r.roles))
+	for _, grant := range r.roles {
+		grants = append(grants, *grant)
+	}
+	return grants, nil
+}
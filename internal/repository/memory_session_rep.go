@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"encoding/json"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
 )
@@ -10,51 +12,342 @@ import (
 var (
 	ErrSessionNotFound      = errors.New("session not found")
 	ErrSessionAlreadyExists = errors.New("session already exists")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
 )
 
 type MemorySessionRepository struct {
-	sessions map[string]*models.Session
+	sessions map[string]*models.Session // sessions by ID
+	current  map[string]string          // hash of the current refresh token -> ID of its session
+	retired  map[string]string          // hash of a rotated refresh token -> ID of its session
+	rotated  map[string][]string        // ID of a session -> hashes of its rotated refresh tokens
 	mu       sync.RWMutex
+	journal  *Journal
+}
+
+// A structure of the session in the journal. Retired holds the hashes of the rotated refresh tokens in the snapshot
+// and the hash of the token replaced by a rotation in its record
+type sessionRecord struct {
+	ID               string    `json:"id"`
+	UserID           string    `json:"userID"`
+	RefreshTokenHash string    `json:"refreshTokenHash"`
+	UserAgent        string    `json:"userAgent,omitempty"`
+	IP               string    `json:"ip,omitempty"`
+	Created          time.Time `json:"created"`
+	LastSeen         time.Time `json:"lastSeen"`
+	Expires          time.Time `json:"expires"`
+	Retired          []string  `json:"retired,omitempty"`
 }
 
 // Session repository constructor
 func NewMemorySessionRepository() *MemorySessionRepository {
-	return &MemorySessionRepository{sessions: make(map[string]*models.Session)}
+	return &MemorySessionRepository{
+		sessions: make(map[string]*models.Session),
+		current:  make(map[string]string),
+		retired:  make(map[string]string),
+		rotated:  make(map[string][]string),
+	}
 }
 
-// The method of obtaining a session by token; return ErrSessionNotFound if sessions with that token doesn't exist
-func (r *MemorySessionRepository) GetByToken(token string) (*models.Session, error) {
+// Session repository constructor that restores sessions from the journal and writes every change to it.
+// Records of the sessions stored before refresh tokens were introduced have no ID and are skipped
+func NewDurableMemorySessionRepository(journal *Journal) (*MemorySessionRepository, error) {
+	r := NewMemorySessionRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var records []sessionRecord
+		if err := json.Unmarshal(snapshot, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if record.ID == "" {
+				continue
+			}
+			r.add(record.toSession())
+			for _, hash := range record.Retired {
+				r.retired[hash] = record.ID
+			}
+			r.rotated[record.ID] = record.Retired
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all sessions and clearing the journal, does nothing for a repository without a journal
+func (r *MemorySessionRepository) Snapshot() error {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	session, exists := r.sessions[token]
+	if r.journal == nil {
+		return nil
+	}
+	records := make([]sessionRecord, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		record := newSessionRecord(session)
+		record.Retired = r.rotated[session.ID]
+		records = append(records, record)
+	}
+	return r.journal.Compact(records)
+}
+
+// The method of applying a journal record to the sessions during the restore
+func (r *MemorySessionRepository) apply(op string, data json.RawMessage) error {
+	var record sessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	switch op {
+	case opCreate:
+		if record.ID != "" {
+			r.add(record.toSession())
+		}
+	case opUpdate:
+		// A rotation retires one refresh token, a touch only moves the last-seen time
+		if len(record.Retired) == 1 {
+			r.rotate(record.ID, record.Retired[0], record.RefreshTokenHash)
+		}
+		r.touch(record.ID, record.LastSeen)
+	case opDelete:
+		r.delete(record.ID)
+	case opClear:
+		r.deleteByUserID(record.UserID)
+	case opExpire:
+		r.deleteExpired(record.Expires)
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemorySessionRepository) writeJournal(op string, record sessionRecord) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, record)
+}
+
+// The function of converting the session to its journal record
+func newSessionRecord(session *models.Session) sessionRecord {
+	return sessionRecord{
+		ID:               session.ID,
+		UserID:           session.UserID,
+		RefreshTokenHash: session.RefreshTokenHash,
+		UserAgent:        session.UserAgent,
+		IP:               session.IP,
+		Created:          session.Created,
+		LastSeen:         session.LastSeen,
+		Expires:          session.Expires,
+	}
+}
+
+// The method of converting the journal record back to the session
+func (record sessionRecord) toSession() *models.Session {
+	return &models.Session{
+		ID:               record.ID,
+		UserID:           record.UserID,
+		RefreshTokenHash: record.RefreshTokenHash,
+		UserAgent:        record.UserAgent,
+		IP:               record.IP,
+		Created:          record.Created,
+		LastSeen:         record.LastSeen,
+		Expires:          record.Expires,
+	}
+}
+
+// The method of obtaining a session by ID; return ErrSessionNotFound if sessions with that ID doesn't exist
+func (r *MemorySessionRepository) GetByID(sessionID string) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	session, exists := r.sessions[sessionID]
 	if !exists {
 		return nil, ErrSessionNotFound
 	}
-	return session, nil
+	sessionCopy := *session
+	return &sessionCopy, nil
 }
 
-// The method of supplementing the session is a lie, here is the session.Token is the key to the card; causes an error ErrSessionAlreadyExists if a session with such a token already exists
+// The method of supplementing the session, session.ID is the key to the map; causes an error ErrSessionAlreadyExists
+// if a session with such an ID or refresh token already exists
 func (r *MemorySessionRepository) Create(session *models.Session) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, exists := r.sessions[session.Token]; exists {
+	if _, exists := r.sessions[session.ID]; exists {
 		return ErrSessionAlreadyExists
 	}
-	r.sessions[session.Token] = session
-
+	if _, exists := r.current[session.RefreshTokenHash]; exists {
+		return ErrSessionAlreadyExists
+	}
+	if err := r.writeJournal(opCreate, newSessionRecord(session)); err != nil {
+		return err
+	}
+	sessionCopy := *session
+	r.add(&sessionCopy)
 	return nil
 }
 
-// The method of obtaining a session by userID; return ErrSessionNotFound if sessions with that userID doesn't exist
-func (r *MemorySessionRepository) GetByUserID(userID string) (*models.Session, error) {
+// The method of obtaining all sessions of the user, a user without sessions gets an empty slice
+func (r *MemorySessionRepository) GetByUserID(userID string) ([]models.Session, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	sessions := make([]models.Session, 0)
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+// The method of replacing the current refresh token of a session with a new one, returns a copy of the session after the rotation.
+// Returns ErrSessionNotFound if no live session has such a refresh token, and ErrRefreshTokenReused after deleting
+// the session if the refresh token was already rotated
+func (r *MemorySessionRepository) Rotate(refreshTokenHash, newRefreshTokenHash string, now time.Time) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sessionID, reused := r.retired[refreshTokenHash]; reused {
+		if err := r.writeJournal(opDelete, sessionRecord{ID: sessionID}); err != nil {
+			return nil, err
+		}
+		r.delete(sessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	sessionID, exists := r.current[refreshTokenHash]
+	if !exists || !now.Before(r.sessions[sessionID].Expires) {
+		return nil, ErrSessionNotFound
+	}
+	if _, exists := r.current[newRefreshTokenHash]; exists {
+		return nil, ErrSessionAlreadyExists
+	}
+	record := sessionRecord{ID: sessionID, RefreshTokenHash: newRefreshTokenHash, LastSeen: now, Retired: []string{refreshTokenHash}}
+	if err := r.writeJournal(opUpdate, record); err != nil {
+		return nil, err
+	}
+	r.rotate(sessionID, refreshTokenHash, newRefreshTokenHash)
+	r.touch(sessionID, now)
+	sessionCopy := *r.sessions[sessionID]
+	return &sessionCopy, nil
+}
+
+// The method of recording the time the session was last used, returns ErrSessionNotFound if there is no such session
+func (r *MemorySessionRepository) Touch(sessionID string, lastSeen time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.sessions[sessionID]; !exists {
+		return ErrSessionNotFound
+	}
+	if err := r.writeJournal(opUpdate, sessionRecord{ID: sessionID, LastSeen: lastSeen}); err != nil {
+		return err
+	}
+	r.touch(sessionID, lastSeen)
+	return nil
+}
+
+// The method of deleting the session with the ID, returns ErrSessionNotFound if there is no such session
+func (r *MemorySessionRepository) Delete(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.sessions[sessionID]; !exists {
+		return ErrSessionNotFound
+	}
+	if err := r.writeJournal(opDelete, sessionRecord{ID: sessionID}); err != nil {
+		return err
+	}
+	r.delete(sessionID)
+	return nil
+}
+
+// The method of deleting all sessions of the user
+func (r *MemorySessionRepository) DeleteByUserID(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writeJournal(opClear, sessionRecord{UserID: userID}); err != nil {
+		return err
+	}
+	r.deleteByUserID(userID)
+	return nil
+}
+
+// The method of deleting the sessions that expired before now, returns the number of deleted sessions
+func (r *MemorySessionRepository) DeleteExpired(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := false
 	for _, session := range r.sessions {
+		if session.Expires.Before(now) {
+			expired = true
+			break
+		}
+	}
+	// Sweeps that find nothing are not written to the journal
+	if !expired {
+		return 0, nil
+	}
+	if err := r.writeJournal(opExpire, sessionRecord{Expires: now}); err != nil {
+		return 0, err
+	}
+	return r.deleteExpired(now), nil
+}
+
+// The method of adding the session to the maps, must be called under the lock
+func (r *MemorySessionRepository) add(session *models.Session) {
+	r.sessions[session.ID] = session
+	r.current[session.RefreshTokenHash] = session.ID
+}
+
+// The method of replacing the refresh token of the session and retiring the old one, must be called under the lock
+func (r *MemorySessionRepository) rotate(sessionID, refreshTokenHash, newRefreshTokenHash string) {
+	session, exists := r.sessions[sessionID]
+	if !exists {
+		return
+	}
+	delete(r.current, refreshTokenHash)
+	r.retired[refreshTokenHash] = sessionID
+	r.rotated[sessionID] = append(r.rotated[sessionID], refreshTokenHash)
+	session.RefreshTokenHash = newRefreshTokenHash
+	r.current[newRefreshTokenHash] = sessionID
+}
+
+// The method of moving the last-seen time of the session forward, must be called under the lock
+func (r *MemorySessionRepository) touch(sessionID string, lastSeen time.Time) {
+	if session, exists := r.sessions[sessionID]; exists && lastSeen.After(session.LastSeen) {
+		session.LastSeen = lastSeen
+	}
+}
+
+// The method of deleting the session together with its current and retired refresh tokens, must be called under the lock
+func (r *MemorySessionRepository) delete(sessionID string) {
+	session, exists := r.sessions[sessionID]
+	if !exists {
+		return
+	}
+	delete(r.current, session.RefreshTokenHash)
+	for _, hash := range r.rotated[sessionID] {
+		delete(r.retired, hash)
+	}
+	delete(r.rotated, sessionID)
+	delete(r.sessions, sessionID)
+}
+
+// The method of deleting all sessions of the user, must be called under the lock
+func (r *MemorySessionRepository) deleteByUserID(userID string) {
+	for sessionID, session := range r.sessions {
 		if session.UserID == userID {
-			return session, nil
+			r.delete(sessionID)
 		}
 	}
+}
 
-	return nil, ErrSessionNotFound
+// The method of deleting the sessions that expired before now, must be called under the lock
+func (r *MemorySessionRepository) deleteExpired(now time.Time) int {
+	deleted := 0
+	for sessionID, session := range r.sessions {
+		if session.Expires.Before(now) {
+			r.delete(sessionID)
+			deleted++
+		}
+	}
+	return deleted
 }
@@ -1,20 +1,41 @@
 package repository
 
 import (
+	"encoding/json"
 	"errors"
+	"slices"
 	"sync"
 
 	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
 )
 
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserAlreadyExists    = errors.New("user already exists")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+	ErrTOTPStepUsed         = errors.New("totp code was already used")
+	ErrTOTPStateChanged     = errors.New("totp of the user was enabled or enrolled again")
+	ErrEmailTaken           = errors.New("email is verified by another user")
 )
 
 type MemoryUserRepository struct {
-	users map[string]*models.User
-	mu    sync.RWMutex
+	users   map[string]*models.User
+	mu      sync.RWMutex
+	journal *Journal
+}
+
+// A structure of the user in the journal, unlike models.User it keeps the password hash and the second factors
+type userRecord struct {
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	Password      string   `json:"password"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"emailVerified,omitempty"`
+	TOTPSecret    string   `json:"totpSecret,omitempty"`
+	TOTPEnabled   bool     `json:"totpEnabled,omitempty"`
+	TOTPLastStep  int64    `json:"totpLastStep,omitempty"`
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+	Banned        bool     `json:"banned,omitempty"`
 }
 
 // User repository constructor
@@ -22,13 +43,119 @@ func NewMemoryUserRepository() *MemoryUserRepository {
 	return &MemoryUserRepository{users: make(map[string]*models.User)}
 }
 
+// User repository constructor that restores users from the journal and writes every change to it
+func NewDurableMemoryUserRepository(journal *Journal) (*MemoryUserRepository, error) {
+	r := NewMemoryUserRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var records []userRecord
+		if err := json.Unmarshal(snapshot, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			r.users[record.ID] = record.toUser()
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all users and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryUserRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	records := make([]userRecord, 0, len(r.users))
+	for _, user := range r.users {
+		records = append(records, newUserRecord(user))
+	}
+	return r.journal.Compact(records)
+}
+
+// The method of applying a journal record to the users during the restore
+func (r *MemoryUserRepository) apply(op string, data json.RawMessage) error {
+	if op != opCreate && op != opUpdate {
+		return nil
+	}
+	var record userRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	r.users[record.ID] = record.toUser()
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemoryUserRepository) writeJournal(op string, user *models.User) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, newUserRecord(user))
+}
+
+// The function of converting the user to its journal record
+func newUserRecord(user *models.User) userRecord {
+	return userRecord{
+		ID:            user.ID,
+		Username:      user.Username,
+		Password:      user.Password,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		TOTPSecret:    user.TOTPSecret,
+		TOTPEnabled:   user.TOTPEnabled,
+		TOTPLastStep:  user.TOTPLastStep,
+		RecoveryCodes: user.RecoveryCodes,
+		Banned:        user.Banned,
+	}
+}
+
+// The method of converting the journal record back to the user
+func (record userRecord) toUser() *models.User {
+	return &models.User{
+		ID:            record.ID,
+		Username:      record.Username,
+		Password:      record.Password,
+		Email:         record.Email,
+		EmailVerified: record.EmailVerified,
+		TOTPSecret:    record.TOTPSecret,
+		TOTPEnabled:   record.TOTPEnabled,
+		TOTPLastStep:  record.TOTPLastStep,
+		RecoveryCodes: record.RecoveryCodes,
+		Banned:        record.Banned,
+	}
+}
+
+// The function of copying the user, the repository never hands out the users it stores, so that they are only changed under the lock
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	copied.RecoveryCodes = append([]string(nil), user.RecoveryCodes...)
+	return &copied
+}
+
 // The method of obtaining a user by username; return ErrUserNotFound if user with that username doesn't exist
 func (r *MemoryUserRepository) GetByUsername(username string) (*models.User, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	for _, user := range r.users {
 		if user.Username == username {
-			return user, nil
+			return copyUser(user), nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// The method of obtaining the user with the verified email; return ErrUserNotFound if no user has verified that email
+func (r *MemoryUserRepository) GetByEmail(email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if user.EmailVerified && user.Email == email {
+			return copyUser(user), nil
 		}
 	}
 	return nil, ErrUserNotFound
@@ -42,16 +169,190 @@ func (r *MemoryUserRepository) GetByID(userID string) (*models.User, error) {
 	if !exists {
 		return nil, ErrUserNotFound
 	}
-	return user, nil
+	return copyUser(user), nil
 }
 
-// The method of supplementing the user is a lie, here is the user.ID is the key to the card; causes an error ErrUserAlreadyExists if a user with such a ID already exists
+// The method of supplementing the user is a lie, here is the user.ID is the key to the card; causes an error ErrUserAlreadyExists if a user with such a ID or username already exists
+// and ErrEmailTaken if the email of the user is verified and another user has verified it
 func (r *MemoryUserRepository) Create(user *models.User) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, exists := r.users[user.ID]; exists {
 		return ErrUserAlreadyExists
 	}
-	r.users[user.ID] = user
+	// The usernames are unique like in the SQL storages
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return ErrUserAlreadyExists
+		}
+	}
+	if r.verifiedEmailTaken(user) {
+		return ErrEmailTaken
+	}
+	if err := r.writeJournal(opCreate, user); err != nil {
+		return err
+	}
+	r.users[user.ID] = copyUser(user)
 	return nil
 }
+
+// The method of saving the changed user; return ErrUserNotFound if user with that ID doesn't exist
+// and ErrEmailTaken if the email of the user is verified and another user has verified it
+func (r *MemoryUserRepository) Update(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[user.ID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if r.verifiedEmailTaken(user) {
+		return ErrEmailTaken
+	}
+	updated := copyUser(user)
+	updated.Banned = stored.Banned
+	updated.TOTPSecret = stored.TOTPSecret
+	updated.TOTPEnabled = stored.TOTPEnabled
+	updated.TOTPLastStep = stored.TOTPLastStep
+	updated.RecoveryCodes = slices.Clone(stored.RecoveryCodes)
+	if err := r.writeJournal(opUpdate, updated); err != nil {
+		return err
+	}
+	r.users[user.ID] = updated
+	return nil
+}
+
+// The method of banning or unbanning the user; return ErrUserNotFound if user with that ID doesn't exist
+func (r *MemoryUserRepository) SetBanned(userID string, banned bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	user := copyUser(stored)
+	user.Banned = banned
+	if err := r.writeJournal(opUpdate, user); err != nil {
+		return err
+	}
+	r.users[userID] = user
+	return nil
+}
+
+// The method of removing the recovery code with the hash from the user; return ErrRecoveryCodeNotFound if the user has no such code
+func (r *MemoryUserRepository) UseRecoveryCode(userID, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	index := slices.Index(stored.RecoveryCodes, codeHash)
+	if index < 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	user := copyUser(stored)
+	user.RecoveryCodes = slices.Delete(user.RecoveryCodes, index, index+1)
+	if err := r.writeJournal(opUpdate, user); err != nil {
+		return err
+	}
+	r.users[userID] = user
+	return nil
+}
+
+// The method of recording the time step of an accepted TOTP code; return ErrTOTPStepUsed if the step is not after the last accepted one
+func (r *MemoryUserRepository) AdvanceTOTPStep(userID string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if step <= stored.TOTPLastStep {
+		return ErrTOTPStepUsed
+	}
+	user := copyUser(stored)
+	user.TOTPLastStep = step
+	if err := r.writeJournal(opUpdate, user); err != nil {
+		return err
+	}
+	r.users[userID] = user
+	return nil
+}
+
+// The method of storing a new TOTP secret of the user that is not enabled yet; return ErrTOTPStateChanged if the TOTP is enabled
+func (r *MemoryUserRepository) EnrollTOTP(userID, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if stored.TOTPEnabled {
+		return ErrTOTPStateChanged
+	}
+	user := copyUser(stored)
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	if err := r.writeJournal(opUpdate, user); err != nil {
+		return err
+	}
+	r.users[userID] = user
+	return nil
+}
+
+// The method of enabling the enrolled TOTP secret with the recovery code hashes; return ErrTOTPStateChanged if the TOTP is
+// already enabled or the secret was replaced by another enrollment
+func (r *MemoryUserRepository) EnableTOTP(userID, secret string, recoveryCodes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	if stored.TOTPEnabled || stored.TOTPSecret != secret {
+		return ErrTOTPStateChanged
+	}
+	user := copyUser(stored)
+	user.TOTPEnabled = true
+	user.RecoveryCodes = slices.Clone(recoveryCodes)
+	if err := r.writeJournal(opUpdate, user); err != nil {
+		return err
+	}
+	r.users[userID] = user
+	return nil
+}
+
+// The method of turning off the TOTP of the user, removes the secret and the recovery codes; return ErrUserNotFound if user with that ID doesn't exist
+func (r *MemoryUserRepository) DisableTOTP(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	user := copyUser(stored)
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	if err := r.writeJournal(opUpdate, user); err != nil {
+		return err
+	}
+	r.users[userID] = user
+	return nil
+}
+
+// The method of checking that the email of the user is verified by another user, like the unique index of the SQL storages does.
+// The caller must hold the lock
+func (r *MemoryUserRepository) verifiedEmailTaken(user *models.User) bool {
+	if !user.EmailVerified {
+		return false
+	}
+	for _, other := range r.users {
+		if other.ID != user.ID && other.EmailVerified && other.Email == user.Email {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+var (
+	ErrUserTokenNotFound      = errors.New("token not found")
+	ErrUserTokenAlreadyExists = errors.New("token already exists")
+)
+
+type MemoryUserTokenRepository struct {
+	tokens  map[string]*models.UserToken // tokens by hash
+	mu      sync.Mutex
+	journal *Journal
+}
+
+// A structure of the token in the journal
+type userTokenRecord struct {
+	Hash    string    `json:"hash"`
+	UserID  string    `json:"userID"`
+	Purpose string    `json:"purpose"`
+	Email   string    `json:"email,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// User token repository constructor
+func NewMemoryUserTokenRepository() *MemoryUserTokenRepository {
+	return &MemoryUserTokenRepository{tokens: make(map[string]*models.UserToken)}
+}
+
+// User token repository constructor that restores tokens from the journal and writes every change to it
+func NewDurableMemoryUserTokenRepository(journal *Journal) (*MemoryUserTokenRepository, error) {
+	r := NewMemoryUserTokenRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var records []userTokenRecord
+		if err := json.Unmarshal(snapshot, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			r.tokens[record.Hash] = record.toUserToken()
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all tokens and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryUserTokenRepository) Snapshot() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.journal == nil {
+		return nil
+	}
+	records := make([]userTokenRecord, 0, len(r.tokens))
+	for _, token := range r.tokens {
+		records = append(records, newUserTokenRecord(token))
+	}
+	return r.journal.Compact(records)
+}
+
+// The method of applying a journal record to the tokens during the restore
+func (r *MemoryUserTokenRepository) apply(op string, data json.RawMessage) error {
+	var record userTokenRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	switch op {
+	case opCreate:
+		r.tokens[record.Hash] = record.toUserToken()
+	case opDelete:
+		delete(r.tokens, record.Hash)
+	case opClear:
+		r.deleteByUserID(record.UserID, record.Purpose)
+	case opExpire:
+		r.deleteExpired(record.Expires)
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemoryUserTokenRepository) writeJournal(op string, record userTokenRecord) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, record)
+}
+
+// The function of converting the token to its journal record
+func newUserTokenRecord(token *models.UserToken) userTokenRecord {
+	return userTokenRecord{
+		Hash:    token.Hash,
+		UserID:  token.UserID,
+		Purpose: token.Purpose,
+		Email:   token.Email,
+		Expires: token.Expires,
+	}
+}
+
+// The method of converting the journal record back to the token
+func (record userTokenRecord) toUserToken() *models.UserToken {
+	return &models.UserToken{
+		Hash:    record.Hash,
+		UserID:  record.UserID,
+		Purpose: record.Purpose,
+		Email:   record.Email,
+		Expires: record.Expires,
+	}
+}
+
+// The method of saving a new token; causes an error ErrUserTokenAlreadyExists if a token with such a hash already exists
+func (r *MemoryUserTokenRepository) Create(token *models.UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tokens[token.Hash]; exists {
+		return ErrUserTokenAlreadyExists
+	}
+	if err := r.writeJournal(opCreate, newUserTokenRecord(token)); err != nil {
+		return err
+	}
+	copied := *token
+	r.tokens[token.Hash] = &copied
+	return nil
+}
+
+// The method of using up the token with the hash; returns ErrUserTokenNotFound if there is no such token with the purpose
+// or it has expired
+func (r *MemoryUserTokenRepository) Consume(hash, purpose string, now time.Time) (*models.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, exists := r.tokens[hash]
+	if !exists || token.Purpose != purpose || !now.Before(token.Expires) {
+		return nil, ErrUserTokenNotFound
+	}
+	if err := r.writeJournal(opDelete, userTokenRecord{Hash: hash}); err != nil {
+		return nil, err
+	}
+	delete(r.tokens, hash)
+	return token, nil
+}
+
+// The method of deleting all tokens of the user with the purpose
+func (r *MemoryUserTokenRepository) DeleteByUserID(userID, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writeJournal(opClear, userTokenRecord{UserID: userID, Purpose: purpose}); err != nil {
+		return err
+	}
+	r.deleteByUserID(userID, purpose)
+	return nil
+}
+
+// The method of deleting the tokens of the user with the purpose, must be called under the lock
+func (r *MemoryUserTokenRepository) deleteByUserID(userID, purpose string) {
+	for hash, token := range r.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(r.tokens, hash)
+		}
+	}
+}
+
+// The method of deleting the tokens that have expired by now, returns the number of deleted tokens
+func (r *MemoryUserTokenRepository) DeleteExpired(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := false
+	for _, token := range r.tokens {
+		if !now.Before(token.Expires) {
+			expired = true
+			break
+		}
+	}
+	// Sweeps that find nothing are not written to the journal
+	if !expired {
+		return 0, nil
+	}
+	if err := r.writeJournal(opExpire, userTokenRecord{Expires: now}); err != nil {
+		return 0, err
+	}
+	return r.deleteExpired(now), nil
+}
+
+// The method of deleting the tokens that have expired by now, must be called under the lock
+func (r *MemoryUserTokenRepository) deleteExpired(now time.Time) int {
+	deleted := 0
+	for hash, token := range r.tokens {
+		if !now.Before(token.Expires) {
+			delete(r.tokens, hash)
+			deleted++
+		}
+	}
+	return deleted
+}
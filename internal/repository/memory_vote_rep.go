@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/scoring"
+)
+
+// Errors related to processing votes
+var (
+	ErrInvalidVote = errors.New("vote must be 1 or -1")
+)
+
+// The votes of one post together with the counters from which its rating is derived
+type postVotes struct {
+	votes     []models.Vote
+	upvotes   int
+	downvotes int
+}
+
+// A structure that stores the votes of posts and implements the VoteRepository interface
+type MemoryVoteRepository struct {
+	votes   map[string]*postVotes
+	mu      sync.RWMutex
+	journal *Journal
+}
+
+// A structure of the vote in the journal
+type voteRecord struct {
+	PostID string `json:"postID"`
+	UserID string `json:"userID"`
+	Vote   int    `json:"vote"`
+}
+
+// Vote repository constructor
+func NewMemoryVoteRepository() *MemoryVoteRepository {
+	return &MemoryVoteRepository{votes: make(map[string]*postVotes)}
+}
+
+// Vote repository constructor that restores votes from the journal and writes every change to it
+func NewDurableMemoryVoteRepository(journal *Journal) (*MemoryVoteRepository, error) {
+	r := NewMemoryVoteRepository()
+	restore := func(snapshot json.RawMessage) error {
+		var votesByPost map[string][]models.Vote
+		if err := json.Unmarshal(snapshot, &votesByPost); err != nil {
+			return err
+		}
+		for postID, votes := range votesByPost {
+			for _, vote := range votes {
+				r.cast(postID, vote.UserID, vote.Vote)
+			}
+		}
+		return nil
+	}
+	if err := journal.Load(restore, r.apply); err != nil {
+		return nil, err
+	}
+	r.journal = journal
+	return r, nil
+}
+
+// The method of taking a snapshot of all votes and clearing the journal, does nothing for a repository without a journal
+func (r *MemoryVoteRepository) Snapshot() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.journal == nil {
+		return nil
+	}
+	votesByPost := make(map[string][]models.Vote, len(r.votes))
+	for postID, pv := range r.votes {
+		votesByPost[postID] = pv.votes
+	}
+	return r.journal.Compact(votesByPost)
+}
+
+// The method of getting the votes of the post in the order in which they were cast
+func (r *MemoryVoteRepository) GetByPostID(postID string) ([]models.Vote, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.copyVotes(postID), nil
+}
+
+// The method of getting the current rating of the post, a post without votes has a zero rating
+func (r *MemoryVoteRepository) GetRating(postID string) (models.Rating, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rating(postID), nil
+}
+
+// The method of casting the vote of the user or changing it, returns ErrInvalidVote if the value is not 1 or -1
+func (r *MemoryVoteRepository) Cast(postID, userID string, value int) (models.Rating, error) {
+	if value != 1 && value != -1 {
+		return models.Rating{}, ErrInvalidVote
+	}
+	_, rating, err := r.change(postID, userID, value)
+	return rating, err
+}
+
+// The method of removing the vote of the user, removing a vote that does not exist changes nothing
+func (r *MemoryVoteRepository) Remove(postID, userID string) (models.Rating, error) {
+	_, rating, err := r.change(postID, userID, 0)
+	return rating, err
+}
+
+// The method of deleting all votes of the post
+func (r *MemoryVoteRepository) DeleteByPostID(postID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writeJournal(opClear, voteRecord{PostID: postID}); err != nil {
+		return err
+	}
+	delete(r.votes, postID)
+	return nil
+}
+
+// The method of casting (value 1 or -1) or removing (value 0) the vote of the user in one critical section,
+// returns a copy of the votes of the post and its rating right after the change
+func (r *MemoryVoteRepository) change(postID, userID string, value int) ([]models.Vote, models.Rating, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if value == 0 {
+		if err := r.writeJournal(opDelete, voteRecord{PostID: postID, UserID: userID}); err != nil {
+			return nil, models.Rating{}, err
+		}
+		r.remove(postID, userID)
+	} else {
+		if err := r.writeJournal(opCreate, voteRecord{PostID: postID, UserID: userID, Vote: value}); err != nil {
+			return nil, models.Rating{}, err
+		}
+		r.cast(postID, userID, value)
+	}
+	return r.copyVotes(postID), r.rating(postID), nil
+}
+
+// The method of copying the votes of the post, must be called under the lock
+func (r *MemoryVoteRepository) copyVotes(postID string) []models.Vote {
+	pv, exists := r.votes[postID]
+	if !exists {
+		return make([]models.Vote, 0)
+	}
+	votes := make([]models.Vote, len(pv.votes))
+	copy(votes, pv.votes)
+	return votes
+}
+
+// The method of casting or changing a vote and updating the counters, must be called under the lock
+func (r *MemoryVoteRepository) cast(postID, userID string, value int) {
+	pv, exists := r.votes[postID]
+	if !exists {
+		pv = &postVotes{}
+		r.votes[postID] = pv
+	}
+	for index, vote := range pv.votes {
+		if vote.UserID == userID {
+			pv.uncount(vote.Vote)
+			pv.votes[index].Vote = value
+			pv.count(value)
+			return
+		}
+	}
+	pv.votes = append(pv.votes, models.Vote{UserID: userID, Vote: value})
+	pv.count(value)
+}
+
+// The method of removing a vote and updating the counters, must be called under the lock
+func (r *MemoryVoteRepository) remove(postID, userID string) {
+	pv, exists := r.votes[postID]
+	if !exists {
+		return
+	}
+	for index, vote := range pv.votes {
+		if vote.UserID == userID {
+			pv.uncount(vote.Vote)
+			pv.votes = append(pv.votes[:index], pv.votes[index+1:]...)
+			return
+		}
+	}
+}
+
+// The method of deriving the rating of the post from its counters, must be called under the lock
+func (r *MemoryVoteRepository) rating(postID string) models.Rating {
+	pv, exists := r.votes[postID]
+	if !exists {
+		return scoring.FromCounts(0, 0).Rating()
+	}
+	return scoring.FromCounts(pv.upvotes, pv.downvotes).Rating()
+}
+
+// The method of applying a journal record to the votes during the restore
+func (r *MemoryVoteRepository) apply(op string, data json.RawMessage) error {
+	var record voteRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	switch op {
+	case opCreate:
+		r.cast(record.PostID, record.UserID, record.Vote)
+	case opDelete:
+		r.remove(record.PostID, record.UserID)
+	case opClear:
+		delete(r.votes, record.PostID)
+	}
+	return nil
+}
+
+// The method of writing a change to the journal if the repository has one, must be called under the lock before changing the map
+func (r *MemoryVoteRepository) writeJournal(op string, record voteRecord) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.Append(op, record)
+}
+
+// The method of adding a vote to the counters
+func (pv *postVotes) count(value int) {
+	if value > 0 {
+		pv.upvotes++
+	} else {
+		pv.downvotes++
+	}
+}
+
+// The method of subtracting a vote from the counters
+func (pv *postVotes) uncount(value int) {
+	if value > 0 {
+		pv.upvotes--
+	} else {
+		pv.downvotes--
+	}
+}
@@ -0,0 +1,4 @@
+-- Sessions created before this migration have no expiration time and are treated as expired
+ALTER TABLE sessions ADD COLUMN expires TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+
+CREATE INDEX sessions_expires_idx ON sessions (expires);
@@ -0,0 +1,4 @@
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN created TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE sessions ADD COLUMN last_seen TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
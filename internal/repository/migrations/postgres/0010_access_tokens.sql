@@ -0,0 +1,12 @@
+CREATE TABLE access_tokens (
+    id        TEXT PRIMARY KEY,
+    user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name      TEXT NOT NULL,
+    hash      TEXT NOT NULL UNIQUE,
+    scopes    TEXT NOT NULL,
+    created   TIMESTAMPTZ NOT NULL,
+    expires   TIMESTAMPTZ NOT NULL,
+    last_used TIMESTAMPTZ
+);
+
+CREATE INDEX access_tokens_user_id_idx ON access_tokens (user_id);
@@ -0,0 +1,5 @@
+-- Only one account may have verified an email, the accounts that verified it later lose the verification
+UPDATE users SET email_verified = FALSE
+WHERE email_verified AND id NOT IN (SELECT MIN(id) FROM users WHERE email_verified GROUP BY email);
+
+CREATE UNIQUE INDEX users_verified_email_idx ON users (email) WHERE email_verified;
@@ -0,0 +1,48 @@
+CREATE TABLE users (
+    id       TEXT PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL
+);
+
+CREATE TABLE sessions (
+    token   TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE posts (
+    id                TEXT PRIMARY KEY,
+    author_id         TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    category          TEXT NOT NULL,
+    type              TEXT NOT NULL,
+    title             TEXT NOT NULL,
+    text              TEXT NOT NULL DEFAULT '',
+    url               TEXT NOT NULL DEFAULT '',
+    score             INTEGER NOT NULL DEFAULT 0,
+    views             INTEGER NOT NULL DEFAULT 0,
+    upvote_percentage INTEGER NOT NULL DEFAULT 0,
+    created           TIMESTAMP NOT NULL
+);
+
+CREATE INDEX posts_category_idx ON posts (category);
+CREATE INDEX posts_author_id_idx ON posts (author_id);
+
+CREATE TABLE votes (
+    post_id  TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id  TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    vote     INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE comments (
+    id        TEXT PRIMARY KEY,
+    post_id   TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    author_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    body      TEXT NOT NULL,
+    position  INTEGER NOT NULL,
+    created   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX comments_post_id_idx ON comments (post_id);
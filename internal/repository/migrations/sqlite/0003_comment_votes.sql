@@ -0,0 +1,10 @@
+ALTER TABLE comments ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN upvote_percentage INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE comment_votes (
+    comment_id TEXT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    vote       INTEGER NOT NULL,
+    position   INTEGER NOT NULL,
+    PRIMARY KEY (comment_id, user_id)
+);
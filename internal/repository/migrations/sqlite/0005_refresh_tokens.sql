@@ -0,0 +1,20 @@
+-- Sessions are now started by a login and identified by their ID, the sessions keyed by the old tokens can not be used any more
+DROP TABLE sessions;
+
+CREATE TABLE sessions (
+    id                 TEXT PRIMARY KEY,
+    user_id            TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    expires            TIMESTAMP NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX sessions_expires_idx ON sessions (expires);
+
+-- Hashes of the rotated refresh tokens, presenting one of them again revokes its session
+CREATE TABLE retired_refresh_tokens (
+    hash       TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX retired_refresh_tokens_session_id_idx ON retired_refresh_tokens (session_id);
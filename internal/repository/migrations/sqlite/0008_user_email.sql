@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX users_email_idx ON users (email);
+
+CREATE TABLE user_tokens (
+    hash    TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    email   TEXT NOT NULL DEFAULT '',
+    expires TIMESTAMP NOT NULL
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id);
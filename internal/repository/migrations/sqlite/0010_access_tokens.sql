@@ -0,0 +1,12 @@
+CREATE TABLE access_tokens (
+    id        TEXT PRIMARY KEY,
+    user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name      TEXT NOT NULL,
+    hash      TEXT NOT NULL UNIQUE,
+    scopes    TEXT NOT NULL,
+    created   TIMESTAMP NOT NULL,
+    expires   TIMESTAMP NOT NULL,
+    last_used TIMESTAMP
+);
+
+CREATE INDEX access_tokens_user_id_idx ON access_tokens (user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE user_roles (
+    user_id  TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role     TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT '',
+    created  TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, role, category)
+);
+
+ALTER TABLE users ADD COLUMN banned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE posts ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE;
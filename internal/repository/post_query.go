@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// PostCursor - the position of a post in a listing ordered from newer to older posts
+type PostCursor struct {
+	Created time.Time
+	ID      string
+}
+
+// PostQuery - the filter and the page of a post listing ordered from newer to older posts.
+// After selects the posts older than the cursor, Before selects the posts newer than the cursor, only one of them may be set
+type PostQuery struct {
+	Category string
+	AuthorID string
+	Limit    int
+	After    *PostCursor
+	Before   *PostCursor
+}
+
+// PostPage - a page of a post listing ordered from newer to older posts,
+// HasMore reports that there are more posts past the page in the direction of the query
+type PostPage struct {
+	Posts   []models.Post
+	HasMore bool
+}
+
+// The function of making the cursor that points to the post
+func CursorOf(post models.Post) PostCursor {
+	return PostCursor{Created: post.Created, ID: post.ID}
+}
+
+// The method of checking that the post is selected by the filter of the query
+func (q PostQuery) matches(post *models.Post) bool {
+	if q.Category != "" && post.Category != q.Category {
+		return false
+	}
+	if q.AuthorID != "" && post.Author.ID != q.AuthorID {
+		return false
+	}
+	return true
+}
+
+// The function of comparing two positions in the listing, returns true if a is newer than b and goes first.
+// Posts created at the same moment are ordered by ID
+func newer(a, b PostCursor) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	return a.ID > b.ID
+}
+
+// The function of cutting a page of the query out of the posts that are already filtered and ordered from newer to older
+func pagePosts(posts []models.Post, query PostQuery) *PostPage {
+	if query.Before != nil {
+		// The posts newer than the cursor, the page is made of those closest to it
+		end := sort.Search(len(posts), func(i int) bool {
+			return !newer(CursorOf(posts[i]), *query.Before)
+		})
+		start := end - query.Limit
+		page := &PostPage{HasMore: start > 0}
+		if start < 0 {
+			start = 0
+		}
+		page.Posts = posts[start:end]
+		return page
+	}
+
+	start := 0
+	if query.After != nil {
+		start = sort.Search(len(posts), func(i int) bool {
+			return newer(*query.After, CursorOf(posts[i]))
+		})
+	}
+	end := start + query.Limit
+	page := &PostPage{HasMore: end < len(posts)}
+	if end > len(posts) {
+		end = len(posts)
+	}
+	page.Posts = posts[start:end]
+	return page
+}
+
+// The function of ordering the posts from newer to older, posts created at the same moment are ordered by ID
+func sortNewestFirst(posts []models.Post) {
+	sort.Slice(posts, func(i, j int) bool {
+		return newer(CursorOf(posts[i]), CursorOf(posts[j]))
+	})
+}
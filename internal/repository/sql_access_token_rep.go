@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A structure that stores the personal access tokens of the users in an SQL database and implements the AccessTokenRepository interface.
+// The scopes of a token are kept in one column separated by commas
+type SQLAccessTokenRepository struct {
+	db *sql.DB
+}
+
+// Access token repository constructor over an already opened and migrated database
+func NewSQLAccessTokenRepository(db *sql.DB) *SQLAccessTokenRepository {
+	return &SQLAccessTokenRepository{db: db}
+}
+
+// A common part of the queries that read access tokens
+const selectAccessTokens = `SELECT id, user_id, name, hash, scopes, created, expires, last_used FROM access_tokens`
+
+// The method of saving a new token; causes an error ErrAccessTokenAlreadyExists if a token with such an ID or hash already exists
+func (r *SQLAccessTokenRepository) Create(token *models.AccessToken) error {
+	var lastUsed sql.NullTime
+	if token.LastUsed != nil {
+		lastUsed = sql.NullTime{Time: token.LastUsed.UTC(), Valid: true}
+	}
+	result, err := r.db.Exec(
+		`INSERT INTO access_tokens (id, user_id, name, hash, scopes, created, expires, last_used)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`,
+		token.ID, token.UserID, token.Name, token.Hash, strings.Join(token.Scopes, ","),
+		token.Created.UTC(), token.Expires.UTC(), lastUsed,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAccessTokenAlreadyExists
+	}
+	return nil
+}
+
+// The method of obtaining a token by ID; returns ErrAccessTokenNotFound if there is no such token
+func (r *SQLAccessTokenRepository) GetByID(tokenID string) (*models.AccessToken, error) {
+	return r.getOne(selectAccessTokens+` WHERE id = $1`, tokenID)
+}
+
+// The method of obtaining a token by the hash of its value; returns ErrAccessTokenNotFound if there is no such token
+func (r *SQLAccessTokenRepository) GetByHash(hash string) (*models.AccessToken, error) {
+	return r.getOne(selectAccessTokens+` WHERE hash = $1`, hash)
+}
+
+// The method of obtaining the token selected by the query, returns ErrAccessTokenNotFound if there is no such token
+func (r *SQLAccessTokenRepository) getOne(query string, arg string) (*models.AccessToken, error) {
+	token, err := scanAccessToken(r.db.QueryRow(query, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccessTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// The method of obtaining all tokens of the user, a user without tokens gets an empty slice
+func (r *SQLAccessTokenRepository) GetByUserID(userID string) ([]models.AccessToken, error) {
+	rows, err := r.db.Query(selectAccessTokens+` WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]models.AccessToken, 0)
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// The method of recording the time the token was last used, returns ErrAccessTokenNotFound if there is no such token
+func (r *SQLAccessTokenRepository) Touch(tokenID string, lastUsed time.Time) error {
+	result, err := r.db.Exec(`UPDATE access_tokens SET last_used = $2 WHERE id = $1`, tokenID, lastUsed.UTC())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// The method of deleting the token with the ID, returns ErrAccessTokenNotFound if there is no such token
+func (r *SQLAccessTokenRepository) Delete(tokenID string) error {
+	result, err := r.db.Exec(`DELETE FROM access_tokens WHERE id = $1`, tokenID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// The method of deleting all tokens of the user
+func (r *SQLAccessTokenRepository) DeleteByUserID(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM access_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+// The method of deleting the tokens that have expired by now, returns the number of deleted tokens
+func (r *SQLAccessTokenRepository) DeleteExpired(now time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM access_tokens WHERE expires <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// The function of reading an access token from a row of selectAccessTokens
+func scanAccessToken(row interface{ Scan(dest ...any) error }) (*models.AccessToken, error) {
+	var token models.AccessToken
+	var scopes string
+	var lastUsed sql.NullTime
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.Hash, &scopes,
+		&token.Created, &token.Expires, &lastUsed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = make([]string, 0)
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, ",")
+	}
+	if lastUsed.Valid {
+		token.LastUsed = &lastUsed.Time
+	}
+	return &token, nil
+}
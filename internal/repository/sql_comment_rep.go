@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/scoring"
+)
+
+// A structure that stores the comments of posts in an SQL database and implements the CommentRepository interface
+type SQLCommentRepository struct {
+	db *sql.DB
+}
+
+// Comment repository constructor over an already opened and migrated database
+func NewSQLCommentRepository(db *sql.DB) *SQLCommentRepository {
+	return &SQLCommentRepository{db: db}
+}
+
+// The method of getting the comments of the post in the order in which they were added
+func (r *SQLCommentRepository) GetByPostID(postID string) ([]models.Comment, error) {
+	return getComments(r.db, postID)
+}
+
+// The method of adding a comment to the post. A reply must have ParentID set, its depth is derived from the parent.
+// Returns ErrCommentAlreadyExists if a comment with the same ID already exists, ErrCommentNotFound if the parent
+// does not exist or is deleted and ErrCommentTooDeep if the reply would be deeper than MaxCommentDepth
+func (r *SQLCommentRepository) Create(postID string, comment *models.Comment) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	comment.Depth = 0
+	var parentID any
+	if comment.ParentID != "" {
+		// The parent is locked so that it can not be removed while the reply is added
+		parent, err := lockComment(tx, postID, comment.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent.Deleted {
+			return ErrCommentNotFound
+		}
+		comment.Depth = parent.Depth + 1
+		if comment.Depth > MaxCommentDepth {
+			return ErrCommentTooDeep
+		}
+		parentID = comment.ParentID
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO comments (id, post_id, parent_id, depth, author_id, body, position, created)
+		VALUES ($1, $2, $3, $4, $5, $6, (SELECT COALESCE(MAX(position) + 1, 0) FROM comments WHERE post_id = $2), $7)
+		ON CONFLICT DO NOTHING`,
+		comment.ID, postID, parentID, comment.Depth, comment.Author.ID, comment.Body, comment.Created.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCommentAlreadyExists
+	}
+	return tx.Commit()
+}
+
+// The method of deleting the comment of the post, returns ErrCommentNotFound if the post has no such comment.
+// A comment with replies is replaced with a tombstone so that the thread stays intact,
+// tombstones left without replies are removed up the thread
+func (r *SQLCommentRepository) Delete(postID, commentID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	comment, err := lockComment(tx, postID, commentID)
+	if err != nil {
+		return err
+	}
+	if comment.Deleted {
+		return ErrCommentNotFound
+	}
+	for {
+		var replies int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM comments WHERE parent_id = $1`, comment.ID).Scan(&replies); err != nil {
+			return err
+		}
+		if replies > 0 {
+			if _, err := tx.Exec(`UPDATE comments SET deleted = TRUE, body = $2 WHERE id = $1`, comment.ID, DeletedCommentBody); err != nil {
+				return err
+			}
+			break
+		}
+		if _, err := tx.Exec(`DELETE FROM comments WHERE id = $1`, comment.ID); err != nil {
+			return err
+		}
+		if comment.ParentID == "" {
+			break
+		}
+		parent, err := lockComment(tx, postID, comment.ParentID)
+		if err != nil {
+			return err
+		}
+		if !parent.Deleted {
+			break
+		}
+		comment = parent
+	}
+	return tx.Commit()
+}
+
+// The method of deleting all comments of the post
+func (r *SQLCommentRepository) DeleteByPostID(postID string) error {
+	_, err := r.db.Exec(`DELETE FROM comments WHERE post_id = $1`, postID)
+	return err
+}
+
+// The method of casting (value 1 or -1) or removing (value 0) the vote of the user for the comment of the post in one transaction,
+// returns the comment with its votes and rating as they were at the commit, or ErrCommentNotFound if there is no such comment or it is deleted
+func (r *SQLCommentRepository) ApplyVote(postID, commentID, userID string, value int) (*models.Comment, error) {
+	if value != 1 && value != -1 && value != 0 {
+		return nil, ErrInvalidVote
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockComment(tx, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if locked.Deleted {
+		return nil, ErrCommentNotFound
+	}
+	if value == 0 {
+		_, err = tx.Exec(`DELETE FROM comment_votes WHERE comment_id = $1 AND user_id = $2`, commentID, userID)
+	} else {
+		_, err = tx.Exec(
+			`INSERT INTO comment_votes (comment_id, user_id, vote, position)
+			VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position) + 1, 0) FROM comment_votes WHERE comment_id = $1))
+			ON CONFLICT (comment_id, user_id) DO UPDATE SET vote = excluded.vote`,
+			commentID, userID, value,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var upvotes, downvotes int
+	if err := tx.QueryRow(
+		`SELECT COALESCE(SUM(CASE WHEN vote > 0 THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN vote < 0 THEN 1 ELSE 0 END), 0)
+		FROM comment_votes WHERE comment_id = $1`,
+		commentID,
+	).Scan(&upvotes, &downvotes); err != nil {
+		return nil, err
+	}
+	rating := scoring.FromCounts(upvotes, downvotes).Rating()
+	if _, err := tx.Exec(
+		`UPDATE comments SET score = $2, upvote_percentage = $3 WHERE id = $1`,
+		commentID, rating.Score, rating.UpvotePercentage,
+	); err != nil {
+		return nil, err
+	}
+
+	comments, err := getComments(tx, postID)
+	if err != nil {
+		return nil, err
+	}
+	for _, comment := range comments {
+		if comment.ID == commentID {
+			return &comment, tx.Commit()
+		}
+	}
+	return nil, ErrCommentNotFound
+}
+
+// The function of reading the comments of the post with their authors and votes in the order in which they were added
+func getComments(q sqlQueryer, postID string) ([]models.Comment, error) {
+	rows, err := q.Query(
+		`SELECT c.id, COALESCE(c.parent_id, ''), c.depth, u.id, u.username, c.body, c.score, c.upvote_percentage, c.created, c.deleted
+		FROM comments c JOIN users u ON u.id = c.author_id
+		WHERE c.post_id = $1 ORDER BY c.position`,
+		postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := make([]models.Comment, 0)
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(
+			&comment.ID, &comment.ParentID, &comment.Depth, &comment.Author.ID, &comment.Author.Username,
+			&comment.Body, &comment.Score, &comment.UpvotePercentage, &comment.Created, &comment.Deleted,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// The author of a tombstone is kept in the database but is not shown
+		if comment.Deleted {
+			comment.Author = models.User{}
+		}
+		comment.Votes = make([]models.Vote, 0)
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// The votes of all comments of the post are read with one query
+	voteRows, err := q.Query(
+		`SELECT v.comment_id, v.user_id, v.vote
+		FROM comment_votes v JOIN comments c ON c.id = v.comment_id
+		WHERE c.post_id = $1 ORDER BY v.comment_id, v.position`,
+		postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer voteRows.Close()
+	indexes := make(map[string]int, len(comments))
+	for index, comment := range comments {
+		indexes[comment.ID] = index
+	}
+	for voteRows.Next() {
+		var commentID string
+		var vote models.Vote
+		if err := voteRows.Scan(&commentID, &vote.UserID, &vote.Vote); err != nil {
+			return nil, err
+		}
+		if index, ok := indexes[commentID]; ok {
+			comments[index].Votes = append(comments[index].Votes, vote)
+		}
+	}
+	return comments, voteRows.Err()
+}
+
+// The function of locking the comment of the post until the end of the transaction and reading its place in the thread,
+// returns ErrCommentNotFound if the post has no such comment
+func lockComment(tx *sql.Tx, postID, commentID string) (*models.Comment, error) {
+	var comment models.Comment
+	err := tx.QueryRow(
+		`UPDATE comments SET depth = depth WHERE post_id = $1 AND id = $2
+		RETURNING id, COALESCE(parent_id, ''), depth, deleted`,
+		postID, commentID,
+	).Scan(&comment.ID, &comment.ParentID, &comment.Depth, &comment.Deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	// Driver registered under the name "pgx"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Errors related to opening the SQL storage
+var (
+	ErrUnknownDialect     = errors.New("unknown sql dialect")
+	ErrInvalidMigration   = errors.New("invalid migration file name")
+	ErrDuplicateMigration = errors.New("duplicate migration version")
+)
+
+// Supported SQL dialects, each of them has its own directory with migrations
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// The name of the database/sql driver used for each dialect
+var dialectDrivers = map[string]string{
+	DialectPostgres: "pgx",
+	DialectSQLite:   "sqlite",
+}
+
+// A single versioned schema change read from the migrations directory
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// The function of opening a connection to the database of the dialect by dsn, checks the connection and applies all missing migrations
+func OpenSQL(dialect, dsn string) (*sql.DB, error) {
+	driver, ok := dialectDrivers[dialect]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDialect, dialect)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer, so a single connection avoids "database is locked" errors
+	if dialect == DialectSQLite {
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := Migrate(db, dialect); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// The function of building the dsn of the SQLite database file with foreign keys enabled and times stored in a format that sorts as text
+func SQLiteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+}
+
+// The function of applying migrations of the dialect that are not yet recorded in the schema_migrations table, each migration runs in its own transaction
+func Migrate(db *sql.DB, dialect string) error {
+	migrations, err := readMigrations(dialect)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name    TEXT NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// The function of applying one migration and recording its version in one transaction
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.query); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The function of reading the migrations of the dialect sorted by version, the file name must look like 0001_name.sql
+func readMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	seen := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		prefix, name, found := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, errAtoi := strconv.Atoi(prefix)
+		if !found || errAtoi != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+		if seen[version] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateMigration, version)
+		}
+		seen[version] = true
+
+		query, err := fs.ReadFile(migrationsFS, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, query: string(query)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// The function of checking that the error is a violation of a unique index or constraint of the table.
+// Postgres reports the name of the index, SQLite the columns of it, so both are given. Primary keys count as unique indexes
+func isUniqueViolation(err error, index, columns string) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" && pgErr.ConstraintName == index
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return (code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY) &&
+			strings.Contains(sqliteErr.Error(), "UNIQUE constraint failed: "+columns)
+	}
+	return false
+}
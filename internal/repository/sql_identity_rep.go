@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A structure that stores the identities of the users in an SQL database and implements the IdentityRepository interface
+type SQLIdentityRepository struct {
+	db *sql.DB
+}
+
+// Identity repository constructor over an already opened and migrated database
+func NewSQLIdentityRepository(db *sql.DB) *SQLIdentityRepository {
+	return &SQLIdentityRepository{db: db}
+}
+
+// The method of saving a new identity; causes an error ErrIdentityAlreadyExists if the subject of the provider is already linked
+func (r *SQLIdentityRepository) Create(identity *models.Identity) error {
+	result, err := r.db.Exec(
+		`INSERT INTO user_identities (provider, subject, user_id, created) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Created.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrIdentityAlreadyExists
+	}
+	return nil
+}
+
+// The method of obtaining the identity of the subject at the provider; return ErrIdentityNotFound if it is not linked to any user
+func (r *SQLIdentityRepository) Get(provider, subject string) (*models.Identity, error) {
+	identity := models.Identity{Provider: provider, Subject: subject}
+	err := r.db.QueryRow(
+		`SELECT user_id, created FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject,
+	).Scan(&identity.UserID, &identity.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
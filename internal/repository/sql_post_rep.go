@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A common part of the queries that read posts together with their authors
+const selectPosts = `SELECT p.id, p.score, p.views, p.type, p.title, u.id, u.username, p.category, p.text, p.url, p.created, p.upvote_percentage, p.locked
+	FROM posts p JOIN users u ON u.id = p.author_id`
+
+// Interface of the methods shared by *sql.DB and *sql.Tx that are needed for reading
+type sqlQueryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// A structure that stores posts in an SQL database and implements the PostRepository interface
+type SQLPostRepository struct {
+	db *sql.DB
+}
+
+// Post repository constructor over an already opened and migrated database
+func NewSQLPostRepository(db *sql.DB) *SQLPostRepository {
+	return &SQLPostRepository{db: db}
+}
+
+// The method of getting all the storing posts
+func (r *SQLPostRepository) GetAll() ([]models.Post, error) {
+	posts, err := r.getMany(selectPosts + ` ORDER BY p.created`)
+	if err != nil {
+		return nil, err
+	}
+	if posts == nil {
+		posts = make([]models.Post, 0)
+	}
+	return posts, nil
+}
+
+// The method of getting a post by its ID, return ErrPostNotFound if post with id equals postID not exists
+func (r *SQLPostRepository) GetByID(postID string) (*models.Post, error) {
+	return getPost(r.db, postID)
+}
+
+// The method of obtaining all stored posts corresponding to the category
+func (r *SQLPostRepository) GetByCategory(category string) ([]models.Post, error) {
+	return r.getMany(selectPosts+` WHERE p.category = $1 ORDER BY p.created`, category)
+}
+
+// The method of getting all stored posts belonging to the user whose ID corresponds to the userID, return ErrNoPostsUser if posts this user not found
+func (r *SQLPostRepository) GetByUserID(userID string) ([]models.Post, error) {
+	userPosts, err := r.getMany(selectPosts+` WHERE p.author_id = $1 ORDER BY p.created`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(userPosts) == 0 {
+		return nil, ErrNoPostsUser
+	}
+	return userPosts, nil
+}
+
+// The method of getting a page of the posts selected by the query, ordered from newer to older posts
+func (r *SQLPostRepository) GetPage(query PostQuery) (*PostPage, error) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if query.Category != "" {
+		conditions = append(conditions, "p.category = "+arg(query.Category))
+	}
+	if query.AuthorID != "" {
+		conditions = append(conditions, "p.author_id = "+arg(query.AuthorID))
+	}
+	order := "DESC"
+	switch {
+	case query.Before != nil:
+		// The posts closest to the cursor are read first and reversed afterwards
+		conditions = append(conditions, "(p.created, p.id) > ("+arg(query.Before.Created.UTC())+", "+arg(query.Before.ID)+")")
+		order = "ASC"
+	case query.After != nil:
+		conditions = append(conditions, "(p.created, p.id) < ("+arg(query.After.Created.UTC())+", "+arg(query.After.ID)+")")
+	}
+
+	sqlQuery := selectPosts
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// One extra post tells whether there are more posts past the page
+	sqlQuery += " ORDER BY p.created " + order + ", p.id " + order + " LIMIT " + arg(query.Limit+1)
+
+	posts, err := r.getMany(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	page := &PostPage{HasMore: len(posts) > query.Limit}
+	if page.HasMore {
+		posts = posts[:query.Limit]
+	}
+	if query.Before != nil {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+	if posts == nil {
+		posts = make([]models.Post, 0)
+	}
+	page.Posts = posts
+	return page, nil
+}
+
+// The method of storing a new post, returns ErrPostAlreadyExists if a post with the same ID already exists
+func (r *SQLPostRepository) Create(post *models.Post) error {
+	result, err := r.db.Exec(
+		`INSERT INTO posts (id, author_id, category, type, title, text, url, score, views, upvote_percentage, created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT DO NOTHING`,
+		post.ID, post.Author.ID, post.Category, post.Type, post.Title, post.Text, post.URL,
+		post.Score, post.Views, post.UpvotePercentage, post.Created.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostAlreadyExists
+	}
+	return nil
+}
+
+// The method that deletes a post with an ID equal to postID together with its votes and comments, returns ErrPostNotFound if there is no such post
+func (r *SQLPostRepository) Delete(postID string) error {
+	result, err := r.db.Exec(`DELETE FROM posts WHERE id = $1`, postID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// The update method of the modified post, returns ErrPostNotFound if there is no such post in the database at the time of the update.
+// The rating of the post is maintained by the vote repository, its lock by SetLocked and its views by IncrementViews, they are not changed here
+func (r *SQLPostRepository) Update(post *models.Post) error {
+	result, err := r.db.Exec(
+		`UPDATE posts SET category = $2, type = $3, title = $4, text = $5, url = $6 WHERE id = $1`,
+		post.ID, post.Category, post.Type, post.Title, post.Text, post.URL,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// The method of locking or unlocking the post, returns the changed post or ErrPostNotFound if there is no such post
+func (r *SQLPostRepository) SetLocked(postID string, locked bool) (*models.Post, error) {
+	result, err := r.db.Exec(`UPDATE posts SET locked = $2 WHERE id = $1`, postID, locked)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrPostNotFound
+	}
+	return getPost(r.db, postID)
+}
+
+// The method of counting one more view of the post, returns ErrPostNotFound if there is no such post
+func (r *SQLPostRepository) IncrementViews(postID string) error {
+	result, err := r.db.Exec(`UPDATE posts SET views = views + 1 WHERE id = $1`, postID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// The method of casting (value 1 or -1) or removing (value 0) the vote of the user for the post in one transaction,
+// returns the post with its votes and rating as they were at the commit, or ErrPostNotFound if there is no such post
+func (r *SQLPostRepository) ApplyVote(postID, userID string, value int) (*models.Post, error) {
+	if value != 1 && value != -1 && value != 0 {
+		return nil, ErrInvalidVote
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rating, err := changeVote(tx, postID, userID, value)
+	if err != nil {
+		return nil, err
+	}
+	post, err := getPost(tx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.Votes, err = getVotes(tx, postID); err != nil {
+		return nil, err
+	}
+	post.Score = rating.Score
+	post.UpvotePercentage = rating.UpvotePercentage
+	return post, tx.Commit()
+}
+
+// The method of reading several posts by the query
+func (r *SQLPostRepository) getMany(query string, args ...any) ([]models.Post, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+// The function of reading one post, return ErrPostNotFound if there is no such post
+func getPost(q sqlQueryer, postID string) (*models.Post, error) {
+	post, err := scanPost(q.QueryRow(selectPosts+` WHERE p.id = $1`, postID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// The function of scanning a row of the selectPosts query into a post
+func scanPost(row interface{ Scan(dest ...any) error }) (*models.Post, error) {
+	var post models.Post
+	err := row.Scan(
+		&post.ID, &post.Score, &post.Views, &post.Type, &post.Title, &post.Author.ID, &post.Author.Username,
+		&post.Category, &post.Text, &post.URL, &post.Created, &post.UpvotePercentage, &post.Locked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
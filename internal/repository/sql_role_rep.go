@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A structure that stores the roles of the users in an SQL database and implements the RoleRepository interface.
+// The roles on the whole site have an empty category
+type SQLRoleRepository struct {
+	db *sql.DB
+}
+
+// Role repository constructor over an already opened and migrated database
+func NewSQLRoleRepository(db *sql.DB) *SQLRoleRepository {
+	return &SQLRoleRepository{db: db}
+}
+
+// A common part of the queries that read roles
+const selectRoles = `SELECT user_id, role, category, created FROM user_roles`
+
+// The method of granting a role to the user; causes an error ErrRoleAlreadyGranted if the user already has the role in the category
+func (r *SQLRoleRepository) Grant(grant *models.RoleGrant) error {
+	result, err := r.db.Exec(
+		`INSERT INTO user_roles (user_id, role, category, created) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+		grant.UserID, grant.Role, grant.Category, grant.Created.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRoleAlreadyGranted
+	}
+	return nil
+}
+
+// The method of revoking the role of the user in the category, returns ErrRoleNotFound if the user has no such role
+func (r *SQLRoleRepository) Revoke(userID, role, category string) error {
+	result, err := r.db.Exec(
+		`DELETE FROM user_roles WHERE user_id = $1 AND role = $2 AND category = $3`, userID, role, category,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// The method of obtaining all roles of the user, a user without roles gets an empty slice
+func (r *SQLRoleRepository) GetByUserID(userID string) ([]models.RoleGrant, error) {
+	return r.getMany(selectRoles+` WHERE user_id = $1`, userID)
+}
+
+// The method of obtaining the roles of all users
+func (r *SQLRoleRepository) GetAll() ([]models.RoleGrant, error) {
+	return r.getMany(selectRoles)
+}
+
+// The method of reading the roles selected by the query
+func (r *SQLRoleRepository) getMany(query string, args ...any) ([]models.RoleGrant, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	grants := make([]models.RoleGrant, 0)
+	for rows.Next() {
+		var grant models.RoleGrant
+		if err := rows.Scan(&grant.UserID, &grant.Role, &grant.Category, &grant.Created); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
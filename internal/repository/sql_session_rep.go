@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A structure that stores sessions in an SQL database and implements the SessionRepository interface
+type SQLSessionRepository struct {
+	db *sql.DB
+}
+
+// Session repository constructor over an already opened and migrated database
+func NewSQLSessionRepository(db *sql.DB) *SQLSessionRepository {
+	return &SQLSessionRepository{db: db}
+}
+
+// A common part of the queries that read sessions
+const selectSessions = `SELECT id, user_id, refresh_token_hash, user_agent, ip, created, last_seen, expires FROM sessions`
+
+// The method of obtaining a session by ID; return ErrSessionNotFound if sessions with that ID doesn't exist
+func (r *SQLSessionRepository) GetByID(sessionID string) (*models.Session, error) {
+	session, err := scanSession(r.db.QueryRow(selectSessions+` WHERE id = $1`, sessionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// The method of obtaining all sessions of the user, a user without sessions gets an empty slice
+func (r *SQLSessionRepository) GetByUserID(userID string) ([]models.Session, error) {
+	rows, err := r.db.Query(selectSessions+` WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// The method of saving a new session; causes an error ErrSessionAlreadyExists if a session with such an ID or refresh token already exists
+func (r *SQLSessionRepository) Create(session *models.Session) error {
+	result, err := r.db.Exec(
+		`INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip, created, last_seen, expires)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`,
+		session.ID, session.UserID, session.RefreshTokenHash, session.UserAgent, session.IP,
+		session.Created.UTC(), session.LastSeen.UTC(), session.Expires.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionAlreadyExists
+	}
+	return nil
+}
+
+// The method of replacing the current refresh token of a session with a new one in one transaction, returns the session after the rotation.
+// Returns ErrSessionNotFound if no live session has such a refresh token, and ErrRefreshTokenReused after deleting
+// the session if the refresh token was already rotated
+func (r *SQLSessionRepository) Rotate(refreshTokenHash, newRefreshTokenHash string, now time.Time) (*models.Session, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The update only succeeds for the current refresh token, so of two concurrent rotations only one wins
+	session, err := scanSession(tx.QueryRow(
+		`UPDATE sessions SET refresh_token_hash = $2, last_seen = $3 WHERE refresh_token_hash = $1 AND expires > $3
+		RETURNING id, user_id, refresh_token_hash, user_agent, ip, created, last_seen, expires`,
+		refreshTokenHash, newRefreshTokenHash, now.UTC(),
+	))
+	if err == nil {
+		if _, err := tx.Exec(
+			`INSERT INTO retired_refresh_tokens (hash, session_id) VALUES ($1, $2)`,
+			refreshTokenHash, session.ID,
+		); err != nil {
+			return nil, err
+		}
+		return session, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var sessionID string
+	err = tx.QueryRow(`SELECT session_id FROM retired_refresh_tokens WHERE hash = $1`, refreshTokenHash).Scan(&sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE id = $1`, sessionID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// The method of recording the time the session was last used, returns ErrSessionNotFound if there is no such session
+func (r *SQLSessionRepository) Touch(sessionID string, lastSeen time.Time) error {
+	result, err := r.db.Exec(`UPDATE sessions SET last_seen = $2 WHERE id = $1`, sessionID, lastSeen.UTC())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// The method of deleting the session with the ID, returns ErrSessionNotFound if there is no such session
+func (r *SQLSessionRepository) Delete(sessionID string) error {
+	result, err := r.db.Exec(`DELETE FROM sessions WHERE id = $1`, sessionID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// The method of deleting all sessions of the user
+func (r *SQLSessionRepository) DeleteByUserID(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+// The method of deleting the sessions that expired before now, returns the number of deleted sessions
+func (r *SQLSessionRepository) DeleteExpired(now time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM sessions WHERE expires < $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// The function of scanning a row of the selectSessions query into a session
+func scanSession(row interface{ Scan(dest ...any) error }) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.RefreshTokenHash, &session.UserAgent, &session.IP,
+		&session.Created, &session.LastSeen, &session.Expires,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A structure that stores users in an SQL database and implements the UserRepository interface
+type SQLUserRepository struct {
+	db *sql.DB
+}
+
+// User repository constructor over an already opened and migrated database
+func NewSQLUserRepository(db *sql.DB) *SQLUserRepository {
+	return &SQLUserRepository{db: db}
+}
+
+// The unique index of the verified emails, one email may be verified by only one user
+const verifiedEmailIndex = "users_verified_email_idx"
+
+// The columns of a user read by getOne
+const selectUsers = `SELECT id, username, password, email, email_verified, totp_secret, totp_enabled, totp_last_step, banned FROM users`
+
+// The method of obtaining a user by username; return ErrUserNotFound if user with that username doesn't exist
+func (r *SQLUserRepository) GetByUsername(username string) (*models.User, error) {
+	return r.getOne(selectUsers+` WHERE username = $1`, username)
+}
+
+// The method of obtaining a user by ID; return ErrUserNotFound if user with that userID doesn't exist
+func (r *SQLUserRepository) GetByID(userID string) (*models.User, error) {
+	return r.getOne(selectUsers+` WHERE id = $1`, userID)
+}
+
+// The method of obtaining the user with the verified email; return ErrUserNotFound if no user has verified that email
+func (r *SQLUserRepository) GetByEmail(email string) (*models.User, error) {
+	return r.getOne(selectUsers+` WHERE email = $1 AND email_verified`, email)
+}
+
+// The method of saving a new user; causes an error ErrUserAlreadyExists if a user with such an ID or username already exists
+// and ErrEmailTaken if the email of the user is verified and another user has verified it
+func (r *SQLUserRepository) Create(user *models.User) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO users (id, username, password, email, email_verified, totp_secret, totp_enabled, totp_last_step, banned)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		user.ID, user.Username, user.Password, user.Email, user.EmailVerified, user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep,
+		user.Banned,
+	)
+	if isUniqueViolation(err, verifiedEmailIndex, "users.email") {
+		return ErrEmailTaken
+	}
+	if isUniqueViolation(err, "users_pkey", "users.id") || isUniqueViolation(err, "users_username_key", "users.username") {
+		return ErrUserAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := insertRecoveryCodes(tx, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The method of saving the changed user, the ban and the second factors are kept; return ErrUserNotFound if user with that ID doesn't exist
+// and ErrEmailTaken if the email of the user is verified and another user has verified it
+func (r *SQLUserRepository) Update(user *models.User) error {
+	result, err := r.db.Exec(
+		`UPDATE users SET username = $2, password = $3, email = $4, email_verified = $5 WHERE id = $1`,
+		user.ID, user.Username, user.Password, user.Email, user.EmailVerified,
+	)
+	if isUniqueViolation(err, verifiedEmailIndex, "users.email") {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// The method of removing the recovery code with the hash from the user; return ErrRecoveryCodeNotFound if the user has no such code
+func (r *SQLUserRepository) UseRecoveryCode(userID, codeHash string) error {
+	result, err := r.db.Exec(`DELETE FROM recovery_codes WHERE user_id = $1 AND hash = $2`, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+// The method of banning or unbanning the user; return ErrUserNotFound if user with that ID doesn't exist
+func (r *SQLUserRepository) SetBanned(userID string, banned bool) error {
+	result, err := r.db.Exec(`UPDATE users SET banned = $2 WHERE id = $1`, userID, banned)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// The method of recording the time step of an accepted TOTP code; return ErrTOTPStepUsed if the step is not after the last accepted one
+func (r *SQLUserRepository) AdvanceTOTPStep(userID string, step int64) error {
+	result, err := r.db.Exec(`UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2`, userID, step)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPStepUsed
+	}
+	return nil
+}
+
+// The method of storing a new TOTP secret of the user that is not enabled yet; return ErrTOTPStateChanged if the TOTP is enabled
+func (r *SQLUserRepository) EnrollTOTP(userID, secret string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE users SET totp_secret = $2, totp_last_step = 0 WHERE id = $1 AND NOT totp_enabled`, userID, secret,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPStateChanged
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The method of enabling the enrolled TOTP secret with the recovery code hashes; return ErrTOTPStateChanged if the TOTP is
+// already enabled or the secret was replaced by another enrollment
+func (r *SQLUserRepository) EnableTOTP(userID, secret string, recoveryCodes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE users SET totp_enabled = TRUE WHERE id = $1 AND totp_secret = $2 AND NOT totp_enabled`, userID, secret,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPStateChanged
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := insertRecoveryCodes(tx, &models.User{ID: userID, RecoveryCodes: recoveryCodes}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The method of turning off the TOTP of the user, removes the secret and the recovery codes; return ErrUserNotFound if user with that ID doesn't exist
+func (r *SQLUserRepository) DisableTOTP(userID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE users SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0 WHERE id = $1`, userID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The function of inserting the recovery codes of the user in the transaction
+func insertRecoveryCodes(tx *sql.Tx, user *models.User) error {
+	for _, codeHash := range user.RecoveryCodes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, user.ID, codeHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The method of reading one user by the query together with its recovery codes, return ErrUserNotFound if the query returned no rows
+func (r *SQLUserRepository) getOne(query string, args ...any) (*models.User, error) {
+	var user models.User
+	err := r.db.QueryRow(query, args...).Scan(
+		&user.ID, &user.Username, &user.Password, &user.Email, &user.EmailVerified,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.Banned,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`SELECT hash FROM recovery_codes WHERE user_id = $1`, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var codeHash string
+		if err := rows.Scan(&codeHash); err != nil {
+			return nil, err
+		}
+		user.RecoveryCodes = append(user.RecoveryCodes, codeHash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// A structure that stores the single-use tokens of the users in an SQL database and implements the UserTokenRepository interface
+type SQLUserTokenRepository struct {
+	db *sql.DB
+}
+
+// User token repository constructor over an already opened and migrated database
+func NewSQLUserTokenRepository(db *sql.DB) *SQLUserTokenRepository {
+	return &SQLUserTokenRepository{db: db}
+}
+
+// The method of saving a new token; causes an error ErrUserTokenAlreadyExists if a token with such a hash already exists
+func (r *SQLUserTokenRepository) Create(token *models.UserToken) error {
+	result, err := r.db.Exec(
+		`INSERT INTO user_tokens (hash, user_id, purpose, email, expires) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`,
+		token.Hash, token.UserID, token.Purpose, token.Email, token.Expires.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserTokenAlreadyExists
+	}
+	return nil
+}
+
+// The method of using up the token with the hash; returns ErrUserTokenNotFound if there is no such token with the purpose
+// or it has expired. The token is deleted and returned by one statement, so it can be used only once
+func (r *SQLUserTokenRepository) Consume(hash, purpose string, now time.Time) (*models.UserToken, error) {
+	token := models.UserToken{Hash: hash, Purpose: purpose}
+	err := r.db.QueryRow(
+		`DELETE FROM user_tokens WHERE hash = $1 AND purpose = $2 AND expires > $3 RETURNING user_id, email, expires`,
+		hash, purpose, now.UTC(),
+	).Scan(&token.UserID, &token.Email, &token.Expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// The method of deleting all tokens of the user with the purpose
+func (r *SQLUserTokenRepository) DeleteByUserID(userID, purpose string) error {
+	_, err := r.db.Exec(`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	return err
+}
+
+// The method of deleting the tokens that have expired by now, returns the number of deleted tokens
+func (r *SQLUserTokenRepository) DeleteExpired(now time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM user_tokens WHERE expires <= $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
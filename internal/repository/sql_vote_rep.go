@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/scoring"
+)
+
+// A structure that stores the votes of posts in an SQL database and implements the VoteRepository interface.
+// The rating of the post is stored in the posts table and is updated in the same transaction as the votes
+type SQLVoteRepository struct {
+	db *sql.DB
+}
+
+// Vote repository constructor over an already opened and migrated database
+func NewSQLVoteRepository(db *sql.DB) *SQLVoteRepository {
+	return &SQLVoteRepository{db: db}
+}
+
+// The method of getting the votes of the post in the order in which they were cast
+func (r *SQLVoteRepository) GetByPostID(postID string) ([]models.Vote, error) {
+	return getVotes(r.db, postID)
+}
+
+// The method of getting the current rating of the post, returns ErrPostNotFound if there is no such post
+func (r *SQLVoteRepository) GetRating(postID string) (models.Rating, error) {
+	var rating models.Rating
+	err := r.db.QueryRow(`SELECT score, upvote_percentage FROM posts WHERE id = $1`, postID).
+		Scan(&rating.Score, &rating.UpvotePercentage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rating{}, ErrPostNotFound
+	}
+	return rating, err
+}
+
+// The method of casting the vote of the user or changing it, returns ErrInvalidVote if the value is not 1 or -1
+func (r *SQLVoteRepository) Cast(postID, userID string, value int) (models.Rating, error) {
+	if value != 1 && value != -1 {
+		return models.Rating{}, ErrInvalidVote
+	}
+	return r.change(postID, userID, value)
+}
+
+// The method of removing the vote of the user, removing a vote that does not exist changes nothing
+func (r *SQLVoteRepository) Remove(postID, userID string) (models.Rating, error) {
+	return r.change(postID, userID, 0)
+}
+
+// The method of deleting all votes of the post
+func (r *SQLVoteRepository) DeleteByPostID(postID string) error {
+	_, err := r.db.Exec(`DELETE FROM votes WHERE post_id = $1`, postID)
+	return err
+}
+
+// The method of casting (value 1 or -1) or removing (value 0) the vote and recalculating the rating of the post in one transaction
+func (r *SQLVoteRepository) change(postID, userID string, value int) (models.Rating, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return models.Rating{}, err
+	}
+	defer tx.Rollback()
+
+	rating, err := changeVote(tx, postID, userID, value)
+	if err != nil {
+		return models.Rating{}, err
+	}
+	return rating, tx.Commit()
+}
+
+// The function of casting (value 1 or -1) or removing (value 0) the vote and storing the new rating of the post.
+// The post row is locked first, so concurrent changes of the votes of one post are applied one after another
+func changeVote(tx *sql.Tx, postID, userID string, value int) (models.Rating, error) {
+	if err := lockPost(tx, postID); err != nil {
+		return models.Rating{}, err
+	}
+
+	var err error
+	if value == 0 {
+		_, err = tx.Exec(`DELETE FROM votes WHERE post_id = $1 AND user_id = $2`, postID, userID)
+	} else {
+		_, err = tx.Exec(
+			`INSERT INTO votes (post_id, user_id, vote, position)
+			VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position) + 1, 0) FROM votes WHERE post_id = $1))
+			ON CONFLICT (post_id, user_id) DO UPDATE SET vote = excluded.vote`,
+			postID, userID, value,
+		)
+	}
+	if err != nil {
+		return models.Rating{}, err
+	}
+	return updateRating(tx, postID)
+}
+
+// The function of locking the post row until the end of the transaction, returns ErrPostNotFound if there is no such post
+func lockPost(tx *sql.Tx, postID string) error {
+	result, err := tx.Exec(`UPDATE posts SET score = score WHERE id = $1`, postID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// The function of recalculating the rating of the post from its votes and storing it in the posts table
+func updateRating(tx *sql.Tx, postID string) (models.Rating, error) {
+	var upvotes, downvotes int
+	if err := tx.QueryRow(
+		`SELECT COALESCE(SUM(CASE WHEN vote > 0 THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN vote < 0 THEN 1 ELSE 0 END), 0)
+		FROM votes WHERE post_id = $1`,
+		postID,
+	).Scan(&upvotes, &downvotes); err != nil {
+		return models.Rating{}, err
+	}
+
+	rating := scoring.FromCounts(upvotes, downvotes).Rating()
+	if _, err := tx.Exec(
+		`UPDATE posts SET score = $2, upvote_percentage = $3 WHERE id = $1`,
+		postID, rating.Score, rating.UpvotePercentage,
+	); err != nil {
+		return models.Rating{}, err
+	}
+	return rating, nil
+}
+
+// The function of reading the votes of the post in the order in which they were cast
+func getVotes(q sqlQueryer, postID string) ([]models.Vote, error) {
+	rows, err := q.Query(`SELECT user_id, vote FROM votes WHERE post_id = $1 ORDER BY position`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	votes := make([]models.Vote, 0)
+	for rows.Next() {
+		var vote models.Vote
+		if err := rows.Scan(&vote.UserID, &vote.Vote); err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+	return votes, rows.Err()
+}
@@ -0,0 +1,47 @@
+package scoring
+
+import "github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+
+// Tally - the numbers derived from the votes of a post
+type Tally struct {
+	Score            int
+	Upvotes          int
+	Downvotes        int
+	UpvotePercentage int
+}
+
+// The function of counting the votes of a post, votes other than 1 and -1 are ignored
+func FromVotes(votes []models.Vote) Tally {
+	var upvotes, downvotes int
+	for _, vote := range votes {
+		switch vote.Vote {
+		case 1:
+			upvotes++
+		case -1:
+			downvotes++
+		}
+	}
+	return FromCounts(upvotes, downvotes)
+}
+
+// The function of deriving the tally from the number of upvotes and downvotes.
+// The upvote percentage is the share of upvotes among all votes rounded to the nearest integer, a post without votes has 0
+func FromCounts(upvotes, downvotes int) Tally {
+	tally := Tally{
+		Score:     upvotes - downvotes,
+		Upvotes:   upvotes,
+		Downvotes: downvotes,
+	}
+	if total := upvotes + downvotes; total > 0 {
+		tally.UpvotePercentage = (upvotes*100 + total/2) / total
+	}
+	return tally
+}
+
+// The method of converting the tally to the rating shown in the JSON of the post
+func (t Tally) Rating() models.Rating {
+	return models.Rating{
+		Score:            t.Score,
+		UpvotePercentage: t.UpvotePercentage,
+	}
+}
@@ -0,0 +1,97 @@
+package scoring
+
+import (
+	"testing"
+
+	"github.com/l-ILINDAN-l/BackendCloneReddit/internal/models"
+)
+
+// The function of building the votes of a post: the votes of the others followed by the vote of the voter, 0 means no vote
+func votesWith(others []models.Vote, vote int) []models.Vote {
+	votes := append([]models.Vote(nil), others...)
+	if vote != 0 {
+		votes = append(votes, models.Vote{UserID: "voter", Vote: vote})
+	}
+	return votes
+}
+
+func TestVoteTransitions(t *testing.T) {
+	crowd := []models.Vote{{UserID: "a", Vote: 1}, {UserID: "b", Vote: 1}, {UserID: "c", Vote: -1}}
+	tests := []struct {
+		name          string
+		others        []models.Vote
+		from, to      int
+		score         int
+		percentage    int
+		scoreBefore   int
+		percentBefore int
+	}{
+		{name: "none to up", others: crowd, from: 0, to: 1, scoreBefore: 1, percentBefore: 67, score: 2, percentage: 75},
+		{name: "none to down", others: crowd, from: 0, to: -1, scoreBefore: 1, percentBefore: 67, score: 0, percentage: 50},
+		{name: "up to down", others: crowd, from: 1, to: -1, scoreBefore: 2, percentBefore: 75, score: 0, percentage: 50},
+		{name: "down to up", others: crowd, from: -1, to: 1, scoreBefore: 0, percentBefore: 50, score: 2, percentage: 75},
+		{name: "up to none", others: crowd, from: 1, to: 0, scoreBefore: 2, percentBefore: 75, score: 1, percentage: 67},
+		{name: "down to none", others: crowd, from: -1, to: 0, scoreBefore: 0, percentBefore: 50, score: 1, percentage: 67},
+		{name: "up repeated", others: crowd, from: 1, to: 1, scoreBefore: 2, percentBefore: 75, score: 2, percentage: 75},
+		{name: "down repeated", others: crowd, from: -1, to: -1, scoreBefore: 0, percentBefore: 50, score: 0, percentage: 50},
+		{name: "none repeated", others: crowd, from: 0, to: 0, scoreBefore: 1, percentBefore: 67, score: 1, percentage: 67},
+		{name: "first vote up", from: 0, to: 1, scoreBefore: 0, percentBefore: 0, score: 1, percentage: 100},
+		{name: "first vote down", from: 0, to: -1, scoreBefore: 0, percentBefore: 0, score: -1, percentage: 0},
+		{name: "only vote cancelled", from: 1, to: 0, scoreBefore: 1, percentBefore: 100, score: 0, percentage: 0},
+		{name: "only vote flipped", from: -1, to: 1, scoreBefore: -1, percentBefore: 0, score: 1, percentage: 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := FromVotes(votesWith(test.others, test.from))
+			if before.Score != test.scoreBefore || before.UpvotePercentage != test.percentBefore {
+				t.Fatalf("before: score %d, %d%%, want %d, %d%%", before.Score, before.UpvotePercentage, test.scoreBefore, test.percentBefore)
+			}
+			after := FromVotes(votesWith(test.others, test.to))
+			if after.Score != test.score || after.UpvotePercentage != test.percentage {
+				t.Fatalf("after: score %d, %d%%, want %d, %d%%", after.Score, after.UpvotePercentage, test.score, test.percentage)
+			}
+			// The score changes exactly by the change of the vote
+			if after.Score-before.Score != test.to-test.from {
+				t.Fatalf("score changed by %d, want %d", after.Score-before.Score, test.to-test.from)
+			}
+			if after.Upvotes+after.Downvotes != len(votesWith(test.others, test.to)) {
+				t.Fatalf("%d upvotes and %d downvotes do not add up to the votes", after.Upvotes, after.Downvotes)
+			}
+		})
+	}
+}
+
+func TestFromCounts(t *testing.T) {
+	tests := []struct {
+		upvotes, downvotes int
+		score, percentage  int
+	}{
+		{0, 0, 0, 0},
+		{1, 0, 1, 100},
+		{0, 1, -1, 0},
+		{1, 1, 0, 50},
+		{2, 1, 1, 67},
+		{1, 2, -1, 33},
+		{1, 7, -6, 13},
+		{199, 1, 198, 100},
+		{1, 199, -198, 1},
+	}
+	for _, test := range tests {
+		tally := FromCounts(test.upvotes, test.downvotes)
+		if tally.Score != test.score || tally.UpvotePercentage != test.percentage {
+			t.Errorf("FromCounts(%d, %d) = score %d, %d%%, want %d, %d%%",
+				test.upvotes, test.downvotes, tally.Score, tally.UpvotePercentage, test.score, test.percentage)
+		}
+		rating := tally.Rating()
+		if rating.Score != tally.Score || rating.UpvotePercentage != tally.UpvotePercentage {
+			t.Errorf("Rating %+v does not match the tally %+v", rating, tally)
+		}
+	}
+}
+
+func TestFromVotesIgnoresInvalidValues(t *testing.T) {
+	tally := FromVotes([]models.Vote{{UserID: "a", Vote: 1}, {UserID: "b", Vote: 2}, {UserID: "c", Vote: 0}, {UserID: "d", Vote: -1}})
+	if tally.Upvotes != 1 || tally.Downvotes != 1 || tally.Score != 0 || tally.UpvotePercentage != 50 {
+		t.Fatalf("tally %+v, want one upvote and one downvote", tally)
+	}
+}
@@ -0,0 +1,97 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters of the codes, the defaults of RFC 6238 that every authenticator app supports
+const (
+	Digits     = 6
+	Period     = 30 * time.Second
+	SecretSize = 20 // bytes, the size of the SHA-1 output recommended by RFC 4226
+)
+
+// How many time steps before and after the current one are accepted, so that a slightly wrong clock still works
+const Skew = 1
+
+// The encoding of the secrets in the otpauth URIs
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// The function of generating a new random secret in base32
+func GenerateSecret() (string, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// The function of getting the time step of the time
+func Step(now time.Time) int64 {
+	return now.Unix() / int64(Period/time.Second)
+}
+
+// The function of computing the code of the secret for the time step, RFC 4226 with HMAC-SHA1
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo), nil
+}
+
+// The function of checking the code against the secret at the time, returns the time step the code belongs to.
+// Only the steps after lastStep are accepted, so that a code can not be used twice
+func Validate(secret, code string, now time.Time, lastStep int64) (step int64, ok bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(now)
+	for candidate := current - Skew; candidate <= current+Skew; candidate++ {
+		if candidate <= lastStep {
+			continue
+		}
+		expected, err := Code(secret, candidate)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// The function of building the otpauth:// URI of the secret that the authenticator apps read from a QR code
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+	// Authenticator apps do not read + as a space
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA1 secret "12345678901234567890" of the test vectors of RFC 6238 in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// The 8-digit values of the RFC with the last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Fatalf("code at %d: %s, want %s", test.unix, code, test.code)
+		}
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Fatal("code of an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		step     int64
+		ok       bool
+	}{
+		{name: "current step", code: codeAt(current), step: current, ok: true},
+		{name: "previous step", code: codeAt(current - Skew), step: current - Skew, ok: true},
+		{name: "next step", code: codeAt(current + Skew), step: current + Skew, ok: true},
+		{name: "outside the window before", code: codeAt(current - Skew - 1)},
+		{name: "outside the window after", code: codeAt(current + Skew + 1)},
+		{name: "step already used", code: codeAt(current), lastStep: current},
+		{name: "earlier step after a later one was used", code: codeAt(current - 1), lastStep: current},
+		{name: "later step after an earlier one was used", code: codeAt(current + 1), lastStep: current, step: current + 1, ok: true},
+		{name: "wrong code", code: "000000"},
+		{name: "wrong length", code: codeAt(current)[:Digits-1]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, test.code, now, test.lastStep)
+			if ok != test.ok || (ok && step != test.step) {
+				t.Fatalf("Validate: step %d ok %t, want step %d ok %t", step, ok, test.step, test.ok)
+			}
+		})
+	}
+}